@@ -6,13 +6,15 @@ package main
 
 import (
 	"log"
+	"os"
 
-	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
 )
 
 func main() {
-	assetChaincode, err := contractapi.NewChaincode(&chaincode.SmartContract{})
+	// InitLedger only loads the sample assets when CHAINCODE_DEV_MODE is "true"
+	adminContract := &chaincode.AdminContract{DevMode: os.Getenv("CHAINCODE_DEV_MODE") == "true"}
+	assetChaincode, err := chaincode.NewChaincode(&chaincode.AssetContract{}, &chaincode.QueryContract{}, adminContract, &chaincode.TokenContract{}, &chaincode.NFTContract{}, &chaincode.ComplianceContract{})
 	if err != nil {
 		log.Panicf("Error creating asset-transfer-basic chaincode: %v", err)
 	}
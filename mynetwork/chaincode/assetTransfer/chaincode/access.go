@@ -0,0 +1,338 @@
+package chaincode
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Roles are kept under composite keys, which open-ended range queries such as
+// GetAllAssets never return.
+const (
+	contractOwnerObjectType     = "contract~owner"
+	contractAdminObjectType     = "contract~admin"
+	contractRegulatorObjectType = "contract~regulator"
+)
+
+var errNotInitialized = newContractError(ErrInvalidStatus, nil, "the contract is not initialized, call Initialize first")
+
+// AdminContract initializes the contract, keeps its roles and configures it:
+// the sample and seed assets, schema migrations, allowed colors and quotas.
+type AdminContract struct {
+	Contract
+
+	// DevMode enables InitLedger, which loads sample assets.
+	DevMode bool
+}
+
+// GetName returns the name the admin transactions are called under, e.g.
+// admin:Initialize.
+func (a *AdminContract) GetName() string {
+	return "admin"
+}
+
+// AccessDeniedError is returned when the caller lacks the role a transaction
+// requires. It reaches gateway clients as a ContractError with code Code,
+// ErrAccessDenied unless set, and a message starting with "access denied:".
+type AccessDeniedError struct {
+	Caller string
+	Code   ErrorCode
+	Reason string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return e.contractError().Error()
+}
+
+func (e *AccessDeniedError) contractError() *ContractError {
+	code := e.Code
+	if code == "" {
+		code = ErrAccessDenied
+	}
+	return newContractError(code, map[string]string{"Caller": e.Caller}, "access denied: %s %s", e.Caller, e.Reason)
+}
+
+// IsAccessDenied reports whether err is or wraps an AccessDeniedError.
+func IsAccessDenied(err error) bool {
+	var accessDenied *AccessDeniedError
+	return errors.As(err, &accessDenied)
+}
+
+// Initialize records the submitting client as the owner of the contract. It
+// is meant to be the init transaction of the chaincode definition and can only
+// succeed once.
+func (a *AdminContract) Initialize(ctx contractapi.TransactionContextInterface) error {
+	owner, err := contractOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if owner != "" {
+		return newContractError(ErrInvalidStatus, nil, "the contract is already initialized")
+	}
+
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	return putContractOwner(ctx, caller)
+}
+
+// WhoAmI returns the submitting client in the form roles are granted to.
+func (q *QueryContract) WhoAmI(ctx contractapi.TransactionContextInterface) (string, error) {
+	return submittingClient(ctx)
+}
+
+// GetContractOwner returns the owner recorded by Initialize.
+func (q *QueryContract) GetContractOwner(ctx contractapi.TransactionContextInterface) (string, error) {
+	owner, err := contractOwner(ctx)
+	if err != nil {
+		return "", err
+	}
+	if owner == "" {
+		return "", errNotInitialized
+	}
+	return owner, nil
+}
+
+// GetAdmins returns the clients granted the admin role, not including the owner.
+func (q *QueryContract) GetAdmins(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	return roleMembers(ctx, contractAdminObjectType)
+}
+
+// AddAdmin grants the admin role to a client. Only the owner can call it.
+func (a *AdminContract) AddAdmin(ctx contractapi.TransactionContextInterface, admin string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+	if admin == "" {
+		return invalidArgument("admin must not be empty")
+	}
+	return grantRole(ctx, contractAdminObjectType, admin)
+}
+
+// RemoveAdmin revokes the admin role from a client. Only the owner can call it.
+func (a *AdminContract) RemoveAdmin(ctx contractapi.TransactionContextInterface, admin string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+
+	isAdmin, err := hasRole(ctx, contractAdminObjectType, admin)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return invalidArgument("%s is not an admin", admin)
+	}
+	return revokeRole(ctx, contractAdminObjectType, admin)
+}
+
+// GetRegulators returns the clients granted the regulator role.
+func (q *QueryContract) GetRegulators(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	return roleMembers(ctx, contractRegulatorObjectType)
+}
+
+// AddRegulator grants the regulator role, which can freeze assets, to a
+// client. Only the owner can call it.
+func (a *AdminContract) AddRegulator(ctx contractapi.TransactionContextInterface, regulator string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+	if regulator == "" {
+		return invalidArgument("regulator must not be empty")
+	}
+	return grantRole(ctx, contractRegulatorObjectType, regulator)
+}
+
+// RemoveRegulator revokes the regulator role from a client. Only the owner can
+// call it.
+func (a *AdminContract) RemoveRegulator(ctx contractapi.TransactionContextInterface, regulator string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+
+	isRegulator, err := hasRole(ctx, contractRegulatorObjectType, regulator)
+	if err != nil {
+		return err
+	}
+	if !isRegulator {
+		return invalidArgument("%s is not a regulator", regulator)
+	}
+	return revokeRole(ctx, contractRegulatorObjectType, regulator)
+}
+
+// TransferOwnership hands the contract to a new owner. Only the current owner
+// can call it, and gives up all rights over the contract by doing so.
+func (a *AdminContract) TransferOwnership(ctx contractapi.TransactionContextInterface, newOwner string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+	if newOwner == "" {
+		return invalidArgument("new owner must not be empty")
+	}
+	return putContractOwner(ctx, newOwner)
+}
+
+// requireAdmin is the guard for admin-only transactions. The contract owner
+// always passes it.
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	caller, owner, err := callerAndOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if caller == owner {
+		return nil
+	}
+
+	isAdmin, err := hasRole(ctx, contractAdminObjectType, caller)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return &AccessDeniedError{Caller: caller, Reason: "is not a contract admin"}
+	}
+	return nil
+}
+
+// requireRegulator is the guard for transactions only regulators may call.
+func requireRegulator(ctx contractapi.TransactionContextInterface) error {
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	isRegulator, err := hasRole(ctx, contractRegulatorObjectType, caller)
+	if err != nil {
+		return err
+	}
+	if !isRegulator {
+		return &AccessDeniedError{Caller: caller, Reason: "is not a regulator"}
+	}
+	return nil
+}
+
+// requireContractOwner is the guard for transactions only the owner may call.
+func requireContractOwner(ctx contractapi.TransactionContextInterface) error {
+	caller, owner, err := callerAndOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if caller != owner {
+		return &AccessDeniedError{Caller: caller, Reason: "is not the contract owner"}
+	}
+	return nil
+}
+
+func callerAndOwner(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	owner, err := contractOwner(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if owner == "" {
+		return "", "", errNotInitialized
+	}
+
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return caller, owner, nil
+}
+
+func hasRole(ctx contractapi.TransactionContextInterface, objectType string, client string) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{client})
+	if err != nil {
+		return false, err
+	}
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, stateReadFailed(err)
+	}
+	return value != nil, nil
+}
+
+func roleMembers(ctx contractapi.TransactionContextInterface, objectType string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	members := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, attributes[0])
+	}
+	return members, nil
+}
+
+func grantRole(ctx contractapi.TransactionContextInterface, objectType string, client string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{client})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte{0x00})
+}
+
+func revokeRole(ctx contractapi.TransactionContextInterface, objectType string, client string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{client})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+func contractOwner(ctx contractapi.TransactionContextInterface) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(contractOwnerObjectType, []string{})
+	if err != nil {
+		return "", err
+	}
+	owner, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", stateReadFailed(err)
+	}
+	return string(owner), nil
+}
+
+func putContractOwner(ctx contractapi.TransactionContextInterface, owner string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(contractOwnerObjectType, []string{})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte(owner))
+}
+
+// submittingClient returns the caller as "<MSP ID>::<client ID>", where the
+// client ID is the decoded cid ID, e.g.
+// "Org1MSP::x509::CN=User1@guolong.com,OU=client::CN=ca.guolong.com".
+func submittingClient(ctx contractapi.TransactionContextInterface) (string, error) {
+	if txCtx, ok := ctx.(baseContext); ok && txCtx.base().caller != "" {
+		return txCtx.base().caller, nil
+	}
+	clientIdentity := ctx.GetClientIdentity()
+	if clientIdentity == nil {
+		return "", fmt.Errorf("failed to get client identity")
+	}
+
+	mspID, err := clientIdentity.GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	b64ID, err := clientIdentity.GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client ID: %v", err)
+	}
+	id, err := base64.StdEncoding.DecodeString(b64ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode client ID: %v", err)
+	}
+	return mspID + "::" + string(id), nil
+}
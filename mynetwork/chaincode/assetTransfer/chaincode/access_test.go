@@ -0,0 +1,95 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewChaincode(t *testing.T) {
+	_, err := contractapi.NewChaincode(&chaincode.AssetContract{}, &chaincode.QueryContract{}, &chaincode.AdminContract{}, &chaincode.TokenContract{}, &chaincode.NFTContract{}, &chaincode.ComplianceContract{})
+	require.NoError(t, err)
+}
+
+func TestInitialize(t *testing.T) {
+	ctx, _ := newTransactionContext(t)
+	assetTransfer := newContracts()
+
+	_, err := assetTransfer.GetContractOwner(ctx)
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the contract is not initialized, call Initialize first")
+
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	caller, err := assetTransfer.WhoAmI(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP::x509::CN=Admin@guolong.com,OU=admin::CN=ca.Org1MSP", caller)
+	owner, err := assetTransfer.GetContractOwner(ctx)
+	require.NoError(t, err)
+	require.Equal(t, caller, owner)
+
+	requireCode(t, ctx.end(assetTransfer.Initialize(ctx)), chaincode.ErrInvalidStatus, "the contract is already initialized")
+
+	// roles are not assets
+	assets, err := assetTransfer.GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Empty(t, assets)
+}
+
+func TestAdminRoles(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	assetTransfer.DevMode = true
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+
+	user := setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	err := ctx.end(assetTransfer.AddAdmin(ctx, user))
+	requireCode(t, err, chaincode.ErrAccessDenied, fmt.Sprintf("access denied: %s is not the contract owner", user))
+	require.True(t, chaincode.IsAccessDenied(err))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.InitLedger(ctx))))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	requireCode(t, ctx.end(assetTransfer.AddAdmin(ctx, "")), chaincode.ErrInvalidArgument, "admin must not be empty")
+	require.NoError(t, ctx.end(assetTransfer.AddAdmin(ctx, user)))
+	admins, err := assetTransfer.GetAdmins(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{user}, admins)
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.InitLedger(ctx)))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.RemoveAdmin(ctx, user))), "admins cannot manage roles")
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.RemoveAdmin(ctx, user)))
+	requireCode(t, ctx.end(assetTransfer.RemoveAdmin(ctx, user)), chaincode.ErrInvalidArgument, fmt.Sprintf("%s is not an admin", user))
+	admins, err = assetTransfer.GetAdmins(ctx)
+	require.NoError(t, err)
+	require.Empty(t, admins)
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.InitLedger(ctx))))
+}
+
+func TestTransferOwnership(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	assetTransfer.DevMode = true
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+
+	newOwner := setCaller(t, ctx, stub, "Org2MSP", "Admin@org2.guolong.com", "admin")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.TransferOwnership(ctx, newOwner))))
+
+	oldOwner := setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	requireCode(t, ctx.end(assetTransfer.TransferOwnership(ctx, "")), chaincode.ErrInvalidArgument, "new owner must not be empty")
+	require.NoError(t, ctx.end(assetTransfer.TransferOwnership(ctx, newOwner)))
+	owner, err := assetTransfer.GetContractOwner(ctx)
+	require.NoError(t, err)
+	require.Equal(t, newOwner, owner)
+
+	err = ctx.end(assetTransfer.InitLedger(ctx))
+	requireCode(t, err, chaincode.ErrAccessDenied, fmt.Sprintf("access denied: %s is not a contract admin", oldOwner))
+
+	setCaller(t, ctx, stub, "Org2MSP", "Admin@org2.guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.InitLedger(ctx)))
+}
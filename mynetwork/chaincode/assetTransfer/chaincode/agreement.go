@@ -0,0 +1,355 @@
+package chaincode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Transient map keys the private inputs are passed under, so that they never
+// appear in the transaction arguments recorded on the ledger.
+const (
+	appraisalTransientKey = "appraisal"
+	priceTransientKey     = "asset_price"
+)
+
+// Price agreements are kept in the implicit collections of the seller's and
+// the buyer's org. The buyer a seller may transfer to is public.
+const (
+	saleObjectType              = "asset~sale"
+	bidObjectType               = "asset~bid"
+	transferAgreementObjectType = "asset~agreement"
+)
+
+var errNoAppraisal = invalidArgument(`the appraisal must be passed in the transient map under key "appraisal"`)
+
+// Appraisal is the private appraisal of an asset, kept in the implicit
+// collection of the owner's org. The public asset only carries its hash.
+// Salt keeps the hash of a small appraised value from being guessed.
+type Appraisal struct {
+	AppraisedValue int    `json:"AppraisedValue"`
+	AssetID        string `json:"AssetID"`
+	Salt           string `json:"Salt"`
+}
+
+// priceAgreement is the price a seller or a buyer agrees to, passed in the
+// transient map as {"asset_id": "asset1", "price": 100, "trade_id": "..."}.
+// Both sides must pass the same trade ID, which also keeps the price from
+// being guessed from its hash.
+type priceAgreement struct {
+	AssetID string `json:"asset_id"`
+	Price   int    `json:"price"`
+	TradeID string `json:"trade_id"`
+}
+
+// AgreeToSell records the price the owner agrees to sell the asset for in the
+// implicit collection of the owner's org. Only the owner or an admin of the
+// owner's org can call it.
+func (a *AssetContract) AgreeToSell(ctx contractapi.TransactionContextInterface, id string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireWhole(asset); err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	return putPriceAgreement(ctx, saleObjectType, id)
+}
+
+// AgreeToBuy records the price the caller agrees to buy the asset for in the
+// implicit collection of the caller's org, and makes the caller the buyer the
+// owner may transfer the asset to.
+func (a *AssetContract) AgreeToBuy(ctx contractapi.TransactionContextInterface, id string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	if caller == asset.Owner {
+		return invalidArgument("%s already owns asset %s", caller, id)
+	}
+
+	if err := putPriceAgreement(ctx, bidObjectType, id); err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(transferAgreementObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte(caller))
+}
+
+// ReadAppraisal returns the appraisal of an asset from the implicit collection
+// of the caller's org. Only peers of that org hold it.
+func (q *QueryContract) ReadAppraisal(ctx contractapi.TransactionContextInterface, id string) (*Appraisal, error) {
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appraisalJSON, err := ctx.GetStub().GetPrivateData(collection, id)
+	if err != nil {
+		return nil, newContractError(ErrStateReadFailed, nil, "failed to read from private data collection %s: %v", collection, err)
+	}
+	if appraisalJSON == nil {
+		return nil, invalidStatus(id, "the appraisal of asset %s is not in collection %s", id, collection)
+	}
+
+	var appraisal Appraisal
+	if err := json.Unmarshal(appraisalJSON, &appraisal); err != nil {
+		return nil, err
+	}
+	return &appraisal, nil
+}
+
+// VerifyAppraisal reports whether the appraisal passed in the transient map,
+// e.g. one a seller shared off chain, is the one the asset was appraised at.
+func (q *QueryContract) VerifyAppraisal(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	asset, err := readAsset(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	appraisal, err := transientAppraisal(ctx)
+	if err != nil {
+		return false, err
+	}
+	if appraisal == nil {
+		return false, errNoAppraisal
+	}
+	appraisal.AssetID = id
+	appraisalJSON, err := json.Marshal(appraisal)
+	if err != nil {
+		return false, err
+	}
+	return appraisalHash(appraisalJSON) == asset.AppraisalHash, nil
+}
+
+// storeAppraisal puts the appraisal of asset in the implicit collection of the
+// caller's org, in place of any earlier one, records its hash on the asset and
+// counts it for the value quota of the owner, which it must not exceed.
+func storeAppraisal(ctx contractapi.TransactionContextInterface, asset *Asset, appraisal *Appraisal) error {
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return err
+	}
+	if err := requireValueQuota(ctx, collection, asset, appraisal.AppraisedValue); err != nil {
+		return err
+	}
+	if err := removeAppraisal(ctx, collection, asset.ID); err != nil {
+		return err
+	}
+
+	appraisal.AssetID = asset.ID
+	appraisalJSON, err := json.Marshal(appraisal)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutPrivateData(collection, asset.ID, appraisalJSON); err != nil {
+		return newContractError(ErrStateWriteFailed, nil, "failed to put to private data collection %s: %v", collection, err)
+	}
+	indexKey, err := valueIndexKey(ctx, appraisal)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutPrivateData(collection, indexKey, []byte{0x00}); err != nil {
+		return newContractError(ErrStateWriteFailed, nil, "failed to put to private data collection %s: %v", collection, err)
+	}
+	asset.AppraisalHash = appraisalHash(appraisalJSON)
+	return countAppraisal(ctx, collection, asset, appraisal)
+}
+
+// removeAppraisal removes the appraisal of an asset and its value index entry
+// from collection, if it is there, and stops counting it for the value quota.
+func removeAppraisal(ctx contractapi.TransactionContextInterface, collection string, id string) error {
+	if err := releaseAppraisal(ctx, collection, id); err != nil {
+		return err
+	}
+	appraisalJSON, err := ctx.GetStub().GetPrivateData(collection, id)
+	if err != nil {
+		return newContractError(ErrStateReadFailed, nil, "failed to read from private data collection %s: %v", collection, err)
+	}
+	if appraisalJSON == nil {
+		return nil
+	}
+
+	var appraisal Appraisal
+	if err := json.Unmarshal(appraisalJSON, &appraisal); err != nil {
+		return err
+	}
+	indexKey, err := valueIndexKey(ctx, &appraisal)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelPrivateData(collection, indexKey); err != nil {
+		return newContractError(ErrStateWriteFailed, nil, "failed to put to private data collection %s: %v", collection, err)
+	}
+	if err := ctx.GetStub().DelPrivateData(collection, id); err != nil {
+		return newContractError(ErrStateWriteFailed, nil, "failed to put to private data collection %s: %v", collection, err)
+	}
+	return nil
+}
+
+// transientAppraisal returns the appraisal passed in the transient map, or nil
+// if there is none.
+func transientAppraisal(ctx contractapi.TransactionContextInterface) (*Appraisal, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transient map: %v", err)
+	}
+	transientJSON, ok := transientMap[appraisalTransientKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var appraisal Appraisal
+	if err := json.Unmarshal(transientJSON, &appraisal); err != nil {
+		return nil, invalidArgument("failed to unmarshal the appraisal: %v", err)
+	}
+	if appraisal.Salt == "" {
+		return nil, invalidArgument("the appraisal must have a salt")
+	}
+	return &appraisal, nil
+}
+
+func appraisalHash(appraisalJSON []byte) string {
+	hash := sha256.Sum256(appraisalJSON)
+	return hex.EncodeToString(hash[:])
+}
+
+func putPriceAgreement(ctx contractapi.TransactionContextInterface, objectType string, id string) error {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient map: %v", err)
+	}
+	transientJSON, ok := transientMap[priceTransientKey]
+	if !ok {
+		return invalidArgument("the price must be passed in the transient map under key %q", priceTransientKey)
+	}
+
+	var agreement priceAgreement
+	if err := json.Unmarshal(transientJSON, &agreement); err != nil {
+		return invalidArgument("failed to unmarshal the price: %v", err)
+	}
+	if agreement.AssetID != id {
+		return invalidArgument("the price is for asset %s, not %s", agreement.AssetID, id)
+	}
+	if agreement.Price <= 0 {
+		return invalidArgument("the price must be positive")
+	}
+	if agreement.TradeID == "" {
+		return invalidArgument("the price must have a trade ID")
+	}
+	// marshal again, so that both sides store the same bytes for the same terms
+	agreementJSON, err := json.Marshal(agreement)
+	if err != nil {
+		return err
+	}
+
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutPrivateData(collection, key, agreementJSON); err != nil {
+		return newContractError(ErrStateWriteFailed, nil, "failed to put to private data collection %s: %v", collection, err)
+	}
+	return nil
+}
+
+// settleAgreement checks that buyer agreed to buy the asset and that the
+// hashes of the seller's and the buyer's price agreements match, then removes
+// the agreements, and the appraisal if the asset leaves the seller's org. The
+// seller is the owner of the asset.
+func settleAgreement(ctx contractapi.TransactionContextInterface, asset *Asset, buyer string) error {
+	id := asset.ID
+	agreementKey, err := ctx.GetStub().CreateCompositeKey(transferAgreementObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	agreedBuyer, err := ctx.GetStub().GetState(agreementKey)
+	if err != nil {
+		return stateReadFailed(err)
+	}
+	if string(agreedBuyer) != buyer {
+		return invalidStatus(id, "%s has not agreed to buy asset %s", buyer, id)
+	}
+
+	sellerCollection, err := ownerCollection(ctx, asset.Owner)
+	if err != nil {
+		return err
+	}
+	buyerMSPID, _ := ownerMSPID(buyer)
+	buyerCollection := implicitCollection(buyerMSPID)
+	saleKey, err := ctx.GetStub().CreateCompositeKey(saleObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+
+	sellerHash, err := ctx.GetStub().GetPrivateDataHash(sellerCollection, saleKey)
+	if err != nil {
+		return newContractError(ErrStateReadFailed, nil, "failed to read the price hash from collection %s: %v", sellerCollection, err)
+	}
+	if sellerHash == nil {
+		return invalidStatus(id, "the seller has not agreed to sell asset %s", id)
+	}
+	buyerHash, err := ctx.GetStub().GetPrivateDataHash(buyerCollection, bidKey)
+	if err != nil {
+		return newContractError(ErrStateReadFailed, nil, "failed to read the price hash from collection %s: %v", buyerCollection, err)
+	}
+	if !bytes.Equal(sellerHash, buyerHash) {
+		return invalidStatus(id, "the prices the seller and the buyer agreed to for asset %s do not match", id)
+	}
+
+	if err := ctx.GetStub().DelPrivateData(sellerCollection, saleKey); err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelPrivateData(buyerCollection, bidKey); err != nil {
+		return err
+	}
+	// the buyer knows the appraisal from VerifyAppraisal and can record it
+	// with UpdateAsset; the seller's org no longer needs it
+	if buyerCollection != sellerCollection {
+		if err := removeAppraisal(ctx, sellerCollection, id); err != nil {
+			return err
+		}
+	}
+	return ctx.GetStub().DelState(agreementKey)
+}
+
+// callerCollection returns the implicit collection of the caller's org.
+func callerCollection(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	return implicitCollection(mspID), nil
+}
+
+// ownerCollection returns the implicit collection of the owner's org. Only the
+// contract owner acts for a legacy owner, so that is the caller's org.
+func ownerCollection(ctx contractapi.TransactionContextInterface, owner string) (string, error) {
+	if mspID, isIdentity := ownerMSPID(owner); isIdentity {
+		return implicitCollection(mspID), nil
+	}
+	return callerCollection(ctx)
+}
+
+func implicitCollection(mspID string) string {
+	return "_implicit_org_" + mspID
+}
@@ -0,0 +1,124 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+	"guolong.com/memstub"
+)
+
+// setPrice passes a price agreement in the transient map of the current
+// transaction, as clients do for AgreeToSell and AgreeToBuy.
+func setPrice(stub *memstub.MemStub, id string, price int, tradeID string) {
+	stub.SetTransient(map[string][]byte{"asset_price": []byte(fmt.Sprintf(`{"asset_id":%q,"price":%d,"trade_id":%q}`, id, price, tradeID))})
+}
+
+// agreeOnPrice has the caller agree to sell id at price and the client
+// commonName in mspID agree to buy it, then makes the seller the caller again.
+func agreeOnPrice(t *testing.T, ctx *testContext, stub *memstub.MemStub, id string, price int, mspID, commonName string, ous ...string) {
+	t.Helper()
+	assetTransfer := newContracts()
+	setPrice(stub, id, price, "trade1")
+	require.NoError(t, ctx.end(assetTransfer.AgreeToSell(ctx, id)))
+
+	seller, err := stub.GetCreator()
+	require.NoError(t, err)
+	setCaller(t, ctx, stub, mspID, commonName, ous...)
+	require.NoError(t, ctx.end(assetTransfer.AgreeToBuy(ctx, id)))
+
+	stub.SetCreator(seller)
+	clientIdentity, err := cid.New(stub)
+	require.NoError(t, err)
+	ctx.SetClientIdentity(clientIdentity)
+	stub.SetTransient(nil)
+}
+
+func TestSecuredSale(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	seller := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+
+	// the public asset only reveals the hash of the appraisal
+	assetJSON, err := stub.GetState("asset1")
+	require.NoError(t, err)
+	require.NotContains(t, string(assetJSON), "AppraisedValue")
+	appraisalJSON, err := stub.GetPrivateData("_implicit_org_Org1MSP", "asset1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"AppraisedValue":300,"AssetID":"asset1","Salt":"salt"}`, string(appraisalJSON))
+
+	// the seller shares the appraisal off chain, and the buyer checks it
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	appraise(stub, 300)
+	verified, err := assetTransfer.VerifyAppraisal(ctx, "asset1")
+	require.NoError(t, err)
+	require.True(t, verified)
+	appraise(stub, 299)
+	verified, err = assetTransfer.VerifyAppraisal(ctx, "asset1")
+	require.NoError(t, err)
+	require.False(t, verified)
+	_, err = assetTransfer.ReadAppraisal(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the appraisal of asset asset1 is not in collection _implicit_org_Org2MSP")
+
+	setPrice(stub, "asset1", 500, "trade1")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.AgreeToSell(ctx, "asset1"))), "only the owner can sell")
+	require.NoError(t, ctx.end(assetTransfer.AgreeToBuy(ctx, "asset1")))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the seller has not agreed to sell asset asset1")
+	setPrice(stub, "asset1", 400, "trade1")
+	require.NoError(t, ctx.end(assetTransfer.AgreeToSell(ctx, "asset1")))
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the prices the seller and the buyer agreed to for asset asset1 do not match")
+	requireCode(t, ctx.end(assetTransfer.AgreeToBuy(ctx, "asset1")), chaincode.ErrInvalidArgument, seller+" already owns asset asset1")
+
+	// the price agreed to by either side never reaches the public state
+	for _, key := range stub.Keys() {
+		value, err := stub.GetState(key)
+		require.NoError(t, err)
+		require.NotContains(t, string(value), "trade1")
+	}
+
+	setPrice(stub, "asset1", 500, "trade1")
+	require.NoError(t, ctx.end(assetTransfer.AgreeToSell(ctx, "asset1")))
+	oldOwner, err := assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, seller, oldOwner)
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, buyer, asset.Owner)
+	require.Equal(t, appraisalHash("asset1", 300, "salt"), asset.AppraisalHash)
+
+	// the agreements are used up
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", seller, "Seller")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidStatus, seller+" has not agreed to buy asset asset1")
+}
+
+func TestPriceAgreementInput(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+
+	stub.SetTransient(nil)
+	requireCode(t, ctx.end(assetTransfer.AgreeToSell(ctx, "asset1")), chaincode.ErrInvalidArgument, `the price must be passed in the transient map under key "asset_price"`)
+	setPrice(stub, "asset2", 500, "trade1")
+	requireCode(t, ctx.end(assetTransfer.AgreeToSell(ctx, "asset1")), chaincode.ErrInvalidArgument, "the price is for asset asset2, not asset1")
+	setPrice(stub, "asset1", 0, "trade1")
+	requireCode(t, ctx.end(assetTransfer.AgreeToSell(ctx, "asset1")), chaincode.ErrInvalidArgument, "the price must be positive")
+	setPrice(stub, "asset1", 500, "")
+	requireCode(t, ctx.end(assetTransfer.AgreeToSell(ctx, "asset1")), chaincode.ErrInvalidArgument, "the price must have a trade ID")
+	setPrice(stub, "asset1", 500, "trade1")
+	requireCode(t, ctx.end(assetTransfer.AgreeToSell(ctx, "asset2")), chaincode.ErrAssetNotFound, "the asset asset2 does not exist")
+}
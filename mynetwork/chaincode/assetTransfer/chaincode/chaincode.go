@@ -0,0 +1,30 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// contract is a contract that embeds Contract.
+type contract interface {
+	contractapi.ContractInterface
+	shared() *Contract
+}
+
+// NewChaincode creates the chaincode of contracts, see contractapi.NewChaincode.
+// The contracts that embed Contract run with a TransactionContext and the
+// hooks that validate and log each call. Calls that name no contract go to the
+// asset contract.
+func NewChaincode(contracts ...contractapi.ContractInterface) (*contractapi.ContractChaincode, error) {
+	for _, c := range contracts {
+		if c, ok := c.(contract); ok {
+			c.shared().useHooks(newHooks(c, c.shared().Logger, keyArguments[c.GetName()]))
+		}
+	}
+
+	contractChaincode, err := contractapi.NewChaincode(contracts...)
+	if err != nil {
+		return nil, err
+	}
+	contractChaincode.DefaultContract = (&AssetContract{}).GetName()
+	return contractChaincode, nil
+}
@@ -0,0 +1,410 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// The compliance MSP is set by the contract owner. Verifications are kept by
+// client identity, and the transfer restriction of an asset under the asset.
+const (
+	complianceMSPObjectType = "compliance~msp"
+	verificationObjectType  = "compliance~verification"
+	restrictionObjectType   = "asset~restriction"
+)
+
+const (
+	identityVerifiedEvent    = "IdentityVerified"
+	verificationRevokedEvent = "VerificationRevoked"
+)
+
+// jurisdictionRule is the rule for jurisdiction tags, ISO 3166 country codes
+// with an optional subdivision, e.g. "CN" or "US-CA".
+var jurisdictionRule = compileRules(FieldRule{Field: "Jurisdiction", Type: "string", Required: true, Pattern: `[A-Z]{2}(-[A-Z0-9]{1,3})?`})[0]
+
+// ComplianceContract is a registry of verified client identities, kept by
+// clients of the compliance MSP, and of the transfer restrictions of regulated
+// assets. A regulated asset, or shares of it, only go to identities whose
+// verification has not expired and that follow its restriction; every
+// transaction that changes the owner checks that.
+type ComplianceContract struct {
+	Contract
+}
+
+// Verification records that Identity passed KYC checks, in Jurisdiction, until
+// ExpiresAt. VerifiedBy is the client of the compliance MSP who verified it,
+// at VerifiedAt. The times are RFC 3339.
+type Verification struct {
+	ExpiresAt    string `json:"ExpiresAt"`
+	Identity     string `json:"Identity"`
+	Jurisdiction string `json:"Jurisdiction"`
+	VerifiedAt   string `json:"VerifiedAt"`
+	VerifiedBy   string `json:"VerifiedBy"`
+}
+
+// TransferRestriction makes an asset regulated. It only goes to verified
+// identities, of AllowedJurisdictions if not empty, and its shares to at most
+// MaxHolders holders if that is not 0.
+type TransferRestriction struct {
+	AllowedJurisdictions []string `json:"AllowedJurisdictions"`
+	AssetID              string   `json:"AssetID"`
+	MaxHolders           int      `json:"MaxHolders"`
+}
+
+// GetName returns the name the registry transactions are called under, e.g.
+// compliance:VerifyIdentity.
+func (c *ComplianceContract) GetName() string {
+	return "compliance"
+}
+
+// SetComplianceMSP sets the MSP whose clients keep the registry. Only the
+// contract owner can call it.
+func (c *ComplianceContract) SetComplianceMSP(ctx contractapi.TransactionContextInterface, mspID string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+	if mspID == "" {
+		return invalidArgument("compliance MSP ID must not be empty")
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(complianceMSPObjectType, []string{})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte(mspID))
+}
+
+// GetComplianceMSP returns the MSP whose clients keep the registry.
+func (c *ComplianceContract) GetComplianceMSP(ctx contractapi.TransactionContextInterface) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(complianceMSPObjectType, []string{})
+	if err != nil {
+		return "", err
+	}
+	mspID, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", stateReadFailed(err)
+	}
+	if mspID == nil {
+		return "", newContractError(ErrInvalidStatus, nil, "the compliance MSP is not set, call SetComplianceMSP first")
+	}
+	return string(mspID), nil
+}
+
+// VerifyIdentity records that identity, a client identity as returned by
+// WhoAmI, is verified in jurisdiction until expiresAt, an RFC 3339 time,
+// replacing an earlier verification. Only clients of the compliance MSP can
+// call it.
+func (c *ComplianceContract) VerifyIdentity(ctx contractapi.TransactionContextInterface, identity string, jurisdiction string, expiresAt string) error {
+	officer, err := c.requireCompliance(ctx)
+	if err != nil {
+		return err
+	}
+	if _, isIdentity := ownerMSPID(identity); !isIdentity {
+		return invalidArgument("%s is not a client identity", identity)
+	}
+	if problem := jurisdictionRule.check(jurisdiction); problem != "" {
+		return invalidArgument("jurisdiction %q %s", jurisdiction, problem)
+	}
+	expiry, err := parseDeadline(ctx, "expiry", expiresAt)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	verification := &Verification{
+		ExpiresAt:    expiry.UTC().Format(time.RFC3339),
+		Identity:     identity,
+		Jurisdiction: jurisdiction,
+		VerifiedAt:   now.UTC().Format(time.RFC3339),
+		VerifiedBy:   officer,
+	}
+	verificationJSON, err := json.Marshal(verification)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(verificationObjectType, []string{identity})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, verificationJSON); err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(identityVerifiedEvent, verificationJSON)
+}
+
+// RevokeVerification removes the verification of identity before it expires.
+// Only clients of the compliance MSP can call it.
+func (c *ComplianceContract) RevokeVerification(ctx contractapi.TransactionContextInterface, identity string) error {
+	if _, err := c.requireCompliance(ctx); err != nil {
+		return err
+	}
+	verification, err := c.GetVerification(ctx, identity)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(verificationObjectType, []string{identity})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return err
+	}
+	verificationJSON, err := json.Marshal(verification)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(verificationRevokedEvent, verificationJSON)
+}
+
+// GetVerification returns the verification of identity, which may have
+// expired.
+func (c *ComplianceContract) GetVerification(ctx contractapi.TransactionContextInterface, identity string) (*Verification, error) {
+	verification, err := readVerification(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if verification == nil {
+		return nil, invalidArgument("%s is not verified", identity)
+	}
+	return verification, nil
+}
+
+// SetTransferRestriction makes an asset regulated, so that it only goes to
+// verified identities of allowedJurisdictions, or of any jurisdiction if that
+// is empty, and its shares to at most maxHolders holders, or any number if it
+// is 0. It replaces an earlier restriction. Only clients of the compliance MSP
+// can call it.
+func (c *ComplianceContract) SetTransferRestriction(ctx contractapi.TransactionContextInterface, assetID string, allowedJurisdictions []string, maxHolders int) error {
+	if _, err := c.requireCompliance(ctx); err != nil {
+		return err
+	}
+	if _, err := readAsset(ctx, assetID); err != nil {
+		return err
+	}
+	for _, jurisdiction := range allowedJurisdictions {
+		if problem := jurisdictionRule.check(jurisdiction); problem != "" {
+			return invalidArgument("jurisdiction %q %s", jurisdiction, problem)
+		}
+	}
+	if maxHolders < 0 {
+		return invalidArgument("the maximum number of holders must not be negative")
+	}
+	if allowedJurisdictions == nil {
+		allowedJurisdictions = []string{}
+	}
+	return putRestriction(ctx, &TransferRestriction{AllowedJurisdictions: allowedJurisdictions, AssetID: assetID, MaxHolders: maxHolders})
+}
+
+// RemoveTransferRestriction makes an asset unregulated again. Only clients of
+// the compliance MSP can call it.
+func (c *ComplianceContract) RemoveTransferRestriction(ctx contractapi.TransactionContextInterface, assetID string) error {
+	if _, err := c.requireCompliance(ctx); err != nil {
+		return err
+	}
+	if _, err := c.GetTransferRestriction(ctx, assetID); err != nil {
+		return err
+	}
+	return deleteRestriction(ctx, assetID)
+}
+
+// GetTransferRestriction returns the transfer restriction of a regulated
+// asset.
+func (c *ComplianceContract) GetTransferRestriction(ctx contractapi.TransactionContextInterface, assetID string) (*TransferRestriction, error) {
+	restriction, err := readRestriction(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if restriction == nil {
+		return nil, invalidStatus(assetID, "the asset %s has no transfer restriction", assetID)
+	}
+	return restriction, nil
+}
+
+func (c *ComplianceContract) requireCompliance(ctx contractapi.TransactionContextInterface) (string, error) {
+	compliance, err := c.GetComplianceMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	if mspID, _ := ownerMSPID(caller); mspID != compliance {
+		return "", &AccessDeniedError{Caller: caller, Reason: "is not a client of the compliance MSP " + compliance}
+	}
+	return caller, nil
+}
+
+// requireTransferAllowed returns why recipient may not become the owner of an
+// asset, or nil if the asset is not regulated.
+func requireTransferAllowed(ctx contractapi.TransactionContextInterface, assetID string, recipient string) error {
+	restriction, err := readRestriction(ctx, assetID)
+	if err != nil || restriction == nil {
+		return err
+	}
+	return restriction.allow(ctx, recipient, 1)
+}
+
+// requireSharesAllowed is requireTransferAllowed for shares of an asset.
+// newHolder is whether recipient holds none yet, and leaving whether the
+// sender gives up all theirs.
+func requireSharesAllowed(ctx contractapi.TransactionContextInterface, assetID string, recipient string, newHolder bool, leaving bool) error {
+	restriction, err := readRestriction(ctx, assetID)
+	if err != nil || restriction == nil {
+		return err
+	}
+	holders := 0
+	if restriction.MaxHolders > 0 {
+		holdings, err := (&QueryContract{}).GetShareholders(ctx, assetID)
+		if err != nil {
+			return err
+		}
+		holders = len(holdings)
+		if newHolder {
+			holders++
+		}
+		if leaving {
+			holders--
+		}
+	}
+	return restriction.allow(ctx, recipient, holders)
+}
+
+// allow returns why recipient may not receive the asset of the restriction,
+// or shares of it that leave it with holders holders, as a
+// TRANSFER_RESTRICTED error.
+func (r *TransferRestriction) allow(ctx contractapi.TransactionContextInterface, recipient string, holders int) error {
+	reject := func(format string, args ...interface{}) error {
+		reason := fmt.Sprintf(format, args...)
+		details := map[string]string{"AssetID": r.AssetID, "Recipient": recipient, "Reason": reason}
+		return newContractError(ErrTransferRestricted, details, "the transfer of asset %s to %s is restricted: %s", r.AssetID, recipient, reason)
+	}
+
+	verification, err := readVerification(ctx, recipient)
+	if err != nil {
+		return err
+	}
+	if verification == nil {
+		return reject("%s is not verified", recipient)
+	}
+	expiry, err := time.Parse(time.RFC3339, verification.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.Before(expiry) {
+		return reject("the verification of %s expired at %s", recipient, verification.ExpiresAt)
+	}
+	if len(r.AllowedJurisdictions) > 0 && !slices.Contains(r.AllowedJurisdictions, verification.Jurisdiction) {
+		return reject("jurisdiction %s is not one of %s", verification.Jurisdiction, strings.Join(r.AllowedJurisdictions, ", "))
+	}
+	if r.MaxHolders > 0 && holders > r.MaxHolders {
+		return reject("the asset can have at most %d holders", r.MaxHolders)
+	}
+	return nil
+}
+
+// inheritRestriction gives the assets split or merged from parentIDs their
+// transfer restriction. Assets with different restrictions cannot be merged;
+// all of them are read before any child is written, since a transaction does
+// not read its own writes.
+func inheritRestriction(ctx contractapi.TransactionContextInterface, parentIDs []string, childIDs []string) error {
+	var restriction *TransferRestriction
+	for _, parentID := range parentIDs {
+		parentRestriction, err := readRestriction(ctx, parentID)
+		if err != nil {
+			return err
+		}
+		if parentRestriction == nil {
+			continue
+		}
+		if restriction != nil && !(slices.Equal(restriction.AllowedJurisdictions, parentRestriction.AllowedJurisdictions) && restriction.MaxHolders == parentRestriction.MaxHolders) {
+			return invalidStatus(parentID, "the asset %s has a different transfer restriction than the assets it comes from", parentID)
+		}
+		restriction = parentRestriction
+	}
+	if restriction == nil {
+		return nil
+	}
+	for _, childID := range childIDs {
+		inherited := *restriction
+		inherited.AssetID = childID
+		if err := putRestriction(ctx, &inherited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readVerification(ctx contractapi.TransactionContextInterface, identity string) (*Verification, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(verificationObjectType, []string{identity})
+	if err != nil {
+		return nil, err
+	}
+	verificationJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if verificationJSON == nil {
+		return nil, nil
+	}
+
+	var verification Verification
+	if err := json.Unmarshal(verificationJSON, &verification); err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+func readRestriction(ctx contractapi.TransactionContextInterface, assetID string) (*TransferRestriction, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(restrictionObjectType, []string{assetID})
+	if err != nil {
+		return nil, err
+	}
+	restrictionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if restrictionJSON == nil {
+		return nil, nil
+	}
+
+	var restriction TransferRestriction
+	if err := json.Unmarshal(restrictionJSON, &restriction); err != nil {
+		return nil, err
+	}
+	return &restriction, nil
+}
+
+func putRestriction(ctx contractapi.TransactionContextInterface, restriction *TransferRestriction) error {
+	key, err := ctx.GetStub().CreateCompositeKey(restrictionObjectType, []string{restriction.AssetID})
+	if err != nil {
+		return err
+	}
+	restrictionJSON, err := json.Marshal(restriction)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, restrictionJSON)
+}
+
+func deleteRestriction(ctx contractapi.TransactionContextInterface, assetID string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(restrictionObjectType, []string{assetID})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return stateWriteFailed(err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+	"guolong.com/memstub"
+)
+
+// verify has the compliance officer verify identity in jurisdiction until
+// June 2024, and switches back to the caller.
+func verify(t *testing.T, ctx *testContext, stub *memstub.MemStub, identity string, jurisdiction string) {
+	t.Helper()
+	caller, err := stub.GetCreator()
+	require.NoError(t, err)
+	setCaller(t, ctx, stub, "ComplianceMSP", "Officer@compliance.guolong.com", "client")
+	require.NoError(t, ctx.end((&chaincode.ComplianceContract{}).VerifyIdentity(ctx, identity, jurisdiction, "2024-06-01T00:00:00Z")))
+
+	stub.SetCreator(caller)
+	clientIdentity, err := cid.New(stub)
+	require.NoError(t, err)
+	ctx.SetClientIdentity(clientIdentity)
+}
+
+// requireRestricted asserts that err rejects a transfer for reason.
+func requireRestricted(t *testing.T, err error, reason string) {
+	t.Helper()
+	contractError, ok := chaincode.AsContractError(err)
+	require.True(t, ok, "%v", err)
+	require.Equal(t, chaincode.ErrTransferRestricted, contractError.Code)
+	require.Equal(t, reason, contractError.Details["Reason"])
+}
+
+func TestComplianceRegistry(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	compliance := chaincode.ComplianceContract{}
+	require.NoError(t, ctx.end(newContracts().Initialize(ctx)))
+	user := setCaller(t, ctx, stub, "Org2MSP", "User1@org2.guolong.com", "client")
+	requireCode(t, ctx.end(compliance.VerifyIdentity(ctx, user, "CN", "2024-06-01T00:00:00Z")), chaincode.ErrInvalidStatus, "the compliance MSP is not set, call SetComplianceMSP first")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(compliance.SetComplianceMSP(ctx, "Org2MSP"))), "only the contract owner sets the compliance MSP")
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(compliance.SetComplianceMSP(ctx, "ComplianceMSP")))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(compliance.VerifyIdentity(ctx, user, "CN", "2024-06-01T00:00:00Z"))))
+
+	officer := setCaller(t, ctx, stub, "ComplianceMSP", "Officer@compliance.guolong.com", "client")
+	requireCode(t, ctx.end(compliance.VerifyIdentity(ctx, "User1", "CN", "2024-06-01T00:00:00Z")), chaincode.ErrInvalidArgument, "User1 is not a client identity")
+	requireCode(t, ctx.end(compliance.VerifyIdentity(ctx, user, "china", "2024-06-01T00:00:00Z")), chaincode.ErrInvalidArgument, `jurisdiction "china" must match [A-Z]{2}(-[A-Z0-9]{1,3})?`)
+	requireCode(t, ctx.end(compliance.VerifyIdentity(ctx, user, "CN", "2023-06-01T00:00:00Z")), chaincode.ErrInvalidArgument, "the expiry 2023-06-01T00:00:00Z is not after the transaction time 2024-01-01T00:00:01Z")
+
+	require.NoError(t, ctx.end(compliance.VerifyIdentity(ctx, user, "CN-BJ", "2024-06-01T08:00:00+08:00")))
+	require.Equal(t, "IdentityVerified", stub.Event().EventName)
+	verification, err := compliance.GetVerification(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Verification{ExpiresAt: "2024-06-01T00:00:00Z", Identity: user, Jurisdiction: "CN-BJ", VerifiedAt: "2024-01-01T00:00:01Z", VerifiedBy: officer}, verification)
+
+	require.NoError(t, ctx.end(compliance.RevokeVerification(ctx, user)))
+	require.Equal(t, "VerificationRevoked", stub.Event().EventName)
+	_, err = compliance.GetVerification(ctx, user)
+	requireCode(t, err, chaincode.ErrInvalidArgument, user+" is not verified")
+	requireCode(t, ctx.end(compliance.RevokeVerification(ctx, user)), chaincode.ErrInvalidArgument, user+" is not verified")
+
+	// the registry is not mistaken for assets
+	assets, err := newContracts().GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Empty(t, assets)
+}
+
+func TestTransferRestrictions(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	compliance := chaincode.ComplianceContract{}
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	require.NoError(t, ctx.end(compliance.SetComplianceMSP(ctx, "ComplianceMSP")))
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	seller := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+
+	setCaller(t, ctx, stub, "ComplianceMSP", "Officer@compliance.guolong.com", "client")
+	requireCode(t, ctx.end(compliance.SetTransferRestriction(ctx, "asset2", nil, 0)), chaincode.ErrAssetNotFound, "the asset asset2 does not exist")
+	requireCode(t, ctx.end(compliance.SetTransferRestriction(ctx, "asset1", []string{"cn"}, 0)), chaincode.ErrInvalidArgument, `jurisdiction "cn" must match [A-Z]{2}(-[A-Z0-9]{1,3})?`)
+	require.NoError(t, ctx.end(compliance.SetTransferRestriction(ctx, "asset1", []string{"CN", "SG"}, 0)))
+	restriction, err := compliance.GetTransferRestriction(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.TransferRestriction{AllowedJurisdictions: []string{"CN", "SG"}, AssetID: "asset1"}, restriction)
+
+	// the recipient must be verified, in an allowed jurisdiction, until after
+	// the transfer
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	agreeOnPrice(t, ctx, stub, "asset1", 500, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	requireRestricted(t, err, buyer+" is not verified")
+	require.Contains(t, err.Error(), "the transfer of asset asset1 to "+buyer+" is restricted")
+
+	verify(t, ctx, stub, buyer, "US")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	requireRestricted(t, err, "jurisdiction US is not one of CN, SG")
+
+	verify(t, ctx, stub, buyer, "SG")
+	stub.SetTxTimestamp(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC))
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	requireRestricted(t, err, "the verification of "+buyer+" expired at 2024-06-01T00:00:00Z")
+
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC))
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	require.NoError(t, err)
+
+	// other ways of changing the owner are checked too
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	err = ctx.end((&chaincode.NFTContract{}).TransferFrom(ctx, buyer, seller, "asset1"))
+	requireRestricted(t, err, seller+" is not verified")
+	require.NoError(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", seller, "2024-02-01T00:00:00Z")))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	requireRestricted(t, ctx.end(assetTransfer.AcceptTransfer(ctx, "asset1", "Seller")), seller+" is not verified")
+	verify(t, ctx, stub, seller, "CN")
+	require.NoError(t, ctx.end(assetTransfer.AcceptTransfer(ctx, "asset1", "Seller")))
+
+	// the restriction goes to the assets an asset is split into
+	setCaller(t, ctx, stub, "ComplianceMSP", "Officer@compliance.guolong.com", "client")
+	require.NoError(t, ctx.end(compliance.RemoveTransferRestriction(ctx, "asset1")))
+	_, err = compliance.GetTransferRestriction(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 has no transfer restriction")
+	require.NoError(t, ctx.end(compliance.SetTransferRestriction(ctx, "asset1", []string{"CN"}, 0)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	require.NoError(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset1", []int{2, 3})))
+	restriction, err = compliance.GetTransferRestriction(ctx, "asset1.1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.TransferRestriction{AllowedJurisdictions: []string{"CN"}, AssetID: "asset1.1"}, restriction)
+	agreeOnPrice(t, ctx, stub, "asset1.1", 200, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1.1", buyer, "Buyer")
+	ctx.end(err)
+	requireRestricted(t, err, "jurisdiction SG is not one of CN")
+
+	require.NoError(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset1.2")))
+	_, err = compliance.GetTransferRestriction(ctx, "asset1.2")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1.2 has no transfer restriction")
+}
+
+func TestMergeRestrictedAssets(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	compliance := chaincode.ComplianceContract{}
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	require.NoError(t, ctx.end(compliance.SetComplianceMSP(ctx, "ComplianceMSP")))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	for _, id := range []string{"asset1", "asset2", "asset3", "asset4"} {
+		appraise(stub, 300)
+		require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, id, "blue", 5, "Seller")))
+	}
+	setCaller(t, ctx, stub, "ComplianceMSP", "Officer@compliance.guolong.com", "client")
+	require.NoError(t, ctx.end(compliance.SetTransferRestriction(ctx, "asset1", []string{"CN"}, 0)))
+	require.NoError(t, ctx.end(compliance.SetTransferRestriction(ctx, "asset2", []string{"CN"}, 0)))
+	require.NoError(t, ctx.end(compliance.SetTransferRestriction(ctx, "asset3", []string{"SG"}, 0)))
+
+	// every parent is checked before the merged asset gets a restriction
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset4", "asset3"}, "asset5")), chaincode.ErrInvalidStatus, "the asset asset3 has a different transfer restriction than the assets it comes from")
+	_, err := compliance.GetTransferRestriction(ctx, "asset5")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset5 has no transfer restriction")
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+
+	require.NoError(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset4", "asset2"}, "asset5")))
+	restriction, err := compliance.GetTransferRestriction(ctx, "asset5")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.TransferRestriction{AllowedJurisdictions: []string{"CN"}, AssetID: "asset5"}, restriction)
+}
+
+func TestShareholderLimit(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	compliance := chaincode.ComplianceContract{}
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	require.NoError(t, ctx.end(compliance.SetComplianceMSP(ctx, "ComplianceMSP")))
+	second := setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	third := setCaller(t, ctx, stub, "Org3MSP", "Investor@org3.guolong.com", "client")
+	first := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	require.NoError(t, ctx.end(assetTransfer.FractionalizeAsset(ctx, "asset1", 100, 60)))
+
+	setCaller(t, ctx, stub, "ComplianceMSP", "Officer@compliance.guolong.com", "client")
+	require.NoError(t, ctx.end(compliance.SetTransferRestriction(ctx, "asset1", nil, 2)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	requireRestricted(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", second, 30)), second+" is not verified")
+	verify(t, ctx, stub, second, "CN")
+	verify(t, ctx, stub, third, "SG")
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", second, 30)))
+	requireRestricted(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", third, 30)), "the asset can have at most 2 holders")
+
+	// a holder who sells out makes room
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", second, 40)))
+	verify(t, ctx, stub, first, "CN")
+	setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", first, 70)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", third, 100)))
+	holders, err := assetTransfer.GetShareholders(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Shareholding{{Holder: third, Shares: 100}}, holders)
+}
@@ -0,0 +1,218 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// A document is kept under the asset it is attached to, by its hash, so it
+// stays with the asset when the asset changes owner.
+const documentObjectType = "asset~document"
+
+const (
+	documentAttachedEvent = "DocumentAttached"
+	documentRemovedEvent  = "DocumentRemoved"
+)
+
+// documentRules are the rules for the arguments of AttachDocument.
+var documentRules = compileRules(
+	FieldRule{Field: "Hash", Type: "string", Required: true, Pattern: `[0-9a-f]{64}`},
+	FieldRule{Field: "Type", Type: "string", Required: true, Pattern: `[a-z]+(-[a-z]+)*`, MaxLength: 32},
+	FieldRule{Field: "URI", Type: "string", Required: true, Pattern: `[a-z][a-z0-9+.-]*:\S+`, MaxLength: 1024},
+)
+
+// AttachDocument attaches a document kept off chain, such as a certificate, an
+// invoice or an inspection report, to an asset. docHash is the hex SHA-256
+// hash of its content, docType what kind of document it is, e.g.
+// "certificate", and uri where it can be fetched from. A document can only be
+// attached once. Only the owner can call it, not admins of the owner's org,
+// and not while the asset is frozen or retired.
+func (a *AssetContract) AttachDocument(ctx contractapi.TransactionContextInterface, assetID string, docHash string, docType string, uri string) error {
+	asset, err := a.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	if caller != asset.Owner {
+		return &AccessDeniedError{Caller: caller, Code: ErrNotOwner, Reason: fmt.Sprintf("is not the owner of asset %s", asset.ID)}
+	}
+	if err := requireStatus(asset, StatusActive, StatusLocked); err != nil {
+		return err
+	}
+
+	docHash = strings.ToLower(docHash)
+	values := map[string]string{"Hash": docHash, "Type": docType, "URI": uri}
+	details := map[string]string{}
+	var problems []string
+	for _, rule := range documentRules {
+		if problem := rule.check(values[rule.Field]); problem != "" {
+			details[rule.Field] = problem
+			problems = append(problems, rule.Field+" "+problem)
+		}
+	}
+	if len(problems) > 0 {
+		return newContractError(ErrInvalidArgument, details, "invalid document: %s", strings.Join(problems, "; "))
+	}
+
+	existing, err := readDocument(ctx, assetID, docHash)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return invalidArgument("document %s is already attached to asset %s", docHash, assetID)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	document := &Attachment{
+		AssetID:    assetID,
+		AttachedAt: now.UTC().Format(time.RFC3339),
+		AttachedBy: caller,
+		Hash:       docHash,
+		Type:       docType,
+		URI:        uri,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(documentObjectType, []string{assetID, docHash})
+	if err != nil {
+		return err
+	}
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, documentJSON); err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(documentAttachedEvent, documentJSON)
+}
+
+// ListDocuments returns the documents attached to an asset, in order of their
+// hashes.
+func (q *QueryContract) ListDocuments(ctx contractapi.TransactionContextInterface, assetID string) ([]*Attachment, error) {
+	if _, err := readAsset(ctx, assetID); err != nil {
+		return nil, err
+	}
+	return assetDocuments(ctx, assetID)
+}
+
+// RemoveDocument detaches a document from an asset. Only the owner or an admin
+// of the owner's org can call it, and not while the asset is frozen or
+// retired.
+func (a *AssetContract) RemoveDocument(ctx contractapi.TransactionContextInterface, assetID string, docHash string) error {
+	asset, err := a.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if err := requireStatus(asset, StatusActive, StatusLocked); err != nil {
+		return err
+	}
+	docHash = strings.ToLower(docHash)
+	document, err := readDocument(ctx, assetID, docHash)
+	if err != nil {
+		return err
+	}
+	if document == nil {
+		return invalidArgument("asset %s has no document %s", assetID, docHash)
+	}
+
+	if err := deleteDocument(ctx, document); err != nil {
+		return err
+	}
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(documentRemovedEvent, documentJSON)
+}
+
+// ReadAssetWithDocuments is ReadAsset with the documents attached to the asset
+// in Attachments.
+func (q *QueryContract) ReadAssetWithDocuments(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
+	asset, err := readAsset(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Attachments, err = assetDocuments(ctx, id); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// deleteDocuments removes the documents attached to an asset that is deleted.
+func deleteDocuments(ctx contractapi.TransactionContextInterface, assetID string) error {
+	documents, err := assetDocuments(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	for _, document := range documents {
+		if err := deleteDocument(ctx, document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func assetDocuments(ctx contractapi.TransactionContextInterface, assetID string) ([]*Attachment, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(documentObjectType, []string{assetID})
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	defer resultsIterator.Close()
+
+	documents := []*Attachment{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var document Attachment
+		if err := json.Unmarshal(queryResponse.Value, &document); err != nil {
+			return nil, err
+		}
+		documents = append(documents, &document)
+	}
+	return documents, nil
+}
+
+func readDocument(ctx contractapi.TransactionContextInterface, assetID string, docHash string) (*Attachment, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(documentObjectType, []string{assetID, docHash})
+	if err != nil {
+		return nil, err
+	}
+	documentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if documentJSON == nil {
+		return nil, nil
+	}
+
+	var document Attachment
+	if err := json.Unmarshal(documentJSON, &document); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+func deleteDocument(ctx contractapi.TransactionContextInterface, document *Attachment) error {
+	key, err := ctx.GetStub().CreateCompositeKey(documentObjectType, []string{document.AssetID, document.Hash})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return stateWriteFailed(err)
+	}
+	return nil
+}
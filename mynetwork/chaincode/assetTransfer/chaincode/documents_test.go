@@ -0,0 +1,83 @@
+package chaincode_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocuments(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	certificate := strings.Repeat("ab", 32)
+	invoice := strings.Repeat("0c", 32)
+
+	err := ctx.end(assetTransfer.AttachDocument(ctx, "asset1", "abc", "Certificate", ""))
+	contractError, ok := chaincode.AsContractError(err)
+	require.True(t, ok)
+	require.Equal(t, chaincode.ErrInvalidArgument, contractError.Code)
+	require.Equal(t, map[string]string{
+		"Hash": "must match [0-9a-f]{64}",
+		"Type": "must match [a-z]+(-[a-z]+)*",
+		"URI":  "is required",
+	}, contractError.Details)
+	requireCode(t, ctx.end(assetTransfer.AttachDocument(ctx, "asset2", certificate, "certificate", "ipfs://cert")), chaincode.ErrAssetNotFound, "the asset asset2 does not exist")
+
+	require.NoError(t, ctx.end(assetTransfer.AttachDocument(ctx, "asset1", strings.ToUpper(certificate), "certificate", "ipfs://cert")))
+	require.Equal(t, "DocumentAttached", stub.Event().EventName)
+	requireCode(t, ctx.end(assetTransfer.AttachDocument(ctx, "asset1", certificate, "certificate", "ipfs://cert2")), chaincode.ErrInvalidArgument, "document "+certificate+" is already attached to asset asset1")
+	require.NoError(t, ctx.end(assetTransfer.AttachDocument(ctx, "asset1", invoice, "invoice", "https://example.com/invoice.pdf")))
+
+	documents, err := assetTransfer.ListDocuments(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Attachment{
+		{AssetID: "asset1", AttachedAt: "2024-01-01T00:00:01Z", AttachedBy: owner, Hash: invoice, Type: "invoice", URI: "https://example.com/invoice.pdf"},
+		{AssetID: "asset1", AttachedAt: "2024-01-01T00:00:01Z", AttachedBy: owner, Hash: certificate, Type: "certificate", URI: "ipfs://cert"},
+	}, documents)
+
+	// the summary is only in the asset when asked for, and never stored
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Nil(t, asset.Attachments)
+	asset, err = assetTransfer.ReadAssetWithDocuments(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, documents, asset.Attachments)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller")))
+	assetJSON, err := stub.GetState("asset1")
+	require.NoError(t, err)
+	require.NotContains(t, string(assetJSON), "Attachments")
+
+	// only the owner attaches and removes documents, which go with the asset
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.AttachDocument(ctx, "asset1", strings.Repeat("1", 64), "report", "ipfs://report"))))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.RemoveDocument(ctx, "asset1", invoice))))
+	admin := setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	requireCode(t, ctx.end(assetTransfer.AttachDocument(ctx, "asset1", strings.Repeat("1", 64), "report", "ipfs://report")), chaincode.ErrNotOwner, "access denied: "+admin+" is not the owner of asset asset1")
+
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	agreeOnPrice(t, ctx, stub, "asset1", 500, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.RemoveDocument(ctx, "asset1", invoice))))
+
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	documents, err = assetTransfer.ListDocuments(ctx, "asset1")
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+	require.NoError(t, ctx.end(assetTransfer.RemoveDocument(ctx, "asset1", invoice)))
+	require.Equal(t, "DocumentRemoved", stub.Event().EventName)
+	requireCode(t, ctx.end(assetTransfer.RemoveDocument(ctx, "asset1", invoice)), chaincode.ErrInvalidArgument, "asset asset1 has no document "+invoice)
+
+	// the documents are deleted with the asset
+	require.NoError(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset1")))
+	_, err = assetTransfer.ListDocuments(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrAssetNotFound, "the asset asset1 does not exist")
+	require.Empty(t, stub.Keys())
+}
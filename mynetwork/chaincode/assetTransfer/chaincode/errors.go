@@ -0,0 +1,93 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is the stable code of a ContractError, for clients to branch on
+// instead of the message.
+type ErrorCode string
+
+const (
+	ErrAssetNotFound    ErrorCode = "ASSET_NOT_FOUND"
+	ErrAssetExists      ErrorCode = "ASSET_EXISTS"
+	ErrNotOwner         ErrorCode = "NOT_OWNER"
+	ErrAccessDenied     ErrorCode = "ACCESS_DENIED"
+	ErrInvalidArgument  ErrorCode = "INVALID_ARGUMENT"
+	ErrInvalidStatus    ErrorCode = "INVALID_STATUS"
+	ErrStateReadFailed  ErrorCode = "STATE_READ_FAILED"
+	ErrStateWriteFailed ErrorCode = "STATE_WRITE_FAILED"
+
+	// ErrTransferRestricted rejects a transfer of a regulated asset, see
+	// ComplianceContract, with the reason in the Reason detail.
+	ErrTransferRestricted ErrorCode = "TRANSFER_RESTRICTED"
+
+	// ErrQuotaExceeded rejects a write that would take an owner over their
+	// quota, with the quota in the Quota detail and its limit in Limit.
+	ErrQuotaExceeded ErrorCode = "QUOTA_EXCEEDED"
+)
+
+// ContractError is an error with a code and details, e.g. the AssetID of an
+// asset that does not exist. Only the message of an error reaches gateway
+// clients, so Error returns the JSON of it, which they parse back out of the
+// details of an EndorseError or EvaluateError. Errors without a code reach
+// them as plain text.
+type ContractError struct {
+	Code    ErrorCode         `json:"Code"`
+	Message string            `json:"Message"`
+	Details map[string]string `json:"Details,omitempty"`
+}
+
+func (e *ContractError) Error() string {
+	errorJSON, err := json.Marshal(e)
+	if err != nil {
+		return e.Message
+	}
+	return string(errorJSON)
+}
+
+// AsContractError returns the ContractError err is or wraps, including the
+// coded form of an AccessDeniedError.
+func AsContractError(err error) (*ContractError, bool) {
+	var contractError *ContractError
+	if errors.As(err, &contractError) {
+		return contractError, true
+	}
+	var accessDenied *AccessDeniedError
+	if errors.As(err, &accessDenied) {
+		return accessDenied.contractError(), true
+	}
+	return nil, false
+}
+
+func newContractError(code ErrorCode, details map[string]string, format string, args ...interface{}) *ContractError {
+	return &ContractError{Code: code, Message: fmt.Sprintf(format, args...), Details: details}
+}
+
+func assetNotFound(id string) error {
+	return newContractError(ErrAssetNotFound, map[string]string{"AssetID": id}, "the asset %s does not exist", id)
+}
+
+func assetExists(id string) error {
+	return newContractError(ErrAssetExists, map[string]string{"AssetID": id}, "the asset %s already exists", id)
+}
+
+func invalidArgument(format string, args ...interface{}) error {
+	return newContractError(ErrInvalidArgument, nil, format, args...)
+}
+
+// invalidStatus rejects a call the asset id is not in the state for, other
+// than its lifecycle status, e.g. a purchase of an asset that is not for sale.
+func invalidStatus(id string, format string, args ...interface{}) error {
+	return newContractError(ErrInvalidStatus, map[string]string{"AssetID": id}, format, args...)
+}
+
+func stateReadFailed(err error) error {
+	return newContractError(ErrStateReadFailed, nil, "failed to read from world state: %v", err)
+}
+
+func stateWriteFailed(err error) error {
+	return newContractError(ErrStateWriteFailed, nil, "failed to put to world state. %v", err)
+}
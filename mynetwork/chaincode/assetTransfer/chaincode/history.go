@@ -0,0 +1,97 @@
+package chaincode
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// AssetVersion is an asset as a transaction left it. Asset is not set when the
+// transaction deleted it.
+type AssetVersion struct {
+	Asset     *Asset `json:"Asset,omitempty" metadata:",optional"`
+	IsDelete  bool   `json:"IsDelete"`
+	Timestamp string `json:"Timestamp"`
+	TxID      string `json:"TxID"`
+}
+
+// Ownership is a period in which an asset had the same owner, starting with
+// the transaction that gave it to them.
+type Ownership struct {
+	Owner     string `json:"Owner"`
+	OwnerName string `json:"OwnerName"`
+	Since     string `json:"Since"`
+	TxID      string `json:"TxID"`
+}
+
+// GetAssetHistory returns every version of an asset, oldest first, including
+// those of an asset that has since been deleted.
+func (q *QueryContract) GetAssetHistory(ctx contractapi.TransactionContextInterface, id string) ([]*AssetVersion, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(id)
+	if err != nil {
+		return nil, newContractError(ErrStateReadFailed, nil, "failed to read history: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var versions []*AssetVersion
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		version := &AssetVersion{
+			IsDelete:  modification.IsDelete,
+			Timestamp: modification.Timestamp.AsTime().Format(time.RFC3339),
+			TxID:      modification.TxId,
+		}
+		if !modification.IsDelete {
+			asset, err := unmarshalAsset(modification.Value)
+			if err != nil {
+				return nil, err
+			}
+			version.Asset = asset
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return nil, assetNotFound(id)
+	}
+
+	// the ledger returns the newest version first
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions, nil
+}
+
+// GetOwnershipChain returns the owners of an asset, first owner first. A new
+// owner starts with every transfer, and with the first touch of a legacy
+// owner by the contract owner. An asset deleted and created again starts over
+// with its new creator.
+func (q *QueryContract) GetOwnershipChain(ctx contractapi.TransactionContextInterface, id string) ([]*Ownership, error) {
+	versions, err := q.GetAssetHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*Ownership
+	var current *Ownership
+	for _, version := range versions {
+		if version.IsDelete {
+			current = nil
+			continue
+		}
+		if current != nil && current.Owner == version.Asset.Owner {
+			continue
+		}
+		current = &Ownership{
+			Owner:     version.Asset.Owner,
+			OwnerName: version.Asset.OwnerName,
+			Since:     version.Timestamp,
+			TxID:      version.TxID,
+		}
+		chain = append(chain, current)
+	}
+	return chain, nil
+}
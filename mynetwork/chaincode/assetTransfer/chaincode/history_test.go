@@ -0,0 +1,81 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssetHistory(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	_, err := assetTransfer.GetAssetHistory(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrAssetNotFound, "the asset asset1 does not exist")
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+
+	stub.StartTransaction("tx-create")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+	stub.StartTransaction("tx-update")
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Tomoko")))
+	agreeOnPrice(t, ctx, stub, "asset1", 500, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	stub.StartTransaction("tx-transfer")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	require.NoError(t, err)
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	stub.StartTransaction("tx-delete")
+	require.NoError(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset1")))
+
+	versions, err := assetTransfer.GetAssetHistory(ctx, "asset1")
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+	require.Equal(t, "tx-create", versions[0].TxID)
+	require.Equal(t, "blue", versions[0].Asset.Color)
+	require.Equal(t, "red", versions[1].Asset.Color)
+	require.Equal(t, buyer, versions[2].Asset.Owner)
+	require.Equal(t, &chaincode.AssetVersion{IsDelete: true, Timestamp: "2024-01-01T00:00:05Z", TxID: "tx-delete"}, versions[3])
+	require.Less(t, versions[0].Timestamp, versions[1].Timestamp)
+}
+
+func TestOwnershipChain(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+
+	stub.StartTransaction("tx-legacy")
+	require.NoError(t, stub.PutState("asset1", []byte(`{"AppraisedValue":300,"Color":"blue","ID":"asset1","Owner":"Tomoko","Size":5}`)))
+	require.NoError(t, ctx.end(nil))
+	stub.StartTransaction("tx-migrate")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+	stub.StartTransaction("tx-update")
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "green", 5, "Tomoko")))
+	agreeOnPrice(t, ctx, stub, "asset1", 500, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	stub.StartTransaction("tx-transfer")
+	_, err := assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	require.NoError(t, err)
+
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset1")))
+	stub.StartTransaction("tx-recreate")
+	appraise(stub, 100)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "white", 1, "Buyer")))
+
+	chain, err := assetTransfer.GetOwnershipChain(ctx, "asset1")
+	require.NoError(t, err)
+	var owners, txIDs []string
+	for _, ownership := range chain {
+		owners = append(owners, ownership.Owner)
+		txIDs = append(txIDs, ownership.TxID)
+	}
+	require.Equal(t, []string{"Tomoko", owner, buyer, buyer}, owners)
+	require.Equal(t, []string{"tx-legacy", "tx-migrate", "tx-transfer", "tx-recreate"}, txIDs)
+	require.Equal(t, "Tomoko", chain[1].OwnerName)
+	require.Equal(t, "Buyer", chain[2].OwnerName)
+}
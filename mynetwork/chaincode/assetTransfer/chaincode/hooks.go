@@ -0,0 +1,245 @@
+package chaincode
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// maxKeyLength bounds the keys, such as asset IDs, that callers pass in.
+const maxKeyLength = 128
+
+// reservedKeyPrefixes cannot start a key passed in by a caller. "\x00" opens
+// the composite key namespace where roles are kept, and CouchDB refuses
+// document IDs that start with "_".
+var reservedKeyPrefixes = []string{"\x00", "_"}
+
+// keyArguments are the key arguments of the transactions of each contract, by
+// contract name and then by the position of the argument, so that the hooks
+// can validate them. They are kept per contract because the contracts share
+// function names, e.g. TransferFrom takes a key in the NFT contract but only
+// accounts in the token contract.
+var keyArguments = map[string]map[string]int{
+	"asset": {
+		"AcceptTransfer":        0,
+		"AgreeToBuy":            0,
+		"AgreeToSell":           0,
+		"ApproveAssetOperation": 0,
+		"AssetExists":           0,
+		"AttachDocument":        0,
+		"BuyAsset":              0,
+		"CancelOffer":           0,
+		"ClaimAsset":            0,
+		"CreateAsset":           0,
+		"DeleteAsset":           0,
+		"DelistAsset":           0,
+		"FractionalizeAsset":    0,
+		"FreezeAsset":           0,
+		"ListAsset":             0,
+		"LockAsset":             0,
+		"LockAssetWithHash":     0,
+		"MergeAssets":           1,
+		"OfferTransfer":         0,
+		"ReadAsset":             0,
+		"RecombineAsset":        0,
+		"RefundAsset":           0,
+		"RemoveDocument":        0,
+		"RetireAsset":           0,
+		"SetAssetCategory":      0,
+		"SplitAsset":            0,
+		"TransferAsset":         0,
+		"TransferShares":        0,
+		"UnfreezeAsset":         0,
+		"UnlockAsset":           0,
+		"UpdateAsset":           0,
+	},
+	"query": {
+		"GetAssetHistory":        0,
+		"GetHashLock":            0,
+		"GetListing":             0,
+		"GetOwnershipChain":      0,
+		"GetProvenance":          0,
+		"GetShareholders":        0,
+		"ListDocuments":          0,
+		"ReadAppraisal":          0,
+		"ReadAssetWithDocuments": 0,
+		"VerifyAppraisal":        0,
+	},
+	"nft": {
+		"Approve":      1,
+		"GetApproved":  0,
+		"OwnerOf":      0,
+		"SetTokenURI":  0,
+		"TokenURI":     0,
+		"TransferFrom": 2,
+	},
+	"compliance": {
+		"GetTransferRestriction":    0,
+		"RemoveTransferRestriction": 0,
+		"SetTransferRestriction":    0,
+	},
+}
+
+var defaultLogger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// TransactionContext is what the contexts of the contracts have in common. It
+// carries the caller, resolved once before the transaction runs, and
+// remembers when the transaction started, so AfterTransaction can log how
+// long it took, and the running totals it wrote, see portfolio.go.
+type TransactionContext struct {
+	contractapi.TransactionContext
+	caller  string
+	start   time.Time
+	written map[string][]byte
+}
+
+// Caller returns the client identity that submitted the transaction, as
+// returned by WhoAmI, or "" if it could not be resolved.
+func (c *TransactionContext) Caller() string {
+	return c.caller
+}
+
+func (c *TransactionContext) base() *TransactionContext {
+	return c
+}
+
+// baseContext is implemented by TransactionContext and the contexts that embed
+// it.
+type baseContext interface {
+	base() *TransactionContext
+}
+
+// Contract is what the contracts of the chaincode have in common. NewChaincode
+// has them all run with a TransactionContext, and gives them the same hooks,
+// which validate the key arguments of each call and log it.
+type Contract struct {
+	contractapi.Contract
+
+	// Logger receives the structured transaction log, JSON on stderr if nil.
+	Logger *slog.Logger
+}
+
+func (c *Contract) shared() *Contract {
+	return c
+}
+
+// useHooks sets the transaction context and hooks of the contract.
+func (c *Contract) useHooks(h *hooks) {
+	c.TransactionContextHandler = new(TransactionContext)
+	c.BeforeTransaction = h.beforeTransaction
+	c.AfterTransaction = h.afterTransaction
+	c.UnknownTransaction = h.unknownTransaction
+}
+
+// hooks are the hooks of a contract. The key arguments of the transactions of
+// the contract are validated before they run.
+type hooks struct {
+	contract     interface{}
+	logger       *slog.Logger
+	keyArguments map[string]int
+}
+
+func newHooks(contract interface{}, logger *slog.Logger, keyArguments map[string]int) *hooks {
+	if logger == nil {
+		logger = defaultLogger
+	}
+	return &hooks{contract: contract, logger: logger, keyArguments: keyArguments}
+}
+
+func (h *hooks) beforeTransaction(ctx contractapi.TransactionContextInterface) error {
+	base := ctx.(baseContext).base()
+	base.start = time.Now()
+	if caller, err := submittingClient(ctx); err == nil {
+		base.caller = caller
+	}
+	function, params := functionAndParameters(ctx)
+	if i, ok := h.keyArguments[function]; ok && i < len(params) {
+		if err := validateKey(params[i]); err != nil {
+			h.logger.Warn("transaction rejected", append(logAttrs(ctx, function), "error", err.Error())...)
+			return err
+		}
+	}
+
+	h.logger.Info("transaction started", logAttrs(ctx, function)...)
+	return nil
+}
+
+// afterTransaction only runs when the transaction succeeded; the peer logs the
+// error of a failed one.
+func (h *hooks) afterTransaction(ctx contractapi.TransactionContextInterface, _ interface{}) error {
+	function, _ := functionAndParameters(ctx)
+	h.logger.Info("transaction completed", append(logAttrs(ctx, function), "duration", time.Since(ctx.(baseContext).base().start))...)
+	return nil
+}
+
+func (h *hooks) unknownTransaction(ctx contractapi.TransactionContextInterface) error {
+	function, _ := functionAndParameters(ctx)
+	h.logger.Warn("unknown transaction", logAttrs(ctx, function)...)
+	return fmt.Errorf("function %s not found, available functions: %s", function, strings.Join(transactionNames(h.contract), ", "))
+}
+
+// validateKey applies the key format rules to a key passed in by a caller.
+func validateKey(key string) error {
+	if key == "" {
+		return invalidArgument("key must not be empty")
+	}
+	if len(key) > maxKeyLength {
+		return invalidArgument("key is %d bytes long, the maximum is %d", len(key), maxKeyLength)
+	}
+	if !utf8.ValidString(key) {
+		return invalidArgument("key %q is not valid UTF-8", key)
+	}
+	for _, prefix := range reservedKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return invalidArgument("key %q starts with the reserved prefix %q", key, prefix)
+		}
+	}
+	return nil
+}
+
+// functionAndParameters returns the called function without its contract
+// namespace, e.g. "ReadAsset" for "asset:ReadAsset".
+func functionAndParameters(ctx contractapi.TransactionContextInterface) (string, []string) {
+	function, params := ctx.GetStub().GetFunctionAndParameters()
+	if i := strings.LastIndex(function, ":"); i >= 0 {
+		function = function[i+1:]
+	}
+	return function, params
+}
+
+func logAttrs(ctx contractapi.TransactionContextInterface, function string) []any {
+	invoker, err := submittingClient(ctx)
+	if err != nil {
+		invoker = "unknown"
+	}
+	return []any{
+		"function", function,
+		"txID", ctx.GetStub().GetTxID(),
+		"channel", ctx.GetStub().GetChannelID(),
+		"invoker", invoker,
+	}
+}
+
+// transactionNames lists the exported methods of contract that take a
+// transaction context, which are the functions clients can call.
+func transactionNames(contract interface{}) []string {
+	contextType := reflect.TypeOf((*contractapi.TransactionContextInterface)(nil)).Elem()
+	contractType := reflect.TypeOf(contract)
+
+	var names []string
+	for i := 0; i < contractType.NumMethod(); i++ {
+		method := contractType.Method(i)
+		if method.Type.NumIn() > 1 && method.Type.In(1).Implements(contextType) {
+			names = append(names, method.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,277 @@
+package chaincode_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+	"guolong.com/memstub"
+)
+
+// newChaincode returns the chaincode as the peer runs it, hooks and default
+// contract included, logging into the returned buffer.
+func newChaincode(t *testing.T) (*contractapi.ContractChaincode, *memstub.MemStub, *bytes.Buffer) {
+	var logs bytes.Buffer
+	contract := chaincode.Contract{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+	cc, err := chaincode.NewChaincode(
+		&chaincode.AssetContract{Contract: contract},
+		&chaincode.QueryContract{Contract: contract},
+		&chaincode.AdminContract{Contract: contract},
+		&chaincode.TokenContract{Contract: contract},
+		&chaincode.NFTContract{Contract: contract},
+		&chaincode.ComplianceContract{Contract: contract},
+	)
+	require.NoError(t, err)
+
+	stub := memstub.New()
+	require.NoError(t, stub.SetIdentity("Org1MSP", "Admin@guolong.com", "admin"))
+	return cc, stub, &logs
+}
+
+func logLines(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		lines = append(lines, entry)
+	}
+	logs.Reset()
+	return lines
+}
+
+func TestTransactionLogging(t *testing.T) {
+	cc, stub, logs := newChaincode(t)
+
+	stub.StartTransaction("tx-create")
+	stub.SetArgs("asset:CreateAsset", "asset1", "blue", "5", "Tomoko")
+	appraise(stub, 300)
+	response := stub.MockInvoke(cc)
+	require.EqualValues(t, shim.OK, response.Status, response.Message)
+
+	lines := logLines(t, logs)
+	require.Len(t, lines, 2)
+	require.Equal(t, "transaction started", lines[0]["msg"])
+	require.Equal(t, "transaction completed", lines[1]["msg"])
+	require.Equal(t, "CreateAsset", lines[1]["function"])
+	require.Equal(t, "tx-create", lines[1]["txID"])
+	require.Equal(t, "Org1MSP::x509::CN=Admin@guolong.com,OU=admin::CN=ca.Org1MSP", lines[1]["invoker"])
+	require.Contains(t, lines[1], "duration")
+
+	// a failed transaction is only logged as started
+	stub.SetArgs("asset:CreateAsset", "asset1", "blue", "5", "Tomoko")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	lines = logLines(t, logs)
+	require.Len(t, lines, 1)
+	require.Equal(t, "CreateAsset", lines[0]["function"])
+}
+
+func TestKeyValidation(t *testing.T) {
+	cc, stub, logs := newChaincode(t)
+
+	for key, message := range map[string]string{
+		"":                       "key must not be empty",
+		strings.Repeat("k", 129): "key is 129 bytes long, the maximum is 128",
+		"asset\xff":              `key "asset\xff" is not valid UTF-8`,
+		"_design":                `key "_design" starts with the reserved prefix "_"`,
+		"\x00contract~owner\x00": `key "\x00contract~owner\x00" starts with the reserved prefix "\x00"`,
+	} {
+		stub.SetArgs("asset:CreateAsset", key, "blue", "5", "Tomoko")
+		response := stub.MockInvoke(cc)
+		require.EqualValues(t, shim.ERROR, response.Status)
+		contractError := responseError(t, response.Message)
+		require.Equal(t, chaincode.ErrInvalidArgument, contractError.Code)
+		require.Equal(t, message, contractError.Message)
+	}
+	require.Empty(t, stub.Keys())
+
+	lines := logLines(t, logs)
+	require.Equal(t, "transaction rejected", lines[0]["msg"])
+	require.Contains(t, lines[0], "error")
+
+	stub.SetArgs("asset:ReadAsset", strings.Repeat("k", 128))
+	response := stub.MockInvoke(cc)
+	contractError := responseError(t, response.Message)
+	require.Equal(t, chaincode.ErrAssetNotFound, contractError.Code)
+	require.Equal(t, "the asset "+strings.Repeat("k", 128)+" does not exist", contractError.Message)
+	require.Equal(t, map[string]string{"AssetID": strings.Repeat("k", 128)}, contractError.Details)
+}
+
+func TestKeyValidationPerContract(t *testing.T) {
+	cc, stub, logs := newChaincode(t)
+	owner := "Org1MSP::x509::CN=Admin@guolong.com,OU=admin::CN=ca.Org1MSP"
+	recipient := "Org2MSP::x509::CN=" + strings.Repeat("b", 120) + "@org2.guolong.com,OU=client::CN=ca.Org2MSP"
+
+	// the token ID is the third argument of nft:TransferFrom
+	stub.SetArgs("nft:TransferFrom", owner, recipient, "_design")
+	response := stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	contractError := responseError(t, response.Message)
+	require.Equal(t, chaincode.ErrInvalidArgument, contractError.Code)
+	require.Equal(t, `key "_design" starts with the reserved prefix "_"`, contractError.Message)
+	lines := logLines(t, logs)
+	require.Equal(t, "transaction rejected", lines[0]["msg"])
+	require.Equal(t, "TransferFrom", lines[0]["function"])
+
+	// token:TransferFrom only takes accounts, which are not keys
+	stub.SetArgs("token:TransferFrom", owner, recipient, "5")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	contractError = responseError(t, response.Message)
+	require.Equal(t, chaincode.ErrInvalidArgument, contractError.Code)
+	require.Equal(t, owner+" may only move 0 tokens of "+owner, contractError.Message)
+	lines = logLines(t, logs)
+	require.Equal(t, "transaction started", lines[0]["msg"])
+	require.Equal(t, "TransferFrom", lines[0]["function"])
+
+	stub.SetArgs("compliance:GetTransferRestriction", "\x00asset1")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.Equal(t, chaincode.ErrInvalidArgument, responseError(t, response.Message).Code)
+}
+
+// responseError parses the ContractError in the message of an error response,
+// as gateway clients do.
+func responseError(t *testing.T, message string) *chaincode.ContractError {
+	var contractError chaincode.ContractError
+	require.NoError(t, json.Unmarshal([]byte(message), &contractError), "message %q", message)
+	return &contractError
+}
+
+func TestUnknownTransaction(t *testing.T) {
+	cc, stub, _ := newChaincode(t)
+
+	stub.SetArgs("asset:BurnAsset", "asset1")
+	response := stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.True(t, strings.HasPrefix(response.Message, "function BurnAsset not found, available functions: AcceptTransfer, AgreeToBuy, AgreeToSell, ApproveAssetOperation, AssetExists, "))
+	require.NotContains(t, response.Message, "GetBeforeTransaction")
+	require.NotContains(t, response.Message, "GetName")
+	require.NotContains(t, response.Message, "GetAssetHistory")
+
+	// a function without a contract name is looked up in the asset contract
+	stub.SetArgs("BurnAsset", "asset1")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.True(t, strings.HasPrefix(response.Message, "function BurnAsset not found, available functions: AcceptTransfer, "), response.Message)
+
+	// every contract answers with its own functions
+	stub.SetArgs("nft:BurnAsset", "asset1")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.Equal(t, "function BurnAsset not found, available functions: Approve, BalanceOf, GetApproved, IsApprovedForAll, OwnerOf, SetApprovalForAll, SetTokenURI, TokenURI, TransferFrom", response.Message)
+	stub.SetArgs("token:BurnAsset", "asset1")
+	response = stub.MockInvoke(cc)
+	require.True(t, strings.HasPrefix(response.Message, "function BurnAsset not found, available functions: Allowance, Approve, BalanceOf, Burn, "), response.Message)
+	stub.SetArgs("compliance:BurnAsset", "asset1")
+	response = stub.MockInvoke(cc)
+	require.True(t, strings.HasPrefix(response.Message, "function BurnAsset not found, available functions: GetComplianceMSP, "), response.Message)
+}
+
+func TestContracts(t *testing.T) {
+	cc, stub, _ := newChaincode(t)
+
+	stub.SetArgs("admin:Initialize")
+	response := stub.MockInvoke(cc)
+	require.EqualValues(t, shim.OK, response.Status, response.Message)
+	stub.SetArgs("asset:CreateAsset", "asset1", "blue", "5", "Tomoko")
+	appraise(stub, 300)
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.OK, response.Status, response.Message)
+
+	// callers from before the split still name no contract
+	for _, function := range []string{"GetAllAssets", "query:GetAllAssets"} {
+		stub.SetArgs(function)
+		response = stub.MockInvoke(cc)
+		require.EqualValues(t, shim.OK, response.Status, response.Message)
+		var assets []*chaincode.Asset
+		require.NoError(t, json.Unmarshal(response.Payload, &assets))
+		require.Len(t, assets, 1)
+	}
+	stub.SetArgs("AssetExists", "asset1")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.OK, response.Status, response.Message)
+	require.Equal(t, "true", string(response.Payload))
+	stub.SetArgs("ReadAsset", "asset1")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.OK, response.Status, response.Message)
+	var asset chaincode.Asset
+	require.NoError(t, json.Unmarshal(response.Payload, &asset))
+	require.Equal(t, "asset1", asset.ID)
+	stub.SetArgs("CreateAsset", "asset2", "blue", "5", "Tomoko")
+	appraise(stub, 300)
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.OK, response.Status, response.Message)
+	stub.SetArgs("TransferAsset", "asset2", "Org2MSP::x509::CN=Buyer@org2.guolong.com,OU=client::CN=ca.Org2MSP", "Buyer")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.Equal(t, chaincode.ErrInvalidStatus, responseError(t, response.Message).Code, "the transfer is refused by the asset contract, not for a missing function")
+	// of the transactions that moved, only GetAllAssets is kept on the asset
+	// contract
+	stub.SetArgs("InitLedger")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.True(t, strings.HasPrefix(response.Message, "function InitLedger not found, available functions: "), response.Message)
+	stub.SetArgs("admin:InitLedger")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.Equal(t, "the sample assets are only for development, load assets with InitLedgerFromJSON", responseError(t, response.Message).Message)
+
+	// the asset rules are there for clients to check their input against
+	stub.SetArgs("query:GetAssetRules")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.OK, response.Status, response.Message)
+	var rules []chaincode.FieldRule
+	require.NoError(t, json.Unmarshal(response.Payload, &rules))
+	require.Equal(t, "ID", rules[0].Field)
+
+	// each contract only has its own transactions
+	stub.SetArgs("query:CreateAsset", "asset2", "blue", "5", "Tomoko")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	stub.SetArgs("asset:Initialize")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	stub.SetArgs("admin:GetContractOwner")
+	response = stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+}
+
+func TestTransactionContextCaller(t *testing.T) {
+	stub := memstub.New()
+	require.NoError(t, stub.SetIdentity("Org1MSP", "Admin@guolong.com", "admin"))
+	clientIdentity, err := cid.New(stub)
+	require.NoError(t, err)
+
+	contract := chaincode.Contract{Logger: slog.New(slog.NewJSONHandler(io.Discard, nil))}
+	contracts := []contractapi.ContractInterface{
+		&chaincode.AssetContract{Contract: contract},
+		&chaincode.QueryContract{Contract: contract},
+		&chaincode.AdminContract{Contract: contract},
+		&chaincode.TokenContract{Contract: contract},
+		&chaincode.NFTContract{Contract: contract},
+		&chaincode.ComplianceContract{Contract: contract},
+	}
+	_, err = chaincode.NewChaincode(contracts...)
+	require.NoError(t, err)
+	for _, contract := range contracts {
+		ctx := contract.GetTransactionContextHandler().(*chaincode.TransactionContext)
+		ctx.SetStub(stub)
+		ctx.SetClientIdentity(clientIdentity)
+		require.Empty(t, ctx.Caller())
+
+		stub.SetArgs(contract.GetName() + ":WhoAmI")
+		before := contract.GetBeforeTransaction().(func(contractapi.TransactionContextInterface) error)
+		require.NoError(t, before(ctx))
+		require.Equal(t, org1Admin, ctx.Caller(), contract.GetName())
+	}
+}
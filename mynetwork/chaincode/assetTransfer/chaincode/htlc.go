@@ -0,0 +1,243 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// A hash time-locked contract (HTLC) swaps an asset on this channel for one on
+// another channel. Both owners lock their asset to the other with the same hash
+// lock, the first with the longer timeout. Claiming one asset reveals the
+// preimage in the AssetClaimed event, which a relayer watching both channels
+// passes on to claim the other. An asset not claimed in time goes back with
+// RefundAsset.
+//
+// Times are those of the transactions, which the clients set, so that every
+// endorser sees the same.
+const hashLockObjectType = "asset~htlc"
+
+const (
+	assetHashLockedEvent = "AssetHashLocked"
+	assetClaimedEvent    = "AssetClaimed"
+	assetRefundedEvent   = "AssetRefunded"
+)
+
+// HashLock locks an asset to Recipient until Timeout, an RFC 3339 time. HashLock
+// is the hex SHA-256 of the preimage that claims it. Preimage is only set in
+// the AssetClaimed event, and StatusChange in the events, to the change of the
+// asset's status that came with them.
+type HashLock struct {
+	AssetID      string        `json:"AssetID"`
+	HashLock     string        `json:"HashLock"`
+	Owner        string        `json:"Owner"`
+	Preimage     string        `json:"Preimage,omitempty" metadata:",optional"`
+	Recipient    string        `json:"Recipient"`
+	StatusChange *StatusChange `json:"StatusChange,omitempty" metadata:",optional"`
+	Timeout      string        `json:"Timeout"`
+	TxID         string        `json:"TxID"`
+}
+
+// LockAssetWithHash locks an active asset to recipient, a client identity as
+// returned by WhoAmI, until timeout, an RFC 3339 time. Whoever knows the
+// preimage of hashLock, the hex SHA-256 of it, can claim the asset for
+// recipient before then. Only the owner or an admin of the owner's org can
+// call it.
+func (a *AssetContract) LockAssetWithHash(ctx contractapi.TransactionContextInterface, id string, recipient string, hashLock string, timeout string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireWhole(asset); err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if _, isIdentity := ownerMSPID(recipient); !isIdentity {
+		return invalidArgument("recipient %s is not a client identity", recipient)
+	}
+	if recipient == asset.Owner {
+		return invalidArgument("%s already owns asset %s", recipient, id)
+	}
+	if hash, err := hex.DecodeString(hashLock); err != nil || len(hash) != sha256.Size {
+		return invalidArgument("the hash lock must be a hex SHA-256 hash")
+	}
+	timeoutTime, err := parseDeadline(ctx, "timeout", timeout)
+	if err != nil {
+		return err
+	}
+	if err := releaseExpiredOffer(ctx, asset); err != nil {
+		return err
+	}
+	change, err := changeStatus(ctx, asset, StatusLocked, "hash locked to "+recipient, StatusActive)
+	if err != nil {
+		return err
+	}
+
+	lock := &HashLock{
+		AssetID:   id,
+		HashLock:  hashLock,
+		Owner:     asset.Owner,
+		Recipient: recipient,
+		Timeout:   timeoutTime.UTC().Format(time.RFC3339),
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	lockJSON, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(hashLockObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, lockJSON); err != nil {
+		return err
+	}
+	return setHashLockEvent(ctx, assetHashLockedEvent, lock, change)
+}
+
+// ClaimAsset gives a hash locked asset to its recipient before the timeout.
+// Anyone who knows the preimage can call it, so that a relayer can claim on
+// behalf of the recipient. The recipient sets their owner name with
+// UpdateAsset.
+func (a *AssetContract) ClaimAsset(ctx contractapi.TransactionContextInterface, id string, preimage string) error {
+	lock, err := readHashLock(ctx, id)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return invalidStatus(id, "the asset %s is not hash locked", id)
+	}
+	expired, err := hashLockExpired(ctx, lock)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return invalidStatus(id, "the hash lock of asset %s timed out at %s", id, lock.Timeout)
+	}
+	hash := sha256.Sum256([]byte(preimage))
+	if hex.EncodeToString(hash[:]) != lock.HashLock {
+		return invalidArgument("the preimage does not match the hash lock of asset %s", id)
+	}
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireStatus(asset, StatusLocked); err != nil {
+		return err
+	}
+	if err := requireTransferAllowed(ctx, id, lock.Recipient); err != nil {
+		return err
+	}
+
+	if err := deleteHashLock(ctx, id); err != nil {
+		return err
+	}
+	change, err := handOver(ctx, asset, lock.Recipient, "", "claimed with the preimage of the hash lock")
+	if err != nil {
+		return err
+	}
+	lock.Preimage = preimage
+	return setHashLockEvent(ctx, assetClaimedEvent, lock, change)
+}
+
+// RefundAsset unlocks a hash locked asset for its owner once the timeout has
+// passed without a claim. Anyone can call it.
+func (a *AssetContract) RefundAsset(ctx contractapi.TransactionContextInterface, id string) error {
+	lock, err := readHashLock(ctx, id)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return invalidStatus(id, "the asset %s is not hash locked", id)
+	}
+	expired, err := hashLockExpired(ctx, lock)
+	if err != nil {
+		return err
+	}
+	if !expired {
+		return invalidStatus(id, "the hash lock of asset %s does not time out until %s", id, lock.Timeout)
+	}
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireStatus(asset, StatusLocked); err != nil {
+		return err
+	}
+
+	if err := deleteHashLock(ctx, id); err != nil {
+		return err
+	}
+	change, err := changeStatus(ctx, asset, StatusActive, "hash lock timed out", StatusLocked)
+	if err != nil {
+		return err
+	}
+	return setHashLockEvent(ctx, assetRefundedEvent, lock, change)
+}
+
+// GetHashLock returns the hash lock of an asset.
+func (q *QueryContract) GetHashLock(ctx contractapi.TransactionContextInterface, id string) (*HashLock, error) {
+	lock, err := readHashLock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, invalidStatus(id, "the asset %s is not hash locked", id)
+	}
+	return lock, nil
+}
+
+func readHashLock(ctx contractapi.TransactionContextInterface, id string) (*HashLock, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(hashLockObjectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	lockJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if lockJSON == nil {
+		return nil, nil
+	}
+
+	var lock HashLock
+	if err := json.Unmarshal(lockJSON, &lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+func deleteHashLock(ctx contractapi.TransactionContextInterface, id string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(hashLockObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+func hashLockExpired(ctx contractapi.TransactionContextInterface, lock *HashLock) (bool, error) {
+	timeout, err := time.Parse(time.RFC3339, lock.Timeout)
+	if err != nil {
+		return false, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+	return !now.Before(timeout), nil
+}
+
+func setHashLockEvent(ctx contractapi.TransactionContextInterface, name string, lock *HashLock, change *StatusChange) error {
+	event := *lock
+	event.StatusChange = change
+	lockJSON, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(name, lockJSON)
+}
@@ -0,0 +1,128 @@
+package chaincode_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func hashOf(preimage string) string {
+	hash := sha256.Sum256([]byte(preimage))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestClaimAsset(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+
+	requireCode(t, ctx.end(assetTransfer.LockAssetWithHash(ctx, "asset1", recipient, "secret", "2024-01-02T00:00:00Z")), chaincode.ErrInvalidArgument, "the hash lock must be a hex SHA-256 hash")
+	requireCode(t, ctx.end(assetTransfer.LockAssetWithHash(ctx, "asset1", recipient, hashOf("secret"), "2024-01-01T00:00:00Z")), chaincode.ErrInvalidArgument, "the timeout 2024-01-01T00:00:00Z is not after the transaction time 2024-01-01T00:00:00Z")
+	stub.StartTransaction("tx-lock")
+	require.NoError(t, ctx.end(assetTransfer.LockAssetWithHash(ctx, "asset1", recipient, hashOf("secret"), "2024-01-02T00:00:00Z")))
+	require.Equal(t, "AssetHashLocked", stub.Event().EventName)
+	var locked chaincode.HashLock
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &locked))
+	require.Equal(t, &chaincode.StatusChange{AssetID: "asset1", By: owner, From: "Active", Reason: "hash locked to " + recipient, To: "Locked", TxID: "tx-lock"}, locked.StatusChange)
+	lock, err := assetTransfer.GetHashLock(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.HashLock{AssetID: "asset1", HashLock: hashOf("secret"), Owner: owner, Recipient: recipient, Timeout: "2024-01-02T00:00:00Z", TxID: "tx-lock"}, lock)
+
+	// the owner cannot back out before the timeout
+	requireCode(t, ctx.end(assetTransfer.UnlockAsset(ctx, "asset1", "changed my mind")), chaincode.ErrInvalidStatus, "the asset asset1 is hash locked until 2024-01-02T00:00:00Z")
+	requireCode(t, ctx.end(assetTransfer.RefundAsset(ctx, "asset1")), chaincode.ErrInvalidStatus, "the hash lock of asset asset1 does not time out until 2024-01-02T00:00:00Z")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", recipient, "Buyer")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+
+	// a relayer claims for the recipient
+	setCaller(t, ctx, stub, "Org3MSP", "Relayer@org3.guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.ClaimAsset(ctx, "asset1", "guess")), chaincode.ErrInvalidArgument, "the preimage does not match the hash lock of asset asset1")
+	require.NoError(t, ctx.end(assetTransfer.ClaimAsset(ctx, "asset1", "secret")))
+	require.Equal(t, "AssetClaimed", stub.Event().EventName)
+	var claimed chaincode.HashLock
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &claimed))
+	require.Equal(t, "secret", claimed.Preimage)
+	require.Equal(t, "Active", claimed.StatusChange.To)
+	require.Equal(t, "claimed with the preimage of the hash lock", claimed.StatusChange.Reason)
+
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, recipient, asset.Owner)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	_, err = assetTransfer.GetHashLock(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 is not hash locked")
+	requireCode(t, ctx.end(assetTransfer.ClaimAsset(ctx, "asset1", "secret")), chaincode.ErrInvalidStatus, "the asset asset1 is not hash locked")
+}
+
+func TestRefundAsset(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	require.NoError(t, ctx.end(assetTransfer.LockAssetWithHash(ctx, "asset1", recipient, hashOf("secret"), "2024-01-01T01:00:00Z")))
+
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC))
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.ClaimAsset(ctx, "asset1", "secret")), chaincode.ErrInvalidStatus, "the hash lock of asset asset1 timed out at 2024-01-01T01:00:00Z")
+	require.NoError(t, ctx.end(assetTransfer.RefundAsset(ctx, "asset1")))
+	require.Equal(t, "AssetRefunded", stub.Event().EventName)
+	var refunded chaincode.HashLock
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &refunded))
+	require.Equal(t, "Active", refunded.StatusChange.To)
+	require.Equal(t, "hash lock timed out", refunded.StatusChange.Reason)
+
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, owner, asset.Owner)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	require.Equal(t, "hash lock timed out", asset.StatusReason)
+	requireCode(t, ctx.end(assetTransfer.RefundAsset(ctx, "asset1")), chaincode.ErrInvalidStatus, "the asset asset1 is not hash locked")
+}
+
+func TestUnfreezeHashLockedAsset(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	regulator := setCaller(t, ctx, stub, "RegulatorMSP", "Auditor@regulator.guolong.com", "client")
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.AddRegulator(ctx, regulator)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	require.NoError(t, ctx.end(assetTransfer.LockAssetWithHash(ctx, "asset1", recipient, hashOf("secret"), "2024-01-02T00:00:00Z")))
+
+	setCaller(t, ctx, stub, "RegulatorMSP", "Auditor@regulator.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.FreezeAsset(ctx, "asset1", "investigation")))
+	require.NoError(t, ctx.end(assetTransfer.UnfreezeAsset(ctx, "asset1", "cleared")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusLocked, asset.Status)
+
+	// the hash lock still holds the asset for the recipient
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", "Org3MSP", "Other")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.ClaimAsset(ctx, "asset1", "secret")))
+	asset, err = assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, recipient, asset.Owner)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+}
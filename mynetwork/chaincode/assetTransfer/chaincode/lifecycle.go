@@ -0,0 +1,226 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// The lifecycle of an asset. Only active assets can be updated or transferred.
+// The owner locks an asset while a sale of it is pending, and retires it when
+// it goes out of use; a retired asset stays on record but never changes again.
+// Regulators freeze an asset, active or locked, until they unfreeze it.
+const (
+	StatusActive  = "Active"
+	StatusLocked  = "Locked"
+	StatusFrozen  = "Frozen"
+	StatusRetired = "Retired"
+)
+
+const statusChangedEvent = "AssetStatusChanged"
+
+// StatusChange is the payload of the AssetStatusChanged event. Transactions
+// that emit an event of their own carry their status changes in it instead,
+// as a transaction keeps only its last event.
+type StatusChange struct {
+	AssetID string `json:"AssetID"`
+	By      string `json:"By"`
+	From    string `json:"From"`
+	Reason  string `json:"Reason"`
+	To      string `json:"To"`
+	TxID    string `json:"TxID"`
+}
+
+// FreezeAsset freezes an active or locked asset. Only regulators can call it.
+func (a *AssetContract) FreezeAsset(ctx contractapi.TransactionContextInterface, id string, reason string) error {
+	if err := requireRegulator(ctx); err != nil {
+		return err
+	}
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	change, err := changeStatus(ctx, asset, StatusFrozen, reason, StatusActive, StatusLocked)
+	if err != nil {
+		return err
+	}
+	return setStatusEvent(ctx, change)
+}
+
+// UnfreezeAsset makes a frozen asset active again, or locked again if it is
+// still offered or hash locked, so that the offer or hash lock can complete.
+// Only regulators can call it.
+func (a *AssetContract) UnfreezeAsset(ctx contractapi.TransactionContextInterface, id string, reason string) error {
+	if err := requireRegulator(ctx); err != nil {
+		return err
+	}
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	to, err := unfrozenStatus(ctx, id)
+	if err != nil {
+		return err
+	}
+	change, err := changeStatus(ctx, asset, to, reason, StatusFrozen)
+	if err != nil {
+		return err
+	}
+	return setStatusEvent(ctx, change)
+}
+
+// unfrozenStatus returns the status a frozen asset goes back to: locked if an
+// offer or hash lock of it is pending, active otherwise.
+func unfrozenStatus(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	offer, err := readOffer(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	lock, err := readHashLock(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if offer != nil || lock != nil {
+		return StatusLocked, nil
+	}
+	return StatusActive, nil
+}
+
+// LockAsset locks an active asset while a sale of it is pending. Only the
+// owner or an admin of the owner's org can call it.
+func (a *AssetContract) LockAsset(ctx contractapi.TransactionContextInterface, id string, reason string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if err := releaseExpiredOffer(ctx, asset); err != nil {
+		return err
+	}
+	change, err := changeStatus(ctx, asset, StatusLocked, reason, StatusActive)
+	if err != nil {
+		return err
+	}
+	return setStatusEvent(ctx, change)
+}
+
+// UnlockAsset makes a locked asset active again, withdrawing the offer of it if
+// there is one. A hash locked asset only unlocks through ClaimAsset or
+// RefundAsset. Only the owner or an admin of the owner's org can call it.
+func (a *AssetContract) UnlockAsset(ctx contractapi.TransactionContextInterface, id string, reason string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if reason == "" {
+		return invalidArgument("a reason is required")
+	}
+	hashLock, err := readHashLock(ctx, id)
+	if err != nil {
+		return err
+	}
+	if hashLock != nil {
+		return invalidStatus(id, "the asset %s is hash locked until %s", id, hashLock.Timeout)
+	}
+	offer, err := readOffer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if offer != nil && assetStatus(asset) == StatusLocked {
+		return cancelOffer(ctx, asset, offer, reason)
+	}
+	change, err := changeStatus(ctx, asset, StatusActive, reason, StatusLocked)
+	if err != nil {
+		return err
+	}
+	return setStatusEvent(ctx, change)
+}
+
+// RetireAsset takes an active asset out of use for good, keeping it on record
+// rather than deleting it. Only the owner or an admin of the owner's org can
+// call it.
+func (a *AssetContract) RetireAsset(ctx contractapi.TransactionContextInterface, id string, reason string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if err := releaseExpiredOffer(ctx, asset); err != nil {
+		return err
+	}
+	change, err := changeStatus(ctx, asset, StatusRetired, reason, StatusActive)
+	if err != nil {
+		return err
+	}
+	return setStatusEvent(ctx, change)
+}
+
+// assetStatus returns the status of an asset, which is active for assets
+// written before the lifecycle.
+func assetStatus(asset *Asset) string {
+	if asset.Status == "" {
+		return StatusActive
+	}
+	return asset.Status
+}
+
+// requireStatus returns an error unless the asset has one of the statuses.
+func requireStatus(asset *Asset, statuses ...string) error {
+	status := assetStatus(asset)
+	for _, allowed := range statuses {
+		if status == allowed {
+			return nil
+		}
+	}
+	return newContractError(ErrInvalidStatus, map[string]string{"AssetID": asset.ID, "Status": status}, "the asset %s is %s", asset.ID, strings.ToLower(status))
+}
+
+// changeStatus moves an asset in one of the statuses from to status to and
+// records the reason on it. It returns the change for the event of the
+// transaction, see setStatusEvent.
+func changeStatus(ctx contractapi.TransactionContextInterface, asset *Asset, to string, reason string, from ...string) (*StatusChange, error) {
+	if reason == "" {
+		return nil, invalidArgument("a reason is required")
+	}
+	if err := requireStatus(asset, from...); err != nil {
+		return nil, err
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &StatusChange{
+		AssetID: asset.ID,
+		By:      caller,
+		From:    assetStatus(asset),
+		Reason:  reason,
+		To:      to,
+		TxID:    ctx.GetStub().GetTxID(),
+	}
+	old := *asset
+	asset.Status = to
+	asset.StatusReason = reason
+	if err := putAsset(ctx, &old, asset); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// setStatusEvent emits an AssetStatusChanged event for a transaction that only
+// changes the status of an asset.
+func setStatusEvent(ctx contractapi.TransactionContextInterface, change *StatusChange) error {
+	changeJSON, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(statusChangedEvent, changeJSON)
+}
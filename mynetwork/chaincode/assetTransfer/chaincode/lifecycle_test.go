@@ -0,0 +1,112 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegulatorRoles(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	regulator := setCaller(t, ctx, stub, "RegulatorMSP", "Auditor@regulator.guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.AddRegulator(ctx, regulator))))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	requireCode(t, ctx.end(assetTransfer.AddRegulator(ctx, "")), chaincode.ErrInvalidArgument, "regulator must not be empty")
+	require.NoError(t, ctx.end(assetTransfer.AddRegulator(ctx, regulator)))
+	regulators, err := assetTransfer.GetRegulators(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{regulator}, regulators)
+	admins, err := assetTransfer.GetAdmins(ctx)
+	require.NoError(t, err)
+	require.Empty(t, admins, "regulators are not admins")
+
+	require.NoError(t, ctx.end(assetTransfer.RemoveRegulator(ctx, regulator)))
+	requireCode(t, ctx.end(assetTransfer.RemoveRegulator(ctx, regulator)), chaincode.ErrInvalidArgument, fmt.Sprintf("%s is not a regulator", regulator))
+}
+
+func TestAssetLifecycle(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	regulator := setCaller(t, ctx, stub, "RegulatorMSP", "Auditor@regulator.guolong.com", "client")
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.AddRegulator(ctx, regulator)))
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+
+	// the owner locks the asset while a sale is pending
+	requireCode(t, ctx.end(assetTransfer.LockAsset(ctx, "asset1", "")), chaincode.ErrInvalidArgument, "a reason is required")
+	stub.StartTransaction("tx-lock")
+	require.NoError(t, ctx.end(assetTransfer.LockAsset(ctx, "asset1", "sale pending")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusLocked, asset.Status)
+	require.Equal(t, "sale pending", asset.StatusReason)
+	require.Equal(t, "AssetStatusChanged", stub.Event().EventName)
+	var change chaincode.StatusChange
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &change))
+	require.Equal(t, chaincode.StatusChange{AssetID: "asset1", By: owner, From: "Active", Reason: "sale pending", To: "Locked", TxID: "tx-lock"}, change)
+
+	requireCode(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Tomoko")), chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+	agreeOnPrice(t, ctx, stub, "asset1", 500, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+	requireCode(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset1")), chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+
+	// only regulators freeze, and the owner cannot unlock a frozen asset
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.FreezeAsset(ctx, "asset1", "investigation"))))
+	setCaller(t, ctx, stub, "RegulatorMSP", "Auditor@regulator.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.FreezeAsset(ctx, "asset1", "investigation")))
+	requireCode(t, ctx.end(assetTransfer.FreezeAsset(ctx, "asset1", "investigation")), chaincode.ErrInvalidStatus, "the asset asset1 is frozen")
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	requireCode(t, ctx.end(assetTransfer.UnlockAsset(ctx, "asset1", "sale off")), chaincode.ErrInvalidStatus, "the asset asset1 is frozen")
+	requireCode(t, ctx.end(assetTransfer.RetireAsset(ctx, "asset1", "scrapped")), chaincode.ErrInvalidStatus, "the asset asset1 is frozen")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.UnfreezeAsset(ctx, "asset1", "cleared"))))
+
+	setCaller(t, ctx, stub, "RegulatorMSP", "Auditor@regulator.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.UnfreezeAsset(ctx, "asset1", "cleared")))
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	require.NoError(t, err)
+
+	// a retired asset stays on record and never changes again
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.RetireAsset(ctx, "asset1", "scrapped")))
+	asset, err = assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusRetired, asset.Status)
+	require.Equal(t, "scrapped", asset.StatusReason)
+	requireCode(t, ctx.end(assetTransfer.LockAsset(ctx, "asset1", "sale pending")), chaincode.ErrInvalidStatus, "the asset asset1 is retired")
+	requireCode(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Buyer")), chaincode.ErrInvalidStatus, "the asset asset1 is retired")
+
+	versions, err := assetTransfer.GetAssetHistory(ctx, "asset1")
+	require.NoError(t, err)
+	var reasons []string
+	for _, version := range versions {
+		reasons = append(reasons, version.Asset.StatusReason)
+	}
+	require.Equal(t, []string{"", "sale pending", "investigation", "cleared", "cleared", "scrapped"}, reasons)
+}
+
+func TestLegacyAssetIsActive(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	require.NoError(t, stub.PutState("asset1", []byte(`{"AppraisedValue":300,"Color":"blue","ID":"asset1","Owner":"Tomoko","Size":5}`)))
+	require.NoError(t, ctx.end(nil))
+
+	require.NoError(t, ctx.end(assetTransfer.LockAsset(ctx, "asset1", "sale pending")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusLocked, asset.Status)
+	require.NoError(t, ctx.end(assetTransfer.UnlockAsset(ctx, "asset1", "sale off")))
+}
@@ -0,0 +1,280 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	assetSplitEvent   = "AssetSplit"
+	assetsMergedEvent = "AssetsMerged"
+)
+
+// AssetLineage is the payload of the AssetSplit and AssetsMerged events, with
+// the retirement of the parents.
+type AssetLineage struct {
+	Children      []string        `json:"Children"`
+	Parents       []string        `json:"Parents"`
+	StatusChanges []*StatusChange `json:"StatusChanges"`
+}
+
+// SplitAsset divides an active asset into children of the given sizes, which
+// must add up to its size. The children are named after the asset, e.g.
+// asset1.1 and asset1.2, and the appraisal is divided between them in
+// proportion to their sizes. The asset is retired and keeps links to its
+// children. Only the owner or an admin of the owner's org can call it, and
+// the caller's org must hold the appraisal.
+func (a *AssetContract) SplitAsset(ctx contractapi.TransactionContextInterface, id string, sizes []int) error {
+	parent, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireWhole(parent); err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, parent); err != nil {
+		return err
+	}
+	if err := requireStatus(parent, StatusActive); err != nil {
+		return err
+	}
+	if len(sizes) < 2 {
+		return invalidArgument("an asset must be split into at least 2 children")
+	}
+	total := 0
+	for _, size := range sizes {
+		if size <= 0 {
+			return invalidArgument("the sizes must be positive")
+		}
+		total += size
+	}
+	if total != parent.Size {
+		return invalidArgument("the sizes add up to %d, not the size %d of asset %s", total, parent.Size, id)
+	}
+	appraisal, err := lineageAppraisal(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// the children are checked before the asset is retired, and written after,
+	// so that it does not count against the quota of the owner alongside them
+	var children []*Asset
+	var childAppraisals []*Appraisal
+	var childIDs []string
+	assigned := 0
+	for i, size := range sizes {
+		childID := fmt.Sprintf("%s.%d", id, i+1)
+		if err := requireNewAsset(ctx, childID); err != nil {
+			return err
+		}
+		child := &Asset{
+			Category:  parent.Category,
+			Color:     parent.Color,
+			ID:        childID,
+			Owner:     parent.Owner,
+			OwnerName: parent.OwnerName,
+			Parents:   []string{id},
+			Size:      size,
+			Status:    StatusActive,
+		}
+		// the last child takes the remainder, so the values add up
+		value := appraisal.AppraisedValue * size / total
+		if i == len(sizes)-1 {
+			value = appraisal.AppraisedValue - assigned
+		}
+		assigned += value
+		childAppraisal := &Appraisal{AppraisedValue: value, Salt: appraisal.Salt + ":" + childID}
+		if err := validateAsset(ctx, child, childAppraisal); err != nil {
+			return err
+		}
+		children = append(children, child)
+		childAppraisals = append(childAppraisals, childAppraisal)
+		childIDs = append(childIDs, childID)
+	}
+
+	if err := inheritRestriction(ctx, []string{id}, childIDs); err != nil {
+		return err
+	}
+	change, err := retireIntoChildren(ctx, parent, childIDs, "split into "+strings.Join(childIDs, ", "))
+	if err != nil {
+		return err
+	}
+	for i, child := range children {
+		if err := storeAppraisal(ctx, child, childAppraisals[i]); err != nil {
+			return err
+		}
+		if err := putAsset(ctx, nil, child); err != nil {
+			return err
+		}
+	}
+	return setLineageEvent(ctx, assetSplitEvent, &AssetLineage{Children: childIDs, Parents: []string{id}, StatusChanges: []*StatusChange{change}})
+}
+
+// MergeAssets combines active assets of the same owner and color into a new
+// asset newID, whose size and appraisal are their sums. The assets are retired
+// and keep links to the new one. Only the owner or an admin of the owner's org
+// can call it, and the caller's org must hold the appraisals.
+func (a *AssetContract) MergeAssets(ctx contractapi.TransactionContextInterface, ids []string, newID string) error {
+	if len(ids) < 2 {
+		return invalidArgument("at least 2 assets must be merged")
+	}
+	if err := requireNewAsset(ctx, newID); err != nil {
+		return err
+	}
+
+	var parents []*Asset
+	seen := map[string]bool{}
+	merged := &Asset{ID: newID, Parents: ids, Status: StatusActive}
+	var value int
+	var salt string
+	for _, id := range ids {
+		if seen[id] {
+			return invalidArgument("asset %s is listed more than once", id)
+		}
+		seen[id] = true
+		parent, err := a.ReadAsset(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := requireWhole(parent); err != nil {
+			return err
+		}
+		if _, err := authorizeOwner(ctx, parent); err != nil {
+			return err
+		}
+		if err := requireStatus(parent, StatusActive); err != nil {
+			return err
+		}
+		if len(parents) == 0 {
+			merged.Category = parent.Category
+			merged.Color = parent.Color
+			merged.Owner = parent.Owner
+			merged.OwnerName = parent.OwnerName
+		} else if parent.Owner != merged.Owner || parent.Color != merged.Color {
+			return invalidArgument("asset %s does not have the owner and color of asset %s", id, ids[0])
+		}
+		appraisal, err := lineageAppraisal(ctx, id)
+		if err != nil {
+			return err
+		}
+		if len(parents) == 0 {
+			salt = appraisal.Salt + ":" + newID
+		}
+		merged.Size += parent.Size
+		value += appraisal.AppraisedValue
+		parents = append(parents, parent)
+	}
+
+	mergedAppraisal := &Appraisal{AppraisedValue: value, Salt: salt}
+	if err := validateAsset(ctx, merged, mergedAppraisal); err != nil {
+		return err
+	}
+	if err := inheritRestriction(ctx, ids, []string{newID}); err != nil {
+		return err
+	}
+	// the assets are retired first, so that they do not count against the
+	// quota of the owner alongside the new one
+	var changes []*StatusChange
+	for _, parent := range parents {
+		change, err := retireIntoChildren(ctx, parent, []string{newID}, "merged into "+newID)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	}
+	if err := storeAppraisal(ctx, merged, mergedAppraisal); err != nil {
+		return err
+	}
+	if err := putAsset(ctx, nil, merged); err != nil {
+		return err
+	}
+	return setLineageEvent(ctx, assetsMergedEvent, &AssetLineage{Children: []string{newID}, Parents: ids, StatusChanges: changes})
+}
+
+// GetProvenance returns the assets an asset was split or merged from, and
+// those they came from in turn, nearest first.
+func (q *QueryContract) GetProvenance(ctx contractapi.TransactionContextInterface, id string) ([]*Asset, error) {
+	asset, err := readAsset(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors := []*Asset{}
+	seen := map[string]bool{id: true}
+	queue := asset.Parents
+	for len(queue) > 0 {
+		parentID := queue[0]
+		queue = queue[1:]
+		if seen[parentID] {
+			continue
+		}
+		seen[parentID] = true
+
+		parent, err := indexedAsset(ctx, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			// deleted after it was retired
+			continue
+		}
+		ancestors = append(ancestors, parent)
+		queue = append(queue, parent.Parents...)
+	}
+	return ancestors, nil
+}
+
+// lineageAppraisal returns the appraisal of an asset held by the caller's org.
+func lineageAppraisal(ctx contractapi.TransactionContextInterface, id string) (*Appraisal, error) {
+	appraisal, err := (&QueryContract{}).ReadAppraisal(ctx, id)
+	if contractError, ok := AsContractError(err); ok && contractError.Code == ErrInvalidStatus {
+		return nil, newContractError(contractError.Code, contractError.Details, "%s, record it with UpdateAsset first", contractError.Message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return appraisal, nil
+}
+
+func requireNewAsset(ctx contractapi.TransactionContextInterface, id string) error {
+	if err := validateKey(id); err != nil {
+		return err
+	}
+	assetJSON, err := ctx.GetStub().GetState(id)
+	if err != nil {
+		return stateReadFailed(err)
+	}
+	if assetJSON != nil {
+		return assetExists(id)
+	}
+	return nil
+}
+
+// retireIntoChildren links a split or merged asset to the assets it went into,
+// and retires it. Its appraisal passes on to them. It returns the change of
+// status.
+func retireIntoChildren(ctx contractapi.TransactionContextInterface, parent *Asset, childIDs []string, reason string) (*StatusChange, error) {
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeAppraisal(ctx, collection, parent.ID); err != nil {
+		return nil, err
+	}
+	if err := dropOwnerGrants(ctx, parent.ID); err != nil {
+		return nil, err
+	}
+	parent.Children = childIDs
+	return changeStatus(ctx, parent, StatusRetired, reason, StatusActive)
+}
+
+func setLineageEvent(ctx contractapi.TransactionContextInterface, name string, lineage *AssetLineage) error {
+	lineageJSON, err := json.Marshal(lineage)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(name, lineageJSON)
+}
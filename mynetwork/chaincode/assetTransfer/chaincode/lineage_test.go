@@ -0,0 +1,114 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitAsset(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 100)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 6, "Seller")))
+
+	requireCode(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset1", []int{6})), chaincode.ErrInvalidArgument, "an asset must be split into at least 2 children")
+	requireCode(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset1", []int{7, -1})), chaincode.ErrInvalidArgument, "the sizes must be positive")
+	requireCode(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset1", []int{2, 3})), chaincode.ErrInvalidArgument, "the sizes add up to 5, not the size 6 of asset asset1")
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.SplitAsset(ctx, "asset1", []int{3, 3}))))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	stub.StartTransaction("tx-split")
+	require.NoError(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset1", []int{1, 2, 3})))
+	require.Equal(t, "AssetSplit", stub.Event().EventName)
+	var lineage chaincode.AssetLineage
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &lineage))
+	require.Equal(t, chaincode.AssetLineage{
+		Children:      []string{"asset1.1", "asset1.2", "asset1.3"},
+		Parents:       []string{"asset1"},
+		StatusChanges: []*chaincode.StatusChange{{AssetID: "asset1", By: owner, From: "Active", Reason: "split into asset1.1, asset1.2, asset1.3", To: "Retired", TxID: "tx-split"}},
+	}, lineage)
+
+	parent, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusRetired, parent.Status)
+	require.Equal(t, []string{"asset1.1", "asset1.2", "asset1.3"}, parent.Children)
+	_, err = assetTransfer.ReadAppraisal(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the appraisal of asset asset1 is not in collection _implicit_org_Org1MSP")
+
+	// the value is divided by size, and the last child takes the remainder
+	values := []int{16, 33, 51}
+	for i, id := range []string{"asset1.1", "asset1.2", "asset1.3"} {
+		child, err := assetTransfer.ReadAsset(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, owner, child.Owner)
+		require.Equal(t, "blue", child.Color)
+		require.Equal(t, i+1, child.Size)
+		require.Equal(t, []string{"asset1"}, child.Parents)
+		appraisal, err := assetTransfer.ReadAppraisal(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, values[i], appraisal.AppraisedValue)
+	}
+
+	requireCode(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset1", []int{3, 3})), chaincode.ErrInvalidStatus, "the asset asset1 is retired")
+}
+
+func TestMergeAssets(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 100)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 4, "Seller")))
+	appraise(stub, 200)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset2", "blue", 6, "Seller")))
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset3", "red", 5, "Seller")))
+	require.NoError(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset2", []int{3, 3})))
+
+	requireCode(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1"}, "asset4")), chaincode.ErrInvalidArgument, "at least 2 assets must be merged")
+	requireCode(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset3"}, "asset4")), chaincode.ErrInvalidArgument, "asset asset3 does not have the owner and color of asset asset1")
+	requireCode(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset1"}, "asset4")), chaincode.ErrInvalidArgument, "asset asset1 is listed more than once")
+	requireCode(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset2.1"}, "asset3")), chaincode.ErrAssetExists, "the asset asset3 already exists")
+	requireCode(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset2"}, "asset4")), chaincode.ErrInvalidStatus, "the asset asset2 is retired")
+
+	require.NoError(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset2.1"}, "asset4")))
+	require.Equal(t, "AssetsMerged", stub.Event().EventName)
+	var lineage chaincode.AssetLineage
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &lineage))
+	require.Len(t, lineage.StatusChanges, 2)
+	require.Equal(t, "asset1", lineage.StatusChanges[0].AssetID)
+	require.Equal(t, "asset2.1", lineage.StatusChanges[1].AssetID)
+	require.Equal(t, "merged into asset4", lineage.StatusChanges[1].Reason)
+	merged, err := assetTransfer.ReadAsset(ctx, "asset4")
+	require.NoError(t, err)
+	require.Equal(t, owner, merged.Owner)
+	require.Equal(t, 7, merged.Size)
+	require.Equal(t, []string{"asset1", "asset2.1"}, merged.Parents)
+	appraisal, err := assetTransfer.ReadAppraisal(ctx, "asset4")
+	require.NoError(t, err)
+	require.Equal(t, 200, appraisal.AppraisedValue)
+	for _, id := range []string{"asset1", "asset2.1"} {
+		parent, err := assetTransfer.ReadAsset(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, chaincode.StatusRetired, parent.Status)
+		require.Equal(t, []string{"asset4"}, parent.Children)
+	}
+
+	// provenance follows the links back through the split
+	ancestors, err := assetTransfer.GetProvenance(ctx, "asset4")
+	require.NoError(t, err)
+	var ids []string
+	for _, ancestor := range ancestors {
+		ids = append(ids, ancestor.ID)
+	}
+	require.Equal(t, []string{"asset1", "asset2.1", "asset2"}, ids)
+	ancestors, err = assetTransfer.GetProvenance(ctx, "asset3")
+	require.NoError(t, err)
+	require.Empty(t, ancestors)
+}
@@ -0,0 +1,286 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Approvals of the ERC-721 interface. An approval is for one asset and ends
+// when the asset changes hands; an operator may act for every asset of an
+// owner until the owner revokes it.
+const (
+	nftApprovalObjectType = "nft~approval"
+	nftOperatorObjectType = "nft~operator"
+)
+
+// The events are named apart from those of TokenContract, which share the
+// chaincode.
+const (
+	nftTransferEvent       = "NFTTransfer"
+	nftApprovalEvent       = "NFTApproval"
+	nftApprovalForAllEvent = "NFTApprovalForAll"
+)
+
+// NFTContract exposes the assets as ERC-721 style non-fungible tokens. The
+// token ID of an asset is its ID, and the tokens are the Asset records
+// themselves, so both interfaces always agree.
+type NFTContract struct {
+	Contract
+}
+
+// NFTTransferEvent is the payload of the NFTTransfer event.
+type NFTTransferEvent struct {
+	From    string `json:"From"`
+	To      string `json:"To"`
+	TokenID string `json:"TokenID"`
+}
+
+// NFTApprovalEvent is the payload of the NFTApproval event.
+type NFTApprovalEvent struct {
+	Approved string `json:"Approved"`
+	Owner    string `json:"Owner"`
+	TokenID  string `json:"TokenID"`
+}
+
+// NFTApprovalForAllEvent is the payload of the NFTApprovalForAll event.
+type NFTApprovalForAllEvent struct {
+	Approved bool   `json:"Approved"`
+	Operator string `json:"Operator"`
+	Owner    string `json:"Owner"`
+}
+
+// GetName returns the name the token transactions are called under, e.g.
+// nft:OwnerOf.
+func (n *NFTContract) GetName() string {
+	return "nft"
+}
+
+// OwnerOf returns the owner of an asset.
+func (n *NFTContract) OwnerOf(ctx contractapi.TransactionContextInterface, tokenID string) (string, error) {
+	asset, err := readAsset(ctx, tokenID)
+	if err != nil {
+		return "", err
+	}
+	return asset.Owner, nil
+}
+
+// BalanceOf returns the number of assets a client identity owns as tokens,
+// leaving out retired assets, which keep their owner on record, and
+// fractionalized ones, which are held as shares. It reads the owner index, so
+// assets written before the index existed only count once they are next
+// changed.
+func (n *NFTContract) BalanceOf(ctx contractapi.TransactionContextInterface, owner string) (int, error) {
+	assets, err := heldAssets(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	balance := 0
+	for _, asset := range assets {
+		if asset.TotalShares == 0 {
+			balance++
+		}
+	}
+	return balance, nil
+}
+
+// Approve lets approved transfer an asset with TransferFrom, in place of any
+// earlier approval. Pass an empty approved to revoke it. The owner, an admin
+// of the owner's org or an operator of the owner can call it.
+func (n *NFTContract) Approve(ctx contractapi.TransactionContextInterface, approved string, tokenID string) error {
+	asset, err := readAsset(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if err := requireWhole(asset); err != nil {
+		return err
+	}
+	if _, err := authorizeOwnerOrOperator(ctx, asset); err != nil {
+		return err
+	}
+	if approved == asset.Owner {
+		return invalidArgument("%s already owns asset %s", approved, tokenID)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(nftApprovalObjectType, []string{tokenID})
+	if err != nil {
+		return err
+	}
+	if approved == "" {
+		err = ctx.GetStub().DelState(key)
+	} else {
+		err = ctx.GetStub().PutState(key, []byte(approved))
+	}
+	if err != nil {
+		return err
+	}
+	return setTokenEvent(ctx, nftApprovalEvent, NFTApprovalEvent{Approved: approved, Owner: asset.Owner, TokenID: tokenID})
+}
+
+// GetApproved returns the client approved to transfer an asset, or an empty
+// string if there is none.
+func (n *NFTContract) GetApproved(ctx contractapi.TransactionContextInterface, tokenID string) (string, error) {
+	if _, err := readAsset(ctx, tokenID); err != nil {
+		return "", err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(nftApprovalObjectType, []string{tokenID})
+	if err != nil {
+		return "", err
+	}
+	approved, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", stateReadFailed(err)
+	}
+	return string(approved), nil
+}
+
+// SetApprovalForAll lets operator, or stops it from, transferring and
+// approving every asset of the caller.
+func (n *NFTContract) SetApprovalForAll(ctx contractapi.TransactionContextInterface, operator string, approved bool) error {
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	if operator == caller {
+		return invalidArgument("cannot approve yourself as operator")
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(nftOperatorObjectType, []string{caller, operator})
+	if err != nil {
+		return err
+	}
+	if approved {
+		err = ctx.GetStub().PutState(key, []byte{0x00})
+	} else {
+		err = ctx.GetStub().DelState(key)
+	}
+	if err != nil {
+		return err
+	}
+	return setTokenEvent(ctx, nftApprovalForAllEvent, NFTApprovalForAllEvent{Approved: approved, Operator: operator, Owner: caller})
+}
+
+// IsApprovedForAll reports whether operator may act for every asset of owner.
+func (n *NFTContract) IsApprovedForAll(ctx contractapi.TransactionContextInterface, owner string, operator string) (bool, error) {
+	return isOperator(ctx, owner, operator)
+}
+
+// TransferFrom transfers an active asset from its owner from to to, a client
+// identity as returned by WhoAmI. As with TransferAsset, the owner and to must
+// have agreed on a price with AgreeToSell and AgreeToBuy. The owner, an admin
+// of the owner's org, the client approved for the asset or an operator of the
+// owner can call it. The new owner sets their owner name with UpdateAsset.
+func (n *NFTContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, tokenID string) error {
+	asset, err := readAsset(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if err := requireWhole(asset); err != nil {
+		return err
+	}
+	if asset.Owner != from {
+		return invalidArgument("%s does not own asset %s", from, tokenID)
+	}
+	if _, isIdentity := ownerMSPID(to); !isIdentity {
+		return invalidArgument("recipient %s is not a client identity", to)
+	}
+	if to == from {
+		return invalidArgument("%s already owns asset %s", to, tokenID)
+	}
+	if _, err := authorizeOwnerOrOperator(ctx, asset); err != nil {
+		approved, approvedErr := n.GetApproved(ctx, tokenID)
+		if approvedErr != nil {
+			return approvedErr
+		}
+		caller, callerErr := submittingClient(ctx)
+		if callerErr != nil {
+			return callerErr
+		}
+		if approved != caller {
+			return err
+		}
+	}
+	if err := releaseExpiredOffer(ctx, asset); err != nil {
+		return err
+	}
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return err
+	}
+	if err := requireTransferAllowed(ctx, tokenID, to); err != nil {
+		return err
+	}
+	if err := settleAgreement(ctx, asset, to); err != nil {
+		return err
+	}
+
+	if err := dropOwnerGrants(ctx, tokenID); err != nil {
+		return err
+	}
+	old := *asset
+	asset.Owner = to
+	asset.OwnerName = ""
+	asset.AppraisedValue = 0
+	if err := putAsset(ctx, &old, asset); err != nil {
+		return err
+	}
+	return setTokenEvent(ctx, nftTransferEvent, NFTTransferEvent{From: from, To: to, TokenID: tokenID})
+}
+
+// TokenURI returns the URI of the metadata of an asset.
+func (n *NFTContract) TokenURI(ctx contractapi.TransactionContextInterface, tokenID string) (string, error) {
+	asset, err := readAsset(ctx, tokenID)
+	if err != nil {
+		return "", err
+	}
+	return asset.TokenURI, nil
+}
+
+// SetTokenURI sets the URI of the metadata of an active asset. Only the owner
+// or an admin of the owner's org can call it.
+func (n *NFTContract) SetTokenURI(ctx contractapi.TransactionContextInterface, tokenID string, uri string) error {
+	asset, err := readAsset(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return err
+	}
+	old := *asset
+	asset.TokenURI = uri
+	return putAsset(ctx, &old, asset)
+}
+
+// authorizeOwnerOrOperator is authorizeOwner, which also lets through the
+// operators of the owner.
+func authorizeOwnerOrOperator(ctx contractapi.TransactionContextInterface, asset *Asset) (string, error) {
+	caller, err := authorizeOwner(ctx, asset)
+	if err == nil || !IsAccessDenied(err) {
+		return caller, err
+	}
+	caller, callerErr := submittingClient(ctx)
+	if callerErr != nil {
+		return "", callerErr
+	}
+	operator, operatorErr := isOperator(ctx, asset.Owner, caller)
+	if operatorErr != nil {
+		return "", operatorErr
+	}
+	if !operator {
+		return "", err
+	}
+	return caller, nil
+}
+
+func isOperator(ctx contractapi.TransactionContextInterface, owner string, operator string) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(nftOperatorObjectType, []string{owner, operator})
+	if err != nil {
+		return false, err
+	}
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, stateReadFailed(err)
+	}
+	return value != nil, nil
+}
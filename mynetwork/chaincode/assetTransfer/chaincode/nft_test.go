@@ -0,0 +1,123 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTApprovals(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	nft := chaincode.NFTContract{}
+	approved := setCaller(t, ctx, stub, "Org3MSP", "Broker@org3.guolong.com", "client")
+	operator := setCaller(t, ctx, stub, "Org3MSP", "Custodian@org3.guolong.com", "client")
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	appraise(stub, 400)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset2", "red", 5, "Seller")))
+
+	tokenOwner, err := nft.OwnerOf(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, owner, tokenOwner)
+	balance, err := nft.BalanceOf(ctx, owner)
+	require.NoError(t, err)
+	require.Equal(t, 2, balance)
+	_, err = nft.OwnerOf(ctx, "asset3")
+	requireCode(t, err, chaincode.ErrAssetNotFound, "the asset asset3 does not exist")
+
+	// a client approved for one asset can transfer that asset only
+	require.NoError(t, ctx.end(nft.Approve(ctx, approved, "asset1")))
+	require.Equal(t, "NFTApproval", stub.Event().EventName)
+	setCaller(t, ctx, stub, "Org3MSP", "Broker@org3.guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(nft.TransferFrom(ctx, owner, recipient, "asset2"))))
+	requireCode(t, ctx.end(nft.TransferFrom(ctx, recipient, approved, "asset1")), chaincode.ErrInvalidArgument, recipient+" does not own asset asset1")
+
+	// like any transfer, it settles a price the owner and recipient agreed to
+	requireCode(t, ctx.end(nft.TransferFrom(ctx, owner, recipient, "asset1")), chaincode.ErrInvalidStatus, recipient+" has not agreed to buy asset asset1")
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	agreeOnPrice(t, ctx, stub, "asset1", 500, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	agreeOnPrice(t, ctx, stub, "asset2", 600, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org3MSP", "Broker@org3.guolong.com", "client")
+	require.NoError(t, ctx.end(nft.TransferFrom(ctx, owner, recipient, "asset1")))
+	require.Equal(t, "NFTTransfer", stub.Event().EventName)
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, recipient, asset.Owner)
+	current, err := nft.GetApproved(ctx, "asset1")
+	require.NoError(t, err)
+	require.Empty(t, current, "the approval ends with the transfer")
+	appraisalJSON, err := stub.GetPrivateData("_implicit_org_Org1MSP", "asset1")
+	require.NoError(t, err)
+	require.Nil(t, appraisalJSON, "the seller's org drops the appraisal")
+
+	// an operator acts for every asset of the owner
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	requireCode(t, ctx.end(nft.SetApprovalForAll(ctx, owner, true)), chaincode.ErrInvalidArgument, "cannot approve yourself as operator")
+	require.NoError(t, ctx.end(nft.SetApprovalForAll(ctx, operator, true)))
+	isOperator, err := nft.IsApprovedForAll(ctx, owner, operator)
+	require.NoError(t, err)
+	require.True(t, isOperator)
+	setCaller(t, ctx, stub, "Org3MSP", "Custodian@org3.guolong.com", "client")
+	require.NoError(t, ctx.end(nft.Approve(ctx, approved, "asset2")))
+	require.NoError(t, ctx.end(nft.TransferFrom(ctx, owner, recipient, "asset2")))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	require.NoError(t, ctx.end(nft.SetApprovalForAll(ctx, operator, false)))
+	isOperator, err = nft.IsApprovedForAll(ctx, owner, operator)
+	require.NoError(t, err)
+	require.False(t, isOperator)
+	balance, err = nft.BalanceOf(ctx, recipient)
+	require.NoError(t, err)
+	require.Equal(t, 2, balance)
+}
+
+func TestNFTBalance(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	nft := chaincode.NFTContract{}
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	for _, id := range []string{"asset1", "asset2", "asset3"} {
+		appraise(stub, 300)
+		require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, id, "blue", 5, "Seller")))
+	}
+	require.NoError(t, ctx.end(assetTransfer.LockAsset(ctx, "asset1", "sale pending")))
+
+	// retired and fractionalized assets are not tokens of the owner
+	require.NoError(t, ctx.end(assetTransfer.RetireAsset(ctx, "asset2", "out of use")))
+	require.NoError(t, ctx.end(assetTransfer.FractionalizeAsset(ctx, "asset3", 100, 60)))
+	balance, err := nft.BalanceOf(ctx, owner)
+	require.NoError(t, err)
+	require.Equal(t, 1, balance)
+}
+
+func TestTokenURI(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	nft := chaincode.NFTContract{}
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+
+	require.NoError(t, ctx.end(nft.SetTokenURI(ctx, "asset1", "ipfs://asset1.json")))
+	uri, err := nft.TokenURI(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, "ipfs://asset1.json", uri)
+
+	// the URI is part of the asset, and survives updates
+	stub.SetTransient(nil)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, "ipfs://asset1.json", asset.TokenURI)
+
+	// locked assets cannot be transferred
+	require.NoError(t, ctx.end(assetTransfer.LockAsset(ctx, "asset1", "sale pending")))
+	requireCode(t, ctx.end(nft.TransferFrom(ctx, owner, recipient, "asset1")), chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(nft.SetTokenURI(ctx, "asset1", "ipfs://mine.json"))))
+}
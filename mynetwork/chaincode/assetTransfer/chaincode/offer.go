@@ -0,0 +1,361 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// An offer is kept under the asset it is for, and indexed by the identities
+// that made and received it.
+const (
+	offerObjectType     = "asset~offer"
+	offerOwnerIndex     = "offer~owner"
+	offerRecipientIndex = "offer~recipient"
+)
+
+const (
+	transferOfferedEvent  = "TransferOffered"
+	transferAcceptedEvent = "TransferAccepted"
+	offerCancelledEvent   = "OfferCancelled"
+)
+
+// Offer is an offer of the owner to transfer an asset to Recipient, which
+// Recipient can accept until Expiry, an RFC 3339 time. StatusChange is only
+// set in the events, to the change of the asset's status that came with them.
+type Offer struct {
+	AssetID      string        `json:"AssetID"`
+	Expiry       string        `json:"Expiry"`
+	Owner        string        `json:"Owner"`
+	Recipient    string        `json:"Recipient"`
+	StatusChange *StatusChange `json:"StatusChange,omitempty" metadata:",optional"`
+	TxID         string        `json:"TxID"`
+}
+
+// OfferTransfer offers to transfer an active asset to recipient, a client
+// identity as returned by WhoAmI, until expiry, an RFC 3339 time. The asset is
+// locked until the offer is accepted or cancelled. Only the owner or an admin
+// of the owner's org can call it.
+func (a *AssetContract) OfferTransfer(ctx contractapi.TransactionContextInterface, id string, recipient string, expiry string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireWhole(asset); err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if _, isIdentity := ownerMSPID(recipient); !isIdentity {
+		return invalidArgument("recipient %s is not a client identity", recipient)
+	}
+	if recipient == asset.Owner {
+		return invalidArgument("%s already owns asset %s", recipient, id)
+	}
+	expiryTime, err := parseDeadline(ctx, "expiry", expiry)
+	if err != nil {
+		return err
+	}
+	if err := releaseExpiredOffer(ctx, asset); err != nil {
+		return err
+	}
+	change, err := changeStatus(ctx, asset, StatusLocked, "transfer offered to "+recipient, StatusActive)
+	if err != nil {
+		return err
+	}
+
+	offer := &Offer{
+		AssetID:   id,
+		Expiry:    expiryTime.UTC().Format(time.RFC3339),
+		Owner:     asset.Owner,
+		Recipient: recipient,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	if err := putOffer(ctx, offer); err != nil {
+		return err
+	}
+	return setOfferEvent(ctx, transferOfferedEvent, offer, change)
+}
+
+// AcceptTransfer accepts the offer of an asset before it expires, making the
+// caller the owner, shown as ownerName. Only the recipient of the offer can
+// call it. The appraisal stays with the old owner's org; the new owner records
+// their own with UpdateAsset.
+func (a *AssetContract) AcceptTransfer(ctx contractapi.TransactionContextInterface, id string, ownerName string) error {
+	offer, err := readOffer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if offer == nil {
+		return invalidStatus(id, "there is no offer of asset %s", id)
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	if caller != offer.Recipient {
+		return &AccessDeniedError{Caller: caller, Reason: "is not the recipient of the offer of asset " + id}
+	}
+	expired, err := offerExpired(ctx, offer)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return invalidStatus(id, "the offer of asset %s expired at %s", id, offer.Expiry)
+	}
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireStatus(asset, StatusLocked); err != nil {
+		return err
+	}
+	if err := requireTransferAllowed(ctx, id, caller); err != nil {
+		return err
+	}
+
+	if err := deleteOffer(ctx, offer); err != nil {
+		return err
+	}
+	change, err := handOver(ctx, asset, caller, ownerName, "transfer accepted")
+	if err != nil {
+		return err
+	}
+	return setOfferEvent(ctx, transferAcceptedEvent, offer, change)
+}
+
+// CancelOffer withdraws the offer of an asset and unlocks it. Only the owner
+// or an admin of the owner's org can call it.
+func (a *AssetContract) CancelOffer(ctx contractapi.TransactionContextInterface, id string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	offer, err := readOffer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if offer == nil {
+		return invalidStatus(id, "there is no offer of asset %s", id)
+	}
+	return cancelOffer(ctx, asset, offer, "offer cancelled")
+}
+
+// GetIncomingOffers returns the offers made to a client identity that have
+// not expired.
+func (q *QueryContract) GetIncomingOffers(ctx contractapi.TransactionContextInterface, recipient string) ([]*Offer, error) {
+	return offersByIndex(ctx, offerRecipientIndex, recipient)
+}
+
+// GetOutgoingOffers returns the offers made by a client identity that have not
+// expired.
+func (q *QueryContract) GetOutgoingOffers(ctx contractapi.TransactionContextInterface, owner string) ([]*Offer, error) {
+	return offersByIndex(ctx, offerOwnerIndex, owner)
+}
+
+// handOver gives a locked asset to newOwner and makes it active again. It
+// returns the change of status.
+func handOver(ctx contractapi.TransactionContextInterface, asset *Asset, newOwner string, ownerName string, reason string) (*StatusChange, error) {
+	if err := dropOwnerGrants(ctx, asset.ID); err != nil {
+		return nil, err
+	}
+	old := *asset
+	asset.Owner = newOwner
+	asset.OwnerName = ownerName
+	asset.AppraisedValue = 0
+	if err := putAsset(ctx, &old, asset); err != nil {
+		return nil, err
+	}
+	return changeStatus(ctx, asset, StatusActive, reason, StatusLocked)
+}
+
+// releaseExpiredOffer cancels the offer of asset if it expired, so that
+// expired offers go away the next time the owner changes the asset.
+func releaseExpiredOffer(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	offer, err := readOffer(ctx, asset.ID)
+	if err != nil || offer == nil {
+		return err
+	}
+	expired, err := offerExpired(ctx, offer)
+	if err != nil || !expired {
+		return err
+	}
+	return cancelOffer(ctx, asset, offer, "offer expired")
+}
+
+// cancelOffer removes an offer and unlocks the asset, unless a regulator froze
+// it meanwhile.
+func cancelOffer(ctx contractapi.TransactionContextInterface, asset *Asset, offer *Offer, reason string) error {
+	if err := deleteOffer(ctx, offer); err != nil {
+		return err
+	}
+	var change *StatusChange
+	if assetStatus(asset) == StatusLocked {
+		var err error
+		if change, err = changeStatus(ctx, asset, StatusActive, reason, StatusLocked); err != nil {
+			return err
+		}
+	}
+	return setOfferEvent(ctx, offerCancelledEvent, offer, change)
+}
+
+func readOffer(ctx contractapi.TransactionContextInterface, id string) (*Offer, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(offerObjectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	offerJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if offerJSON == nil {
+		return nil, nil
+	}
+
+	var offer Offer
+	if err := json.Unmarshal(offerJSON, &offer); err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+func putOffer(ctx contractapi.TransactionContextInterface, offer *Offer) error {
+	offerJSON, err := json.Marshal(offer)
+	if err != nil {
+		return err
+	}
+	keys, err := offerKeys(ctx, offer)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(keys[0], offerJSON); err != nil {
+		return err
+	}
+	for _, key := range keys[1:] {
+		if err := ctx.GetStub().PutState(key, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteOffer(ctx contractapi.TransactionContextInterface, offer *Offer) error {
+	keys, err := offerKeys(ctx, offer)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// offerKeys returns the key of an offer followed by its index entries.
+func offerKeys(ctx contractapi.TransactionContextInterface, offer *Offer) ([]string, error) {
+	offerKey, err := ctx.GetStub().CreateCompositeKey(offerObjectType, []string{offer.AssetID})
+	if err != nil {
+		return nil, err
+	}
+	ownerKey, err := ctx.GetStub().CreateCompositeKey(offerOwnerIndex, []string{offer.Owner, offer.AssetID})
+	if err != nil {
+		return nil, err
+	}
+	recipientKey, err := ctx.GetStub().CreateCompositeKey(offerRecipientIndex, []string{offer.Recipient, offer.AssetID})
+	if err != nil {
+		return nil, err
+	}
+	return []string{offerKey, ownerKey, recipientKey}, nil
+}
+
+func offersByIndex(ctx contractapi.TransactionContextInterface, index string, identity string) ([]*Offer, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, []string{identity})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	offers := []*Offer{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		offer, err := readOffer(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if offer == nil {
+			continue
+		}
+		expired, err := offerExpired(ctx, offer)
+		if err != nil {
+			return nil, err
+		}
+		if !expired {
+			offers = append(offers, offer)
+		}
+	}
+	return offers, nil
+}
+
+func offerExpired(ctx contractapi.TransactionContextInterface, offer *Offer) (bool, error) {
+	expiry, err := time.Parse(time.RFC3339, offer.Expiry)
+	if err != nil {
+		return false, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+	return !now.Before(expiry), nil
+}
+
+func setOfferEvent(ctx contractapi.TransactionContextInterface, name string, offer *Offer, change *StatusChange) error {
+	event := *offer
+	event.StatusChange = change
+	offerJSON, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(name, offerJSON)
+}
+
+// parseDeadline parses an RFC 3339 time, which must be after the transaction
+// time. what names it in errors.
+func parseDeadline(ctx contractapi.TransactionContextInterface, what string, value string) (time.Time, error) {
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, invalidArgument("the %s must be an RFC 3339 time: %v", what, err)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !deadline.After(now) {
+		return time.Time{}, invalidArgument("the %s %s is not after the transaction time %s", what, value, now.Format(time.RFC3339))
+	}
+	return deadline, nil
+}
+
+// txTime returns the time of the transaction, which the client sets and every
+// endorser sees the same, unlike the clock of the peer.
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return timestamp.AsTime(), nil
+}
@@ -0,0 +1,133 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferOffer(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	other := setCaller(t, ctx, stub, "Org3MSP", "Other@org3.guolong.com", "client")
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+
+	requireCode(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", "Buyer", "2024-01-02T00:00:00Z")), chaincode.ErrInvalidArgument, "recipient Buyer is not a client identity")
+	requireCode(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", owner, "2024-01-02T00:00:00Z")), chaincode.ErrInvalidArgument, owner+" already owns asset asset1")
+	require.Error(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", recipient, "tomorrow")))
+	requireCode(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", recipient, "2023-12-31T00:00:00Z")), chaincode.ErrInvalidArgument, "the expiry 2023-12-31T00:00:00Z is not after the transaction time 2024-01-01T00:00:00Z")
+
+	stub.StartTransaction("tx-offer")
+	require.NoError(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", recipient, "2024-01-02T00:00:00Z")))
+	require.Equal(t, "TransferOffered", stub.Event().EventName)
+	offer := &chaincode.Offer{AssetID: "asset1", Expiry: "2024-01-02T00:00:00Z", Owner: owner, Recipient: recipient, TxID: "tx-offer"}
+	// the event carries the locking of the asset, as it replaces the status event
+	var offered chaincode.Offer
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &offered))
+	require.Equal(t, &chaincode.StatusChange{AssetID: "asset1", By: owner, From: "Active", Reason: "transfer offered to " + recipient, To: "Locked", TxID: "tx-offer"}, offered.StatusChange)
+	outgoing, err := assetTransfer.GetOutgoingOffers(ctx, owner)
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Offer{offer}, outgoing)
+	incoming, err := assetTransfer.GetIncomingOffers(ctx, recipient)
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Offer{offer}, incoming)
+	incoming, err = assetTransfer.GetIncomingOffers(ctx, other)
+	require.NoError(t, err)
+	require.Empty(t, incoming)
+
+	// the asset is locked while the offer is pending
+	requireCode(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller")), chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+	requireCode(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", other, "2024-01-02T00:00:00Z")), chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+
+	setCaller(t, ctx, stub, "Org3MSP", "Other@org3.guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.AcceptTransfer(ctx, "asset1", "Other"))))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.CancelOffer(ctx, "asset1"))))
+
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	stub.StartTransaction("tx-accept")
+	require.NoError(t, ctx.end(assetTransfer.AcceptTransfer(ctx, "asset1", "Buyer")))
+	require.Equal(t, "TransferAccepted", stub.Event().EventName)
+	var accepted chaincode.Offer
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &accepted))
+	require.Equal(t, &chaincode.StatusChange{AssetID: "asset1", By: recipient, From: "Locked", Reason: "transfer accepted", To: "Active", TxID: "tx-accept"}, accepted.StatusChange)
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, recipient, asset.Owner)
+	require.Equal(t, "Buyer", asset.OwnerName)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	owned, err := assetTransfer.QueryAssetsByOwner(ctx, owner)
+	require.NoError(t, err)
+	require.Empty(t, owned)
+	outgoing, err = assetTransfer.GetOutgoingOffers(ctx, owner)
+	require.NoError(t, err)
+	require.Empty(t, outgoing)
+	requireCode(t, ctx.end(assetTransfer.AcceptTransfer(ctx, "asset1", "Buyer")), chaincode.ErrInvalidStatus, "there is no offer of asset asset1")
+}
+
+func TestCancelOffer(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	requireCode(t, ctx.end(assetTransfer.CancelOffer(ctx, "asset1")), chaincode.ErrInvalidStatus, "there is no offer of asset asset1")
+
+	require.NoError(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", recipient, "2024-01-02T00:00:00Z")))
+	require.NoError(t, ctx.end(assetTransfer.CancelOffer(ctx, "asset1")))
+	require.Equal(t, "OfferCancelled", stub.Event().EventName)
+	var cancelled chaincode.Offer
+	require.NoError(t, json.Unmarshal(stub.Event().Payload, &cancelled))
+	require.Equal(t, "Active", cancelled.StatusChange.To)
+	require.Equal(t, "offer cancelled", cancelled.StatusChange.Reason)
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	require.Equal(t, "offer cancelled", asset.StatusReason)
+
+	// unlocking the asset withdraws the offer too
+	require.NoError(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", recipient, "2024-01-02T00:00:00Z")))
+	require.NoError(t, ctx.end(assetTransfer.UnlockAsset(ctx, "asset1", "changed my mind")))
+	incoming, err := assetTransfer.GetIncomingOffers(ctx, recipient)
+	require.NoError(t, err)
+	require.Empty(t, incoming)
+
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.AcceptTransfer(ctx, "asset1", "Buyer")), chaincode.ErrInvalidStatus, "there is no offer of asset asset1")
+}
+
+func TestExpiredOffer(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	require.NoError(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset1", recipient, "2024-01-01T01:00:00Z")))
+
+	stub.SetTxTimestamp(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC))
+	outgoing, err := assetTransfer.GetOutgoingOffers(ctx, owner)
+	require.NoError(t, err)
+	require.Empty(t, outgoing, "expired offers are not listed")
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.AcceptTransfer(ctx, "asset1", "Buyer")), chaincode.ErrInvalidStatus, "the offer of asset asset1 expired at 2024-01-01T01:00:00Z")
+
+	// the next change by the owner cancels the expired offer
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	stub.SetTransient(nil)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	require.Equal(t, "offer expired", asset.StatusReason)
+	requireCode(t, ctx.end(assetTransfer.CancelOffer(ctx, "asset1")), chaincode.ErrInvalidStatus, "there is no offer of asset asset1")
+}
@@ -0,0 +1,90 @@
+package chaincode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// orgAdminOU is the NodeOU of org admin certificates in this network.
+const orgAdminOU = "admin"
+
+// ownerMSPID returns the MSP of an owner recorded as a client identity. Owners
+// written before identities were enforced are free-text names and have none.
+func ownerMSPID(owner string) (string, bool) {
+	mspID, _, found := strings.Cut(owner, "::")
+	return mspID, found
+}
+
+// authorizeOwner is the guard for transactions that change or remove an asset.
+// It lets the owner through, as well as admins of the owner's org. A legacy
+// owner cannot be matched to a client or an org, so only the contract owner
+// may act on it.
+//
+// A fractionalized asset has no single owner; see authorizeShareholders.
+//
+// It returns the caller, who takes custody when migrateOwner runs on a legacy
+// asset.
+func authorizeOwner(ctx contractapi.TransactionContextInterface, asset *Asset) (string, error) {
+	if asset.TotalShares > 0 {
+		return authorizeShareholders(ctx, asset)
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	if caller == asset.Owner {
+		return caller, nil
+	}
+
+	callerMSPID, _ := ownerMSPID(caller)
+	mspID, isIdentity := ownerMSPID(asset.Owner)
+	switch {
+	case !isIdentity:
+		owner, err := contractOwner(ctx)
+		if err != nil {
+			return "", err
+		}
+		if caller == owner {
+			return caller, nil
+		}
+	case mspID == callerMSPID:
+		isAdmin, err := isOrgAdmin(ctx)
+		if err != nil {
+			return "", err
+		}
+		if isAdmin {
+			return caller, nil
+		}
+	}
+	return "", &AccessDeniedError{Caller: caller, Code: ErrNotOwner, Reason: fmt.Sprintf("is not the owner of asset %s", asset.ID)}
+}
+
+// migrateOwner moves a legacy free-text owner into OwnerName and records the
+// caller, the contract owner by then, as the owner.
+func migrateOwner(asset *Asset, caller string) {
+	if _, isIdentity := ownerMSPID(asset.Owner); isIdentity {
+		return
+	}
+	if asset.OwnerName == "" {
+		asset.OwnerName = asset.Owner
+	}
+	asset.Owner = caller
+}
+
+func isOrgAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return false, fmt.Errorf("failed to get client certificate: %v", err)
+	}
+	if cert == nil {
+		return false, nil
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if ou == orgAdminOU {
+			return true, nil
+		}
+	}
+	return false, nil
+}
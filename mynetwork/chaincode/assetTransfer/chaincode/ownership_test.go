@@ -0,0 +1,98 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnerEnforcement(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	maxOwner := setCaller(t, ctx, stub, "Org2MSP", "Max@org2.guolong.com", "client")
+	tomoko := setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, tomoko, asset.Owner)
+
+	// another client of the same org, and an admin of another org
+	for _, caller := range [][]string{{"Org1MSP", "User2@guolong.com", "client"}, {"Org2MSP", "Admin@org2.guolong.com", "admin"}} {
+		intruder := setCaller(t, ctx, stub, caller[0], caller[1], caller[2])
+		denied := fmt.Sprintf("access denied: %s is not the owner of asset asset1", intruder)
+		requireCode(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Tomoko")), chaincode.ErrNotOwner, denied)
+		requireCode(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset1")), chaincode.ErrNotOwner, denied)
+		_, err = assetTransfer.TransferAsset(ctx, "asset1", intruder, "Intruder")
+		ctx.end(err)
+		requireCode(t, err, chaincode.ErrNotOwner, denied)
+		require.True(t, chaincode.IsAccessDenied(err))
+	}
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Tomoko Y.")))
+	agreeOnPrice(t, ctx, stub, "asset1", 500, "Org2MSP", "Max@org2.guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", maxOwner, "Max")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.DeleteAsset(ctx, "asset1"))), "the old owner has no rights left")
+
+	// the admin of the owner's org
+	setCaller(t, ctx, stub, "Org2MSP", "Admin@org2.guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "green", 5, "Max")))
+	asset, err = assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, maxOwner, asset.Owner)
+	require.NoError(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset1")))
+}
+
+func TestLegacyOwnerMigration(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	require.NoError(t, stub.PutState("asset1", []byte(`{"AppraisedValue":300,"Color":"blue","ID":"asset1","Owner":"Tomoko","Size":5}`)))
+	require.NoError(t, stub.PutState("asset2", []byte(`{"AppraisedValue":400,"Color":"red","ID":"asset2","Owner":"Brad","Size":5}`)))
+	require.NoError(t, ctx.end(nil))
+
+	user := setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	appraise(stub, 350)
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "blue", 5, "Tomoko"))))
+	_, err := assetTransfer.TransferAsset(ctx, "asset1", user, "Tomoko")
+	ctx.end(err)
+	require.True(t, chaincode.IsAccessDenied(err))
+
+	// a legacy owner cannot be told apart from a client of another org, so
+	// org admins, of the contract owner's org or not, cannot take custody
+	for _, caller := range [][]string{{"Org2MSP", "Admin@org2.guolong.com"}, {"Org1MSP", "Admin2@guolong.com"}} {
+		intruder := setCaller(t, ctx, stub, caller[0], caller[1], "admin")
+		denied := fmt.Sprintf("access denied: %s is not the owner of asset asset1", intruder)
+		requireCode(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "blue", 5, "Tomoko")), chaincode.ErrNotOwner, denied)
+		_, err = assetTransfer.TransferAsset(ctx, "asset1", intruder, "Intruder")
+		ctx.end(err)
+		requireCode(t, err, chaincode.ErrNotOwner, denied)
+	}
+
+	// the contract owner takes custody of a legacy asset on first touch, and
+	// its public appraised value has to make way for a private appraisal
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	stub.SetTransient(nil)
+	requireCode(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "blue", 5, "Tomoko")), chaincode.ErrInvalidArgument, `the appraisal must be passed in the transient map under key "appraisal"`)
+	appraise(stub, 350)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Asset{ID: "asset1", Color: "blue", Size: 5, Owner: owner, OwnerName: "Tomoko", Status: chaincode.StatusActive, Category: "general", SchemaVersion: 2, UpdatedAt: "2024-01-01T00:00:01Z", AppraisalHash: appraisalHash("asset1", 350, "salt")}, asset)
+
+	agreeOnPrice(t, ctx, stub, "asset2", 500, "Org1MSP", "User1@guolong.com", "client")
+	oldOwner, err := assetTransfer.TransferAsset(ctx, "asset2", user, "Brad")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, "Brad", oldOwner)
+	asset, err = assetTransfer.ReadAsset(ctx, "asset2")
+	require.NoError(t, err)
+	require.Equal(t, user, asset.Owner)
+	require.Zero(t, asset.AppraisedValue)
+}
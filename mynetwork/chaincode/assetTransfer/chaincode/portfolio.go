@@ -0,0 +1,508 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Quotas are set by admins per owner, or per MSP for the owners of the MSP
+// without one of their own.
+const (
+	ownerQuotaObjectType = "quota~owner"
+	mspQuotaObjectType   = "quota~msp"
+)
+
+// Running totals the quotas are checked against, so that a check does not
+// read every asset of the owner. How many assets an owner holds is public.
+// Appraisals are private, so what they are worth is kept in the implicit
+// collection of the org that holds the appraisals, together with which owner
+// each appraisal counts for, by asset, and how much, by owner.
+//
+// The totals start with this version of the chaincode, and RecountPortfolio
+// counts what owners held before. An org that keeps the appraisal of an asset
+// another org took over, e.g. with AcceptTransfer, keeps counting it for the
+// old owner until an admin of the org recounts them.
+//
+// Each total is a single key per owner, so transactions that change what one
+// owner holds, e.g. two transfers to them, conflict if they land in the same
+// block: every one but the first fails validation with an MVCC read conflict
+// and has to be submitted again. Owners who take in many assets at once
+// should be fed in batches, as the totals are not sharded.
+const (
+	assetCountObjectType  = "portfolio~count"
+	valueTotalObjectType  = "portfolio~value"
+	valueHolderObjectType = "portfolio~holder"
+	heldValueObjectType   = "portfolio~held"
+)
+
+// Quota caps the assets an owner holds that are not retired, and what they
+// are worth by the appraisals of the owner's org. 0 is no cap.
+type Quota struct {
+	MaxAssets int `json:"MaxAssets"`
+	MaxValue  int `json:"MaxValue"`
+}
+
+// Portfolio is what an owner holds. TotalValue only counts the appraisals held
+// by the caller's org.
+type Portfolio struct {
+	AssetCount int      `json:"AssetCount"`
+	Assets     []*Asset `json:"Assets"`
+	Owner      string   `json:"Owner"`
+	TotalValue int      `json:"TotalValue"`
+}
+
+// SetOwnerQuota caps what owner, a client identity as returned by WhoAmI, can
+// hold, in place of the quota of their MSP. Passing 0 for both lifts it. Only
+// admins can call it.
+func (a *AdminContract) SetOwnerQuota(ctx contractapi.TransactionContextInterface, owner string, maxAssets int, maxValue int) error {
+	if _, isIdentity := ownerMSPID(owner); !isIdentity {
+		return invalidArgument("owner %s is not a client identity", owner)
+	}
+	return setQuota(ctx, ownerQuotaObjectType, owner, maxAssets, maxValue)
+}
+
+// SetMSPQuota caps what each owner of an MSP can hold, unless they have a
+// quota of their own. Passing 0 for both lifts it. Only admins can call it.
+func (a *AdminContract) SetMSPQuota(ctx contractapi.TransactionContextInterface, mspID string, maxAssets int, maxValue int) error {
+	if mspID == "" {
+		return invalidArgument("MSP ID must not be empty")
+	}
+	return setQuota(ctx, mspQuotaObjectType, mspID, maxAssets, maxValue)
+}
+
+// GetQuota returns the quota that applies to owner.
+func (q *QueryContract) GetQuota(ctx contractapi.TransactionContextInterface, owner string) (*Quota, error) {
+	return ownerQuota(ctx, owner)
+}
+
+// GetOwnerPortfolio returns the assets owner holds that are not retired, how
+// many there are and what they are worth by the appraisals the caller's org
+// holds.
+func (q *QueryContract) GetOwnerPortfolio(ctx contractapi.TransactionContextInterface, owner string) (*Portfolio, error) {
+	assets, err := heldAssets(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	portfolio := &Portfolio{AssetCount: len(assets), Assets: assets, Owner: owner}
+	for _, asset := range assets {
+		value, err := appraisedValue(ctx, collection, asset.ID)
+		if err != nil {
+			return nil, err
+		}
+		portfolio.TotalValue += value
+	}
+	return portfolio, nil
+}
+
+// RecountPortfolio sets the running totals of what owner holds from the
+// assets themselves, counting those written before the totals were kept. What
+// they are worth is recounted from the appraisals the caller's org holds. Only
+// admins can call it.
+func (a *AdminContract) RecountPortfolio(ctx contractapi.TransactionContextInterface, owner string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	return recountPortfolio(ctx, owner, nil)
+}
+
+// recountPortfolio sets the running totals of owner from the assets they hold
+// and pending, assets of owner the transaction writes, which it cannot read
+// back from the owner index.
+func recountPortfolio(ctx contractapi.TransactionContextInterface, owner string, pending []*Asset) error {
+	assets, err := heldAssets(ctx, owner)
+	if err != nil {
+		return err
+	}
+	held := map[string]bool{}
+	for _, asset := range assets {
+		held[asset.ID] = true
+	}
+	for _, asset := range pending {
+		if !held[asset.ID] && assetStatus(asset) != StatusRetired {
+			held[asset.ID] = true
+			assets = append(assets, asset)
+		}
+	}
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, heldValueObjectType, []string{owner})
+	if err != nil {
+		return stateReadFailed(err)
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+		if err := deleteHeldValue(ctx, collection, owner, attributes[1]); err != nil {
+			return err
+		}
+	}
+	totalValue := 0
+	for _, asset := range assets {
+		value, err := appraisedValue(ctx, collection, asset.ID)
+		if err != nil {
+			return err
+		}
+		if value > 0 {
+			if err := putHeldValue(ctx, collection, owner, asset.ID, value); err != nil {
+				return err
+			}
+			totalValue += value
+		}
+	}
+
+	if err := putCounter(ctx, "", assetCountObjectType, owner, len(assets)); err != nil {
+		return err
+	}
+	return putCounter(ctx, collection, valueTotalObjectType, owner, totalValue)
+}
+
+// countAssetChange updates the running totals for a write of asset, where old
+// is nil for a new asset. An appraisal the caller's org holds moves with the
+// asset. The quotas of an owner the write adds the asset to are checked
+// before anything is written.
+func countAssetChange(ctx contractapi.TransactionContextInterface, old *Asset, asset *Asset) error {
+	wasHeld := old != nil && assetStatus(old) != StatusRetired
+	isHeld := assetStatus(asset) != StatusRetired
+	added := isHeld && (!wasHeld || old.Owner != asset.Owner)
+
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return err
+	}
+	carried := 0
+	if added {
+		if err := requireAssetQuota(ctx, asset.Owner); err != nil {
+			return err
+		}
+		holder, err := valueHolder(ctx, collection, asset.ID)
+		if err != nil {
+			return err
+		}
+		if holder != asset.Owner {
+			if carried, err = appraisedValue(ctx, collection, asset.ID); err != nil {
+				return err
+			}
+		}
+		if err := requireValueQuota(ctx, collection, asset, carried); err != nil {
+			return err
+		}
+	}
+
+	if wasHeld && (!isHeld || old.Owner != asset.Owner) {
+		if _, err := addCounter(ctx, "", assetCountObjectType, old.Owner, -1); err != nil {
+			return err
+		}
+	}
+	if !added {
+		if isHeld {
+			return nil
+		}
+		return releaseAppraisal(ctx, collection, asset.ID)
+	}
+	if _, err := addCounter(ctx, "", assetCountObjectType, asset.Owner, 1); err != nil {
+		return err
+	}
+	if carried == 0 {
+		return nil
+	}
+	if err := releaseAppraisal(ctx, collection, asset.ID); err != nil {
+		return err
+	}
+	return countAppraisal(ctx, collection, asset, &Appraisal{AppraisedValue: carried})
+}
+
+// countDeletedAsset updates the asset counts for the deletion of asset.
+func countDeletedAsset(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	if assetStatus(asset) == StatusRetired {
+		return nil
+	}
+	_, err := addCounter(ctx, "", assetCountObjectType, asset.Owner, -1)
+	return err
+}
+
+// requireAssetQuota checks that owner can hold another asset.
+func requireAssetQuota(ctx contractapi.TransactionContextInterface, owner string) error {
+	quota, err := ownerQuota(ctx, owner)
+	if err != nil || quota.MaxAssets == 0 {
+		return err
+	}
+	count, err := readCounter(ctx, "", assetCountObjectType, owner)
+	if err != nil {
+		return err
+	}
+	if count+1 > quota.MaxAssets {
+		return quotaExceeded(owner, "MaxAssets", quota.MaxAssets, "%s would hold %d assets, the quota is %d", owner, count+1, quota.MaxAssets)
+	}
+	return nil
+}
+
+// requireValueQuota checks that the owner of asset can hold it at value, in
+// place of what its appraisal in collection counts for them now.
+func requireValueQuota(ctx contractapi.TransactionContextInterface, collection string, asset *Asset, value int) error {
+	quota, err := ownerQuota(ctx, asset.Owner)
+	if err != nil || quota.MaxValue == 0 {
+		return err
+	}
+	total, err := readCounter(ctx, collection, valueTotalObjectType, asset.Owner)
+	if err != nil {
+		return err
+	}
+	held, err := readCounter(ctx, collection, heldValueObjectType, asset.Owner, asset.ID)
+	if err != nil {
+		return err
+	}
+	if total = total - held + value; total > quota.MaxValue {
+		return quotaExceeded(asset.Owner, "MaxValue", quota.MaxValue, "the assets of %s would be worth %d, the quota is %d", asset.Owner, total, quota.MaxValue)
+	}
+	return nil
+}
+
+// countAppraisal counts the appraisal of asset in collection for its owner.
+func countAppraisal(ctx contractapi.TransactionContextInterface, collection string, asset *Asset, appraisal *Appraisal) error {
+	if err := putHeldValue(ctx, collection, asset.Owner, asset.ID, appraisal.AppraisedValue); err != nil {
+		return err
+	}
+	_, err := addCounter(ctx, collection, valueTotalObjectType, asset.Owner, appraisal.AppraisedValue)
+	return err
+}
+
+// releaseAppraisal stops counting the appraisal of an asset in collection for
+// the owner it counts for.
+func releaseAppraisal(ctx contractapi.TransactionContextInterface, collection string, id string) error {
+	holder, err := valueHolder(ctx, collection, id)
+	if err != nil || holder == "" {
+		return err
+	}
+	value, err := readCounter(ctx, collection, heldValueObjectType, holder, id)
+	if err != nil {
+		return err
+	}
+	if _, err := addCounter(ctx, collection, valueTotalObjectType, holder, -value); err != nil {
+		return err
+	}
+	return deleteHeldValue(ctx, collection, holder, id)
+}
+
+func setQuota(ctx contractapi.TransactionContextInterface, objectType string, subject string, maxAssets int, maxValue int) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if maxAssets < 0 || maxValue < 0 {
+		return invalidArgument("the quota must not be negative")
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{subject})
+	if err != nil {
+		return err
+	}
+	if maxAssets == 0 && maxValue == 0 {
+		return ctx.GetStub().DelState(key)
+	}
+	quotaJSON, err := json.Marshal(&Quota{MaxAssets: maxAssets, MaxValue: maxValue})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, quotaJSON)
+}
+
+func ownerQuota(ctx contractapi.TransactionContextInterface, owner string) (*Quota, error) {
+	mspID, _ := ownerMSPID(owner)
+	for _, scope := range [][]string{{ownerQuotaObjectType, owner}, {mspQuotaObjectType, mspID}} {
+		key, err := ctx.GetStub().CreateCompositeKey(scope[0], scope[1:])
+		if err != nil {
+			return nil, err
+		}
+		quotaJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return nil, stateReadFailed(err)
+		}
+		if quotaJSON == nil {
+			continue
+		}
+		var quota Quota
+		if err := json.Unmarshal(quotaJSON, &quota); err != nil {
+			return nil, err
+		}
+		return &quota, nil
+	}
+	return &Quota{}, nil
+}
+
+func quotaExceeded(owner string, quota string, limit int, format string, args ...interface{}) error {
+	details := map[string]string{"Owner": owner, "Quota": quota, "Limit": strconv.Itoa(limit)}
+	return newContractError(ErrQuotaExceeded, details, format, args...)
+}
+
+// heldAssets returns the assets of owner that are not retired.
+func heldAssets(ctx contractapi.TransactionContextInterface, owner string) ([]*Asset, error) {
+	owned, err := assetsByIndex(ctx, ownerIndex, owner)
+	if err != nil {
+		return nil, err
+	}
+	assets := []*Asset{}
+	for _, asset := range owned {
+		if assetStatus(asset) != StatusRetired {
+			assets = append(assets, asset)
+		}
+	}
+	return assets, nil
+}
+
+// appraisedValue returns the value of the appraisal collection holds of an
+// asset, or 0 if it holds none.
+func appraisedValue(ctx contractapi.TransactionContextInterface, collection string, id string) (int, error) {
+	appraisalJSON, err := ctx.GetStub().GetPrivateData(collection, id)
+	if err != nil {
+		return 0, stateReadFailed(err)
+	}
+	if appraisalJSON == nil {
+		return 0, nil
+	}
+	var appraisal Appraisal
+	if err := json.Unmarshal(appraisalJSON, &appraisal); err != nil {
+		return 0, err
+	}
+	return appraisal.AppraisedValue, nil
+}
+
+func valueHolder(ctx contractapi.TransactionContextInterface, collection string, id string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(valueHolderObjectType, []string{id})
+	if err != nil {
+		return "", err
+	}
+	holder, err := getPortfolioState(ctx, collection, key)
+	return string(holder), err
+}
+
+func putHeldValue(ctx contractapi.TransactionContextInterface, collection string, owner string, id string, value int) error {
+	key, err := ctx.GetStub().CreateCompositeKey(valueHolderObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	if err := putPortfolioState(ctx, collection, key, []byte(owner)); err != nil {
+		return err
+	}
+	return putCounter(ctx, collection, heldValueObjectType, owner, value, id)
+}
+
+func deleteHeldValue(ctx contractapi.TransactionContextInterface, collection string, owner string, id string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(valueHolderObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	if err := putPortfolioState(ctx, collection, key, nil); err != nil {
+		return err
+	}
+	return putCounter(ctx, collection, heldValueObjectType, owner, 0, id)
+}
+
+// addCounter adds delta to a counter and returns its new value. A counter is
+// not taken below 0, which it would for owners who held assets before the
+// counters were kept.
+func addCounter(ctx contractapi.TransactionContextInterface, collection string, objectType string, owner string, delta int) (int, error) {
+	value, err := readCounter(ctx, collection, objectType, owner)
+	if err != nil {
+		return 0, err
+	}
+	value = max(value+delta, 0)
+	return value, putCounter(ctx, collection, objectType, owner, value)
+}
+
+// readCounter reads a counter from collection, or the world state if
+// collection is empty. A counter that is not there is 0.
+func readCounter(ctx contractapi.TransactionContextInterface, collection string, objectType string, attributes ...string) (int, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return 0, err
+	}
+	value, err := getPortfolioState(ctx, collection, key)
+	if err != nil || value == nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(value))
+}
+
+// putCounter writes a counter, deleting it when it is 0.
+func putCounter(ctx contractapi.TransactionContextInterface, collection string, objectType string, owner string, value int, attributes ...string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, append([]string{owner}, attributes...))
+	if err != nil {
+		return err
+	}
+	if value == 0 {
+		return putPortfolioState(ctx, collection, key, nil)
+	}
+	return putPortfolioState(ctx, collection, key, []byte(strconv.Itoa(value)))
+}
+
+// getPortfolioState reads a key of the running totals from collection, or the
+// world state if collection is empty. Fabric does not let a transaction read
+// its own writes, and e.g. SplitAsset changes a total more than once, so the
+// TransactionContext every contract runs with remembers what the transaction
+// wrote. A context without it only reads what was committed.
+func getPortfolioState(ctx contractapi.TransactionContextInterface, collection string, key string) ([]byte, error) {
+	if txCtx, ok := ctx.(baseContext); ok {
+		if value, written := txCtx.base().written[collection+"\x00"+key]; written {
+			return value, nil
+		}
+	}
+
+	var value []byte
+	var err error
+	if collection == "" {
+		value, err = ctx.GetStub().GetState(key)
+	} else {
+		value, err = ctx.GetStub().GetPrivateData(collection, key)
+	}
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	return value, nil
+}
+
+// putPortfolioState writes a key of the running totals, or deletes it if
+// value is nil.
+func putPortfolioState(ctx contractapi.TransactionContextInterface, collection string, key string, value []byte) error {
+	if txCtx, ok := ctx.(baseContext); ok {
+		base := txCtx.base()
+		if base.written == nil {
+			base.written = map[string][]byte{}
+		}
+		base.written[collection+"\x00"+key] = value
+	}
+
+	var err error
+	switch {
+	case collection == "" && value == nil:
+		err = ctx.GetStub().DelState(key)
+	case collection == "":
+		err = ctx.GetStub().PutState(key, value)
+	case value == nil:
+		err = ctx.GetStub().DelPrivateData(collection, key)
+	default:
+		err = ctx.GetStub().PutPrivateData(collection, key, value)
+	}
+	switch {
+	case err == nil:
+		return nil
+	case collection == "":
+		return stateWriteFailed(err)
+	default:
+		return newContractError(ErrStateWriteFailed, nil, "failed to put to private data collection %s: %v", collection, err)
+	}
+}
@@ -0,0 +1,198 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+// requireQuotaExceeded asserts that err rejects a write for going over quota.
+func requireQuotaExceeded(t *testing.T, err error, quota string, message string) {
+	t.Helper()
+	requireCode(t, err, chaincode.ErrQuotaExceeded, message)
+	contractError, _ := chaincode.AsContractError(err)
+	require.Equal(t, quota, contractError.Details["Quota"])
+}
+
+func TestQuotas(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	seller := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.SetMSPQuota(ctx, "Org1MSP", 1, 0))))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	requireCode(t, ctx.end(assetTransfer.SetOwnerQuota(ctx, "Seller", 1, 0)), chaincode.ErrInvalidArgument, "owner Seller is not a client identity")
+	requireCode(t, ctx.end(assetTransfer.SetMSPQuota(ctx, "Org1MSP", -1, 0)), chaincode.ErrInvalidArgument, "the quota must not be negative")
+	require.NoError(t, ctx.end(assetTransfer.SetMSPQuota(ctx, "Org1MSP", 2, 500)))
+	quota, err := assetTransfer.GetQuota(ctx, seller)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Quota{MaxAssets: 2, MaxValue: 500}, quota)
+	quota, err = assetTransfer.GetQuota(ctx, buyer)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Quota{}, quota)
+
+	// a quota of the owner's own takes the place of the MSP's, until it is lifted
+	require.NoError(t, ctx.end(assetTransfer.SetOwnerQuota(ctx, seller, 3, 0)))
+	quota, err = assetTransfer.GetQuota(ctx, seller)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Quota{MaxAssets: 3}, quota)
+	require.NoError(t, ctx.end(assetTransfer.SetOwnerQuota(ctx, seller, 0, 0)))
+	quota, err = assetTransfer.GetQuota(ctx, seller)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Quota{MaxAssets: 2, MaxValue: 500}, quota)
+
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 4, "Seller")))
+	appraise(stub, 300)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset2", "blue", 6, "Seller"))
+	requireQuotaExceeded(t, err, "MaxValue", "the assets of "+seller+" would be worth 600, the quota is 500")
+	exists, err := assetTransfer.AssetExists(ctx, "asset2")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	appraise(stub, 200)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset2", "blue", 6, "Seller")))
+	// a new appraisal takes the place of the old one
+	appraise(stub, 400)
+	err = ctx.end(assetTransfer.UpdateAsset(ctx, "asset2", "blue", 6, "Seller"))
+	requireQuotaExceeded(t, err, "MaxValue", "the assets of "+seller+" would be worth 700, the quota is 500")
+	appraise(stub, 100)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset2", "blue", 6, "Seller")))
+
+	// merging at the limit leaves fewer assets, and splitting needs room for
+	// the children but not the asset split
+	require.NoError(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset2"}, "asset4")))
+	require.NoError(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset4", []int{5, 5})))
+	portfolio, err := assetTransfer.GetOwnerPortfolio(ctx, seller)
+	require.NoError(t, err)
+	require.Equal(t, 2, portfolio.AssetCount)
+	require.Equal(t, 400, portfolio.TotalValue)
+	require.Equal(t, []string{"asset4.1", "asset4.2"}, []string{portfolio.Assets[0].ID, portfolio.Assets[1].ID})
+
+	// a transfer within the org takes the appraisal along to the new owner
+	colleague := setCaller(t, ctx, stub, "Org1MSP", "Colleague@guolong.com", "client")
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.SetOwnerQuota(ctx, colleague, 0, 300)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	agreeOnPrice(t, ctx, stub, "asset4.1", 250, "Org1MSP", "Colleague@guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset4.1", colleague, "Colleague")
+	ctx.end(err)
+	require.NoError(t, err)
+	agreeOnPrice(t, ctx, stub, "asset4.2", 250, "Org1MSP", "Colleague@guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset4.2", colleague, "Colleague")
+	ctx.end(err)
+	requireQuotaExceeded(t, err, "MaxValue", "the assets of "+colleague+" would be worth 400, the quota is 300")
+
+	portfolio, err = assetTransfer.GetOwnerPortfolio(ctx, colleague)
+	require.NoError(t, err)
+	require.Equal(t, 1, portfolio.AssetCount)
+	require.Equal(t, 200, portfolio.TotalValue)
+
+	// the seller has room for one more asset, and again once it is deleted
+	appraise(stub, 50)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset3", "blue", 1, "Seller")))
+	appraise(stub, 50)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset5", "blue", 1, "Seller"))
+	requireQuotaExceeded(t, err, "MaxAssets", seller+" would hold 3 assets, the quota is 2")
+	require.NoError(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset3")))
+	appraise(stub, 50)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset5", "blue", 1, "Seller")))
+
+	// an owner that is full cannot be transferred more
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.SetOwnerQuota(ctx, colleague, 1, 0)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	agreeOnPrice(t, ctx, stub, "asset5", 50, "Org1MSP", "Colleague@guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset5", colleague, "Colleague")
+	ctx.end(err)
+	requireQuotaExceeded(t, err, "MaxAssets", colleague+" would hold 2 assets, the quota is 1")
+
+	// the running totals are not mistaken for assets
+	assets, err := assetTransfer.GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Len(t, assets, 6)
+
+	requireQuotaExceeded(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset4.2", []int{2, 3})), "MaxAssets", seller+" would hold 3 assets, the quota is 2")
+}
+
+func TestRecountPortfolio(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 4, "Seller")))
+
+	appraise(stub, 200)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset2", "blue", 6, "Seller")))
+	// as if the assets were written before the running totals were kept
+	count, err := stub.CreateCompositeKey("portfolio~count", []string{owner})
+	require.NoError(t, err)
+	require.NoError(t, stub.DelState(count))
+	require.NoError(t, ctx.end(nil))
+	total, err := stub.CreateCompositeKey("portfolio~value", []string{owner})
+	require.NoError(t, err)
+	require.NoError(t, stub.DelPrivateData("_implicit_org_Org1MSP", total))
+	require.NoError(t, ctx.end(nil))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.SetOwnerQuota(ctx, owner, 2, 0)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.RecountPortfolio(ctx, owner))))
+	appraise(stub, 50)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset3", "blue", 1, "Seller")), "the assets are not counted yet")
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.RecountPortfolio(ctx, owner)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 50)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset4", "blue", 1, "Seller"))
+	requireQuotaExceeded(t, err, "MaxAssets", owner+" would hold 4 assets, the quota is 2")
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.SetOwnerQuota(ctx, owner, 0, 550)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset4", "blue", 1, "Seller"))
+	requireQuotaExceeded(t, err, "MaxValue", "the assets of "+owner+" would be worth 600, the quota is 550")
+}
+
+func TestPortfolioTotalsWithinTransaction(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 4, "Seller")))
+	appraise(stub, 200)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset2", "blue", 6, "Seller")))
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.SetOwnerQuota(ctx, owner, 3, 500)))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+
+	count, err := stub.CreateCompositeKey("portfolio~count", []string{owner})
+	require.NoError(t, err)
+	total, err := stub.CreateCompositeKey("portfolio~value", []string{owner})
+	require.NoError(t, err)
+	requireTotals := func(assets string, value string) {
+		t.Helper()
+		countJSON, err := stub.GetState(count)
+		require.NoError(t, err)
+		require.Equal(t, assets, string(countJSON))
+		totalJSON, err := stub.GetPrivateData("_implicit_org_Org1MSP", total)
+		require.NoError(t, err)
+		require.Equal(t, value, string(totalJSON))
+	}
+
+	// each change within the transaction builds on the ones before it, not on
+	// the totals committed before it started
+	require.NoError(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset1", "asset2"}, "asset3")))
+	requireTotals("1", "500")
+	require.NoError(t, ctx.end(assetTransfer.SplitAsset(ctx, "asset3", []int{2, 3, 5})))
+	requireTotals("3", "500")
+	require.NoError(t, ctx.end(assetTransfer.MergeAssets(ctx, []string{"asset3.1", "asset3.2"}, "asset4")))
+	requireTotals("2", "500")
+}
@@ -0,0 +1,253 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+	"guolong.com/memstub"
+)
+
+// The property tests run sequences of operations against the in-memory stub
+// and a model of what the world state should hold, and check the invariants
+// of the contract after each one. An operation is opSize bytes: what it does,
+// which asset, which client calls it, and a parameter for the color, size and
+// owner name it writes.
+const opSize = 4
+
+const (
+	opCreate = iota
+	opUpdate
+	opTransfer
+	opDelete
+	opCount
+)
+
+var (
+	propertyIDs    = []string{"asset1", "asset2", "asset3", "asset4"}
+	propertyColors = []string{"blue", "red", "green", "dark blue"}
+	propertyNames  = []string{"Tomoko", "Brad", "", "Max Mustermann"}
+)
+
+// propertyClient is one of the clients the operations are called by.
+type propertyClient struct {
+	mspID      string
+	commonName string
+	identity   string
+}
+
+// modelAsset is what the model expects of an asset.
+type modelAsset struct {
+	color     string
+	owner     string
+	ownerName string
+	size      int
+}
+
+// runOperations interprets program as a sequence of operations and checks the
+// invariants after each of them. Trailing bytes that do not make up an
+// operation are ignored.
+func runOperations(t *testing.T, program []byte) {
+	t.Helper()
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	clients := []*propertyClient{
+		{mspID: "Org1MSP", commonName: "Alice@guolong.com"},
+		{mspID: "Org2MSP", commonName: "Bob@org2.guolong.com"},
+	}
+	for _, client := range clients {
+		client.identity = setCaller(t, ctx, stub, client.mspID, client.commonName, "client")
+	}
+	model := map[string]*modelAsset{}
+
+	for i := 0; i+opSize <= len(program); i += opSize {
+		op := program[i] % opCount
+		id := propertyIDs[int(program[i+1])%len(propertyIDs)]
+		caller := clients[int(program[i+2])%len(clients)]
+		other := clients[(int(program[i+2])+1)%len(clients)]
+		param := int(program[i+3])
+		color := propertyColors[param%len(propertyColors)]
+		size := param%10 + 1
+		ownerName := propertyNames[param%len(propertyNames)]
+		step := fmt.Sprintf("operation %d on %s by %s", op, id, caller.commonName)
+
+		expected, exists := model[id]
+		isOwner := exists && expected.owner == caller.identity
+		setCaller(t, ctx, stub, caller.mspID, caller.commonName, "client")
+		switch op {
+		case opCreate:
+			appraise(stub, param+1)
+			err := ctx.end(assetTransfer.CreateAsset(ctx, id, color, size, ownerName))
+			stub.SetTransient(nil)
+			if exists {
+				requireCode(t, err, chaincode.ErrAssetExists, fmt.Sprintf("the asset %s already exists", id))
+				break
+			}
+			require.NoError(t, err, step)
+			model[id] = &modelAsset{color: color, owner: caller.identity, ownerName: ownerName, size: size}
+		case opUpdate:
+			err := ctx.end(assetTransfer.UpdateAsset(ctx, id, color, size, ownerName))
+			if !isOwner {
+				require.Error(t, err, step)
+				break
+			}
+			require.NoError(t, err, step)
+			expected.color, expected.ownerName, expected.size = color, ownerName, size
+		case opTransfer:
+			if isOwner {
+				agreeOnPrice(t, ctx, stub, id, param+1, other.mspID, other.commonName, "client")
+			}
+			oldOwner, err := assetTransfer.TransferAsset(ctx, id, other.identity, ownerName)
+			ctx.end(err)
+			if !isOwner {
+				require.Error(t, err, step)
+				break
+			}
+			require.NoError(t, err, step)
+			require.Equal(t, caller.identity, oldOwner, step)
+			expected.owner, expected.ownerName = other.identity, ownerName
+		case opDelete:
+			err := ctx.end(assetTransfer.DeleteAsset(ctx, id))
+			if !isOwner {
+				require.Error(t, err, step)
+				break
+			}
+			require.NoError(t, err, step)
+			delete(model, id)
+		}
+		requireInvariants(t, ctx, stub, model, step)
+	}
+}
+
+// requireInvariants checks the world state against the model: GetAllAssets
+// lists every asset once and as ReadAsset returns it, only the assets of the
+// model exist, their owners only changed by transfers, and what is stored is
+// the deterministic JSON of the asset.
+func requireInvariants(t *testing.T, ctx *testContext, stub *memstub.MemStub, model map[string]*modelAsset, step string) {
+	t.Helper()
+	assetTransfer := newContracts()
+	assets, err := assetTransfer.GetAllAssets(ctx)
+	require.NoError(t, err, step)
+
+	listed := map[string]bool{}
+	for _, asset := range assets {
+		require.False(t, listed[asset.ID], "%s: asset %s is listed twice", step, asset.ID)
+		listed[asset.ID] = true
+
+		expected, ok := model[asset.ID]
+		require.True(t, ok, "%s: asset %s should not exist", step, asset.ID)
+		require.Equal(t, expected.owner, asset.Owner, step)
+		require.Equal(t, expected.ownerName, asset.OwnerName, step)
+		require.Equal(t, expected.color, asset.Color, step)
+		require.Equal(t, expected.size, asset.Size, step)
+
+		read, err := assetTransfer.ReadAsset(ctx, asset.ID)
+		require.NoError(t, err, step)
+		require.Equal(t, asset, read, step)
+
+		assetJSON, err := json.Marshal(read)
+		require.NoError(t, err, step)
+		stored, err := stub.GetState(asset.ID)
+		require.NoError(t, err, step)
+		require.Equal(t, string(stored), string(assetJSON), step)
+	}
+	for id := range model {
+		require.True(t, listed[id], "%s: asset %s is not listed", step, id)
+	}
+}
+
+func FuzzAssetOperations(f *testing.F) {
+	f.Add([]byte{opCreate, 0, 0, 3, opTransfer, 0, 0, 5, opUpdate, 0, 1, 2, opDelete, 0, 1, 0})
+	f.Add([]byte{opCreate, 1, 1, 0, opCreate, 1, 0, 1, opUpdate, 1, 0, 2, opTransfer, 1, 0, 4, opDelete, 1, 0, 0, opCreate, 1, 0, 9})
+	f.Fuzz(func(t *testing.T, program []byte) {
+		// long programs only repeat what short ones cover, and slowly
+		if len(program) > 64*opSize {
+			t.Skip()
+		}
+		runOperations(t, program)
+	})
+}
+
+func TestAssetOperationsModel(t *testing.T) {
+	for seed := uint64(1); seed <= 200; seed++ {
+		random := rand.New(rand.NewPCG(seed, seed))
+		program := make([]byte, opSize*(1+random.IntN(40)))
+		for i := range program {
+			program[i] = byte(random.UintN(256))
+		}
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			runOperations(t, program)
+		})
+	}
+}
+
+func FuzzCreateAsset(f *testing.F) {
+	f.Add("asset1", "blue", 5, "Tomoko", 300)
+	f.Add("", "Blue", 0, "\x00", -1)
+	f.Add("asset.1_a-b", "dark blue", 1000000, "Max Mustermann", 0)
+	f.Fuzz(func(t *testing.T, id string, color string, size int, ownerName string, appraisedValue int) {
+		ctx, stub := newTransactionContext(t)
+		assetTransfer := newContracts()
+		owner := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+		appraise(stub, appraisedValue)
+
+		if err := ctx.end(assetTransfer.CreateAsset(ctx, id, color, size, ownerName)); err != nil {
+			// nothing is written for an asset that is rejected
+			require.Empty(t, stub.Keys(), "%v", err)
+			return
+		}
+		asset, err := assetTransfer.ReadAsset(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, []string{id, color, owner, ownerName}, []string{asset.ID, asset.Color, asset.Owner, asset.OwnerName})
+		require.Equal(t, size, asset.Size)
+		requireInvariants(t, ctx, stub, map[string]*modelAsset{id: {color: color, owner: owner, ownerName: ownerName, size: size}}, "create")
+	})
+}
+
+func FuzzAssetJSON(f *testing.F) {
+	f.Add("asset1", "blue", 5, org1Admin, "Tomoko", chaincode.StatusActive, "", "asset0,asset2", 300)
+	f.Add("", "", 0, "", "", "", "\xff", "", 0)
+	f.Add("a b", "<red>", -1, "&", "\"quoted\"", "frozen", "\t", ",", -300)
+	f.Fuzz(func(t *testing.T, id string, color string, size int, owner string, ownerName string, status string, reason string, parents string, appraisedValue int) {
+		asset := &chaincode.Asset{
+			AppraisedValue: appraisedValue,
+			Color:          color,
+			ID:             id,
+			Owner:          owner,
+			OwnerName:      ownerName,
+			SchemaVersion:  2,
+			Size:           size,
+			Status:         status,
+			StatusReason:   reason,
+		}
+		if parents != "" {
+			asset.Parents = strings.Split(parents, ",")
+		}
+
+		assetJSON, err := json.Marshal(asset)
+		require.NoError(t, err)
+		again, err := json.Marshal(asset)
+		require.NoError(t, err)
+		require.Equal(t, assetJSON, again, "the JSON of an asset is deterministic")
+
+		var decoded chaincode.Asset
+		require.NoError(t, json.Unmarshal(assetJSON, &decoded))
+		decodedJSON, err := json.Marshal(&decoded)
+		require.NoError(t, err)
+		require.Equal(t, string(assetJSON), string(decodedJSON))
+
+		// invalid UTF-8 is replaced when it is encoded, the rest survives as is
+		valid := true
+		for _, value := range append([]string{id, color, owner, ownerName, status, reason}, asset.Parents...) {
+			valid = valid && utf8.ValidString(value)
+		}
+		if valid {
+			require.Equal(t, asset, &decoded)
+		}
+	})
+}
@@ -0,0 +1,296 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Indexes kept next to the assets, so that the queries below work on LevelDB
+// too. Appraisals are private, so the value index is kept in the implicit
+// collection of the org that holds the appraisal.
+//
+// Assets are indexed when they are written, so assets written before the
+// indexes existed show up once they are next changed or MigrateAssets has
+// migrated them.
+const (
+	ownerIndex = "owner~id"
+	colorIndex = "color~id"
+	valueIndex = "value~id"
+)
+
+// QueryContract lists and looks up assets and what is recorded about them,
+// such as their history, offers and appraisals, and the roles and rules of the
+// contract. None of its transactions write.
+type QueryContract struct {
+	Contract
+}
+
+// GetName returns the name the query transactions are called under, e.g.
+// query:GetAllAssets.
+func (q *QueryContract) GetName() string {
+	return "query"
+}
+
+// AssetPage is a page of QueryAssets results. Bookmark fetches the next page
+// and is empty after the last one.
+type AssetPage struct {
+	Assets              []*Asset `json:"Assets"`
+	Bookmark            string   `json:"Bookmark"`
+	FetchedRecordsCount int      `json:"FetchedRecordsCount"`
+}
+
+// QueryAssetsByOwner returns the assets owned by a client identity.
+func (q *QueryContract) QueryAssetsByOwner(ctx contractapi.TransactionContextInterface, owner string) ([]*Asset, error) {
+	return assetsByIndex(ctx, ownerIndex, owner)
+}
+
+// QueryAssetsByColor returns the assets of a color.
+func (q *QueryContract) QueryAssetsByColor(ctx contractapi.TransactionContextInterface, color string) ([]*Asset, error) {
+	return assetsByIndex(ctx, colorIndex, color)
+}
+
+// QueryAssetsByValueRange returns the assets appraised at min to max,
+// inclusive, in order of their appraised value. Only appraisals held by the
+// caller's org are searched.
+func (q *QueryContract) QueryAssetsByValueRange(ctx contractapi.TransactionContextInterface, min int, max int) ([]*Asset, error) {
+	if min > max {
+		return nil, invalidArgument("min %d is greater than max %d", min, max)
+	}
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, valueIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var assets []*Asset
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.Atoi(attributes[0])
+		if err != nil {
+			return nil, err
+		}
+		if value < min {
+			continue
+		}
+		if value > max {
+			break
+		}
+
+		asset, err := indexedAsset(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if asset != nil {
+			assets = append(assets, asset)
+		}
+	}
+	return assets, nil
+}
+
+// assetFields are fields every asset record has, and none of the other JSON
+// documents the contract keeps in the world state, such as offers, listings
+// or verifications. QueryAssets only matches documents that have them.
+var assetFields = []string{"Color", "ID", "Owner", "Size"}
+
+// isAssetRecord reports whether value is a JSON object with all the
+// assetFields.
+func isAssetRecord(value []byte) bool {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(value, &record); err != nil {
+		return false
+	}
+	for _, field := range assetFields {
+		if _, ok := record[field]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryAssets runs a CouchDB selector, e.g. {"Color": "blue", "Size": {"$gt": 5}},
+// over the assets and returns a page of at most pageSize of them. Pass an
+// empty bookmark for the first page. It needs a CouchDB state database; the
+// indexes it can use ship with the chaincode in META-INF.
+func (q *QueryContract) QueryAssets(ctx contractapi.TransactionContextInterface, selector string, pageSize int, bookmark string) (*AssetPage, error) {
+	var selectorObject map[string]interface{}
+	if err := json.Unmarshal([]byte(selector), &selectorObject); err != nil {
+		return nil, invalidArgument("the selector must be a JSON object: %v", err)
+	}
+	if pageSize <= 0 {
+		return nil, invalidArgument("page size must be positive")
+	}
+	assetOnly := map[string]interface{}{}
+	for _, field := range assetFields {
+		assetOnly[field] = map[string]interface{}{"$exists": true}
+	}
+	query, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{"$and": []interface{}{selectorObject, assetOnly}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(string(query), int32(pageSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	page := &AssetPage{Assets: []*Asset{}}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		asset, err := unmarshalAsset(queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		page.Assets = append(page.Assets, asset)
+	}
+	page.Bookmark = metadata.Bookmark
+	page.FetchedRecordsCount = int(metadata.FetchedRecordsCount)
+	return page, nil
+}
+
+// putAsset writes asset to the world state, moves its index entries from
+// where old had them and counts it for the quotas of its owner. old is nil for
+// a new asset.
+func putAsset(ctx contractapi.TransactionContextInterface, old *Asset, asset *Asset) error {
+	if err := stampAsset(ctx, old == nil, asset); err != nil {
+		return err
+	}
+	if err := countAssetChange(ctx, old, asset); err != nil {
+		return err
+	}
+	return writeAsset(ctx, old, asset)
+}
+
+// writeAsset is putAsset without recording the write on the asset.
+func writeAsset(ctx contractapi.TransactionContextInterface, old *Asset, asset *Asset) error {
+	// the documents are kept under their own keys
+	stored := *asset
+	stored.Attachments = nil
+	assetJSON, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(asset.ID, assetJSON); err != nil {
+		return stateWriteFailed(err)
+	}
+
+	if old != nil {
+		if err := deleteIndexEntries(ctx, old); err != nil {
+			return err
+		}
+	}
+	keys, err := indexKeys(ctx, asset)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := ctx.GetStub().PutState(key, []byte{0x00}); err != nil {
+			return stateWriteFailed(err)
+		}
+	}
+	return nil
+}
+
+// deleteAsset removes asset and its index entries from the world state.
+func deleteAsset(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	if err := ctx.GetStub().DelState(asset.ID); err != nil {
+		return stateWriteFailed(err)
+	}
+	if err := deleteIndexEntries(ctx, asset); err != nil {
+		return err
+	}
+	return countDeletedAsset(ctx, asset)
+}
+
+func deleteIndexEntries(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	keys, err := indexKeys(ctx, asset)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return stateWriteFailed(err)
+		}
+	}
+	return nil
+}
+
+func indexKeys(ctx contractapi.TransactionContextInterface, asset *Asset) ([]string, error) {
+	ownerKey, err := ctx.GetStub().CreateCompositeKey(ownerIndex, []string{asset.Owner, asset.ID})
+	if err != nil {
+		return nil, err
+	}
+	colorKey, err := ctx.GetStub().CreateCompositeKey(colorIndex, []string{asset.Color, asset.ID})
+	if err != nil {
+		return nil, err
+	}
+	return []string{ownerKey, colorKey}, nil
+}
+
+// valueIndexKey returns the key of an appraisal in the value index. The value
+// is zero-padded so that the keys sort by it.
+func valueIndexKey(ctx contractapi.TransactionContextInterface, appraisal *Appraisal) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(valueIndex, []string{fmt.Sprintf("%019d", appraisal.AppraisedValue), appraisal.AssetID})
+}
+
+func assetsByIndex(ctx contractapi.TransactionContextInterface, index string, attribute string) ([]*Asset, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, []string{attribute})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var assets []*Asset
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		asset, err := indexedAsset(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if asset != nil {
+			assets = append(assets, asset)
+		}
+	}
+	return assets, nil
+}
+
+// indexedAsset reads an asset an index entry points to. It returns nil rather
+// than an error if the asset is gone, which a private index can lag behind.
+func indexedAsset(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
+	assetJSON, err := ctx.GetStub().GetState(id)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if assetJSON == nil {
+		return nil, nil
+	}
+
+	return unmarshalAsset(assetJSON)
+}
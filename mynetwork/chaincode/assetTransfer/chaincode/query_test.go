@@ -0,0 +1,129 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func assetIDs(assets []*chaincode.Asset) []string {
+	ids := []string{}
+	for _, asset := range assets {
+		ids = append(ids, asset.ID)
+	}
+	return ids
+}
+
+func TestQueryAssetsByIndex(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	for _, asset := range []struct {
+		id, color string
+		value     int
+	}{{"asset1", "blue", 300}, {"asset2", "red", 1000}, {"asset3", "blue", 50}, {"asset4", "green", 700}} {
+		appraise(stub, asset.value)
+		require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, asset.id, asset.color, 5, "Tomoko")))
+	}
+
+	assets, err := assetTransfer.QueryAssetsByOwner(ctx, org1Admin)
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset1", "asset2", "asset3", "asset4"}, assetIDs(assets))
+	assets, err = assetTransfer.QueryAssetsByColor(ctx, "blue")
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset1", "asset3"}, assetIDs(assets))
+	assets, err = assetTransfer.QueryAssetsByValueRange(ctx, 50, 700)
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset3", "asset1", "asset4"}, assetIDs(assets))
+	_, err = assetTransfer.QueryAssetsByValueRange(ctx, 700, 50)
+	requireCode(t, err, chaincode.ErrInvalidArgument, "min 700 is greater than max 50")
+
+	// the indexes follow updates, transfers and deletions
+	appraise(stub, 100)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Tomoko")))
+	agreeOnPrice(t, ctx, stub, "asset4", 900, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	_, err = assetTransfer.TransferAsset(ctx, "asset4", buyer, "Buyer")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.NoError(t, ctx.end(assetTransfer.DeleteAsset(ctx, "asset2")))
+
+	assets, err = assetTransfer.QueryAssetsByColor(ctx, "blue")
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset3"}, assetIDs(assets))
+	assets, err = assetTransfer.QueryAssetsByColor(ctx, "red")
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset1"}, assetIDs(assets))
+	assets, err = assetTransfer.QueryAssetsByOwner(ctx, org1Admin)
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset1", "asset3"}, assetIDs(assets))
+	assets, err = assetTransfer.QueryAssetsByOwner(ctx, buyer)
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset4"}, assetIDs(assets))
+	assets, err = assetTransfer.QueryAssetsByValueRange(ctx, 0, 10000)
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset3", "asset1"}, assetIDs(assets), "Org1 gave up the appraisal of asset4 and deleted asset2")
+
+	// appraisals are searched in the caller's org only
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	assets, err = assetTransfer.QueryAssetsByValueRange(ctx, 0, 10000)
+	require.NoError(t, err)
+	require.Empty(t, assets)
+	appraise(stub, 700)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset4", "green", 5, "Buyer")))
+	assets, err = assetTransfer.QueryAssetsByValueRange(ctx, 700, 700)
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset4"}, assetIDs(assets))
+
+	// index entries are not assets
+	assets, err = assetTransfer.GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Len(t, assets, 3)
+}
+
+func TestQueryAssets(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	for _, id := range []string{"asset1", "asset2", "asset3", "asset4", "asset5"} {
+		appraise(stub, 100)
+		require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, id, "blue", 5, "Tomoko")))
+	}
+	appraise(stub, 100)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset6", "red", 5, "Tomoko")))
+
+	var ids []string
+	bookmark := ""
+	for {
+		page, err := assetTransfer.QueryAssets(ctx, `{"Color":"blue"}`, 2, bookmark)
+		require.NoError(t, err)
+		require.LessOrEqual(t, page.FetchedRecordsCount, 2)
+		ids = append(ids, assetIDs(page.Assets)...)
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	require.Equal(t, []string{"asset1", "asset2", "asset3", "asset4", "asset5"}, ids)
+
+	page, err := assetTransfer.QueryAssets(ctx, `{"Color":"green"}`, 2, "")
+	require.NoError(t, err)
+	require.Empty(t, page.Assets)
+
+	// the other documents in the world state are not mistaken for assets
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(assetTransfer.OfferTransfer(ctx, "asset6", buyer, "2024-02-01T00:00:00Z")))
+	require.NoError(t, ctx.end(assetTransfer.ListAsset(ctx, "asset5", 100)))
+	page, err = assetTransfer.QueryAssets(ctx, `{"Owner":"`+org1Admin+`","Color":{"$ne":"blue"}}`, 10, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset6"}, assetIDs(page.Assets))
+	page, err = assetTransfer.QueryAssets(ctx, `{"AssetID":{"$exists":true}}`, 10, "")
+	require.NoError(t, err)
+	require.Empty(t, page.Assets)
+
+	_, err = assetTransfer.QueryAssets(ctx, `["Color"]`, 2, "")
+	require.ErrorContains(t, err, "the selector must be a JSON object")
+	_, err = assetTransfer.QueryAssets(ctx, `{"Color":"blue"}`, 0, "")
+	requireCode(t, err, chaincode.ErrInvalidArgument, "page size must be positive")
+}
@@ -0,0 +1,194 @@
+package chaincode
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// A listing is the public price an owner sells an asset for in tokens, see
+// TokenContract. Unlike a price agreement it is open to any buyer.
+const listingObjectType = "asset~listing"
+
+const assetSoldEvent = "AssetSold"
+
+// Listing is an offer of Seller to sell an asset to anyone for Price tokens.
+type Listing struct {
+	AssetID string `json:"AssetID"`
+	Price   int    `json:"Price"`
+	Seller  string `json:"Seller"`
+}
+
+// ListAsset puts an active asset up for sale for price tokens, in place of any
+// earlier listing. Only the owner or an admin of the owner's org can call it,
+// and the owner must be a client identity to be paid.
+func (a *AssetContract) ListAsset(ctx contractapi.TransactionContextInterface, id string, price int) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireWhole(asset); err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if _, isIdentity := ownerMSPID(asset.Owner); !isIdentity {
+		return invalidStatus(id, "the owner %s of asset %s is not a client identity, update the asset first", asset.Owner, id)
+	}
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return err
+	}
+	if price <= 0 {
+		return invalidArgument("the price must be positive")
+	}
+
+	listingJSON, err := json.Marshal(Listing{AssetID: id, Price: price, Seller: asset.Owner})
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(listingObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, listingJSON)
+}
+
+// DelistAsset takes an asset off sale. Only the owner or an admin of the
+// owner's org can call it.
+func (a *AssetContract) DelistAsset(ctx contractapi.TransactionContextInterface, id string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	listing, err := readListing(ctx, id)
+	if err != nil {
+		return err
+	}
+	if listing == nil {
+		return invalidStatus(id, "the asset %s is not for sale", id)
+	}
+	return deleteListing(ctx, id)
+}
+
+// GetListing returns the listing of an asset that is for sale.
+func (q *QueryContract) GetListing(ctx contractapi.TransactionContextInterface, id string) (*Listing, error) {
+	listing, err := readListing(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if listing == nil {
+		return nil, invalidStatus(id, "the asset %s is not for sale", id)
+	}
+	return listing, nil
+}
+
+// BuyAsset buys a listed asset: in one transaction it moves the price in
+// tokens from the caller to the owner and makes the caller the owner, so that
+// neither side can be left with both or neither. The caller passes the price
+// they saw, so that the seller cannot raise it while the transaction is on its
+// way. The seller's org drops its appraisal of the asset, and the buyer sets
+// their owner name and appraisal with UpdateAsset.
+func (a *AssetContract) BuyAsset(ctx contractapi.TransactionContextInterface, id string, price int) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	listing, err := readListing(ctx, id)
+	if err != nil {
+		return err
+	}
+	if listing == nil || listing.Seller != asset.Owner {
+		return invalidStatus(id, "the asset %s is not for sale", id)
+	}
+	if price != listing.Price {
+		return invalidArgument("the asset %s is listed for %d tokens, not %d", id, listing.Price, price)
+	}
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return err
+	}
+	buyer, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	if buyer == asset.Owner {
+		return invalidArgument("%s already owns asset %s", buyer, id)
+	}
+	if err := requireTransferAllowed(ctx, id, buyer); err != nil {
+		return err
+	}
+
+	if err := transferTokens(ctx, buyer, listing.Seller, listing.Price); err != nil {
+		return err
+	}
+	if err := dropOwnerGrants(ctx, id); err != nil {
+		return err
+	}
+	sellerMSPID, _ := ownerMSPID(listing.Seller)
+	if err := removeAppraisal(ctx, implicitCollection(sellerMSPID), id); err != nil {
+		return err
+	}
+	old := *asset
+	asset.Owner = buyer
+	asset.OwnerName = ""
+	asset.AppraisedValue = 0
+	if err := putAsset(ctx, &old, asset); err != nil {
+		return err
+	}
+
+	listingJSON, err := json.Marshal(listing)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(assetSoldEvent, listingJSON)
+}
+
+func readListing(ctx contractapi.TransactionContextInterface, id string) (*Listing, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(listingObjectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	listingJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if listingJSON == nil {
+		return nil, nil
+	}
+
+	var listing Listing
+	if err := json.Unmarshal(listingJSON, &listing); err != nil {
+		return nil, err
+	}
+	return &listing, nil
+}
+
+// dropOwnerGrants removes the listing and the NFT approval of an asset, which
+// only hold for the owner who made them. Every change of owner calls it.
+func dropOwnerGrants(ctx contractapi.TransactionContextInterface, id string) error {
+	if err := deleteListing(ctx, id); err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(nftApprovalObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return stateWriteFailed(err)
+	}
+	return nil
+}
+
+func deleteListing(ctx contractapi.TransactionContextInterface, id string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(listingObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return stateWriteFailed(err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuyAsset(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	token := chaincode.TokenContract{}
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	require.NoError(t, ctx.end(token.SetIssuer(ctx, "Org2MSP")))
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(token.Mint(ctx, 400)))
+	seller := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.BuyAsset(ctx, "asset1", 500)), chaincode.ErrInvalidStatus, "the asset asset1 is not for sale")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.ListAsset(ctx, "asset1", 500))))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.ListAsset(ctx, "asset1", 0)), chaincode.ErrInvalidArgument, "the price must be positive")
+	require.NoError(t, ctx.end(assetTransfer.ListAsset(ctx, "asset1", 500)))
+	listing, err := assetTransfer.GetListing(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Listing{AssetID: "asset1", Price: 500, Seller: seller}, listing)
+
+	// the buyer cannot pay, so nothing moves
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.BuyAsset(ctx, "asset1", 500)), chaincode.ErrInvalidArgument, buyer+" has 400 tokens, not the 500 needed")
+
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.ListAsset(ctx, "asset1", 350)))
+	// the buyer pays the price they saw or nothing
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.BuyAsset(ctx, "asset1", 500)), chaincode.ErrInvalidArgument, "the asset asset1 is listed for 350 tokens, not 500")
+	require.NoError(t, ctx.end(assetTransfer.BuyAsset(ctx, "asset1", 350)))
+	require.Equal(t, "AssetSold", stub.Event().EventName)
+
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, buyer, asset.Owner)
+	balance, err := token.BalanceOf(ctx, seller)
+	require.NoError(t, err)
+	require.Equal(t, 350, balance)
+	balance, err = token.BalanceOf(ctx, buyer)
+	require.NoError(t, err)
+	require.Equal(t, 50, balance)
+	_, err = assetTransfer.GetListing(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 is not for sale")
+
+	// the seller's org no longer holds the appraisal
+	appraisalJSON, err := stub.GetPrivateData("_implicit_org_Org1MSP", "asset1")
+	require.NoError(t, err)
+	require.Nil(t, appraisalJSON)
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	portfolio, err := assetTransfer.GetOwnerPortfolio(ctx, seller)
+	require.NoError(t, err)
+	require.Equal(t, 0, portfolio.AssetCount)
+	require.Equal(t, 0, portfolio.TotalValue)
+}
+
+func TestListingEndsWithOwnership(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	buyer := setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	require.NoError(t, ctx.end(assetTransfer.ListAsset(ctx, "asset1", 500)))
+
+	agreeOnPrice(t, ctx, stub, "asset1", 400, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	_, err := assetTransfer.TransferAsset(ctx, "asset1", buyer, "Buyer")
+	ctx.end(err)
+	require.NoError(t, err)
+	_, err = assetTransfer.GetListing(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 is not for sale")
+
+	// frozen or locked assets cannot be bought
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.ListAsset(ctx, "asset1", 500)))
+	require.NoError(t, ctx.end(assetTransfer.LockAsset(ctx, "asset1", "sale pending")))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	requireCode(t, ctx.end(assetTransfer.BuyAsset(ctx, "asset1", 500)), chaincode.ErrInvalidStatus, "the asset asset1 is locked")
+	setCaller(t, ctx, stub, "Org2MSP", "Buyer@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.DelistAsset(ctx, "asset1")))
+	requireCode(t, ctx.end(assetTransfer.DelistAsset(ctx, "asset1")), chaincode.ErrInvalidStatus, "the asset asset1 is not for sale")
+}
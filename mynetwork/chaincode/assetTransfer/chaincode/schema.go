@@ -0,0 +1,181 @@
+package chaincode
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// assetSchemaVersion is the SchemaVersion of the assets this chaincode writes.
+// Records without one are version 1. Older records are migrated when they are
+// read, and the migration is persisted the next time they are written or by
+// MigrateAssets.
+const assetSchemaVersion = 2
+
+// defaultCategory is the Category of assets created without one, and of
+// assets written before categories existed.
+const defaultCategory = "general"
+
+// maxMigrationPageSize bounds the records MigrateAssets writes in one
+// transaction.
+const maxMigrationPageSize = 500
+
+// assetMigrations upgrades asset records one schema version at a time, where
+// assetMigrations[v] turns a record of version v into one of version v+1.
+// They work on the JSON object, so that they can see fields Asset no longer
+// has.
+var assetMigrations = map[int]func(record map[string]interface{}){
+	// version 2 adds Category, CreatedAt and UpdatedAt. When an older asset
+	// was created is not known.
+	1: func(record map[string]interface{}) {
+		record["Category"] = defaultCategory
+		if status, _ := record["Status"].(string); status == "" {
+			record["Status"] = StatusActive
+		}
+	},
+}
+
+// MigrationPage is the result of a MigrateAssets call. Bookmark continues the
+// migration and is empty once every asset has been looked at.
+type MigrationPage struct {
+	Bookmark string `json:"Bookmark"`
+	Migrated int    `json:"Migrated"`
+	Scanned  int    `json:"Scanned"`
+}
+
+// MigrateAssets migrates up to pageSize assets, starting at bookmark, to the
+// current schema version and writes them back, adding the index entries of
+// assets written before the indexes existed. Migrated assets were written
+// before the running totals were kept, so the totals of their owners are
+// recounted, see RecountPortfolio. Other documents under simple keys are
+// skipped and not counted in the page. Pass an empty bookmark to start, and
+// call it with the returned bookmark until that is empty. Only admins can call
+// it.
+func (a *AdminContract) MigrateAssets(ctx contractapi.TransactionContextInterface, pageSize int, bookmark string) (*MigrationPage, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 || pageSize > maxMigrationPageSize {
+		return nil, invalidArgument("page size must be 1 to %d", maxMigrationPageSize)
+	}
+
+	// paginated queries are only allowed in read-only transactions, so the
+	// bookmark is the key to go on from
+	resultsIterator, err := ctx.GetStub().GetStateByRange(bookmark, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	page := &MigrationPage{}
+	var owners []string
+	migrated := map[string][]*Asset{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !isAssetRecord(queryResponse.Value) {
+			continue
+		}
+		if page.Scanned == pageSize {
+			page.Bookmark = queryResponse.Key
+			break
+		}
+		page.Scanned++
+
+		version, err := schemaVersion(queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		if version == assetSchemaVersion {
+			continue
+		}
+		asset, err := unmarshalAsset(queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := stampAsset(ctx, false, asset); err != nil {
+			return nil, err
+		}
+		if err := writeAsset(ctx, nil, asset); err != nil {
+			return nil, err
+		}
+		if _, seen := migrated[asset.Owner]; !seen {
+			owners = append(owners, asset.Owner)
+		}
+		migrated[asset.Owner] = append(migrated[asset.Owner], asset)
+		page.Migrated++
+	}
+
+	for _, owner := range owners {
+		if err := recountPortfolio(ctx, owner, migrated[owner]); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// unmarshalAsset decodes an asset record, migrating it to the current schema
+// version first if it is older.
+func unmarshalAsset(assetJSON []byte) (*Asset, error) {
+	version, err := schemaVersion(assetJSON)
+	if err != nil {
+		return nil, err
+	}
+	if version > assetSchemaVersion {
+		return nil, newContractError(ErrInvalidStatus, nil, "the asset has schema version %d, which is newer than version %d of this chaincode", version, assetSchemaVersion)
+	}
+
+	if version < assetSchemaVersion {
+		var record map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(assetJSON))
+		decoder.UseNumber()
+		if err := decoder.Decode(&record); err != nil {
+			return nil, err
+		}
+		for ; version < assetSchemaVersion; version++ {
+			assetMigrations[version](record)
+		}
+		record["SchemaVersion"] = assetSchemaVersion
+		if assetJSON, err = json.Marshal(record); err != nil {
+			return nil, err
+		}
+	}
+
+	var asset Asset
+	if err := json.Unmarshal(assetJSON, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func schemaVersion(assetJSON []byte) (int, error) {
+	var versioned struct {
+		SchemaVersion int `json:"SchemaVersion"`
+	}
+	if err := json.Unmarshal(assetJSON, &versioned); err != nil {
+		return 0, err
+	}
+	if versioned.SchemaVersion == 0 {
+		return 1, nil
+	}
+	return versioned.SchemaVersion, nil
+}
+
+// stampAsset records on asset that it is written now, in the current schema
+// version. A new asset is also created now.
+func stampAsset(ctx contractapi.TransactionContextInterface, isNew bool, asset *Asset) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	asset.SchemaVersion = assetSchemaVersion
+	asset.UpdatedAt = now.UTC().Format(time.RFC3339)
+	if isNew {
+		asset.CreatedAt = asset.UpdatedAt
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazyMigration(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	require.NoError(t, stub.PutState("asset1", []byte(`{"AppraisedValue":300,"Color":"blue","ID":"asset1","Owner":"Tomoko","Size":5}`)))
+	require.NoError(t, ctx.end(nil))
+
+	// old records are migrated when they are read
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Asset{AppraisedValue: 300, Category: "general", Color: "blue", ID: "asset1", Owner: "Tomoko", SchemaVersion: 2, Size: 5, Status: chaincode.StatusActive}, asset)
+	assets, err := assetTransfer.GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Asset{asset}, assets)
+
+	// and stored that way with the next write
+	require.Equal(t, 1, storedSchemaVersion(t, stub.GetState, "asset1"))
+	require.NoError(t, ctx.end(assetTransfer.LockAsset(ctx, "asset1", "sale pending")))
+	require.Equal(t, 2, storedSchemaVersion(t, stub.GetState, "asset1"))
+	asset, err = assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, "general", asset.Category)
+	require.Empty(t, asset.CreatedAt, "when the asset was created is not known")
+	require.Equal(t, "2024-01-01T00:00:01Z", asset.UpdatedAt)
+
+	// records of a newer chaincode are not guessed at
+	require.NoError(t, stub.PutState("asset2", []byte(`{"ID":"asset2","SchemaVersion":3}`)))
+	require.NoError(t, ctx.end(nil))
+	_, err = assetTransfer.ReadAsset(ctx, "asset2")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset has schema version 3, which is newer than version 2 of this chaincode")
+}
+
+func TestMigrateAssets(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, stub.PutState(fmt.Sprintf("asset%d", i), []byte(fmt.Sprintf(`{"Color":"blue","ID":"asset%d","Owner":"Tomoko","Size":5}`, i))))
+	}
+	require.NoError(t, ctx.end(nil))
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset6", "blue", 5, "Tomoko")))
+
+	_, err := assetTransfer.MigrateAssets(ctx, 0, "")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidArgument, "page size must be 1 to 500")
+
+	// legacy assets are not in the indexes until they are migrated
+	assets, err := assetTransfer.QueryAssetsByColor(ctx, "blue")
+	require.NoError(t, err)
+	require.Len(t, assets, 1)
+
+	var pages []*chaincode.MigrationPage
+	bookmark := ""
+	for {
+		stub.StartTransaction(fmt.Sprintf("tx-migrate-%d", len(pages)))
+		page, err := assetTransfer.MigrateAssets(ctx, 2, bookmark)
+		ctx.end(err)
+		require.NoError(t, err)
+		pages = append(pages, page)
+		if bookmark = page.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	require.Equal(t, []*chaincode.MigrationPage{
+		{Bookmark: "asset3", Migrated: 2, Scanned: 2},
+		{Bookmark: "asset5", Migrated: 2, Scanned: 2},
+		{Bookmark: "", Migrated: 1, Scanned: 2},
+	}, pages)
+	for i := 1; i <= 5; i++ {
+		require.Equal(t, 2, storedSchemaVersion(t, stub.GetState, fmt.Sprintf("asset%d", i)))
+	}
+	assets, err = assetTransfer.QueryAssetsByColor(ctx, "blue")
+	require.NoError(t, err)
+	require.Len(t, assets, 6)
+	require.Empty(t, assets[0].CreatedAt, "when the asset was created is not known")
+	require.NotEmpty(t, assets[0].UpdatedAt)
+
+	// the migrated assets are counted for their owner once, over the pages
+	count, err := stub.CreateCompositeKey("portfolio~count", []string{"Tomoko"})
+	require.NoError(t, err)
+	countJSON, err := stub.GetState(count)
+	require.NoError(t, err)
+	require.Equal(t, "5", string(countJSON))
+
+	page, err := assetTransfer.MigrateAssets(ctx, 10, "")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.MigrationPage{Migrated: 0, Scanned: 6}, page)
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	_, err = assetTransfer.MigrateAssets(ctx, 10, "")
+	ctx.end(err)
+	require.True(t, chaincode.IsAccessDenied(err))
+}
+
+func TestMigrateAssetsSkipsOtherDocuments(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, stub.PutState(fmt.Sprintf("asset%d", i), []byte(fmt.Sprintf(`{"Color":"blue","ID":"asset%d","Owner":"Tomoko","Size":5}`, i))))
+	}
+	require.NoError(t, stub.PutState("asset1-note", []byte("not JSON")))
+	require.NoError(t, stub.PutState("asset2-listing", []byte(`{"AssetID":"asset2","Price":100}`)))
+	require.NoError(t, stub.PutState("asset3-offer", []byte(`{"AssetID":"asset3","Owner":"Tomoko"}`)))
+	require.NoError(t, ctx.end(nil))
+
+	page, err := assetTransfer.MigrateAssets(ctx, 2, "")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.MigrationPage{Bookmark: "asset3", Migrated: 2, Scanned: 2}, page)
+
+	page, err = assetTransfer.MigrateAssets(ctx, 2, page.Bookmark)
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.MigrationPage{Migrated: 1, Scanned: 1}, page)
+
+	for i := 1; i <= 3; i++ {
+		require.Equal(t, 2, storedSchemaVersion(t, stub.GetState, fmt.Sprintf("asset%d", i)))
+	}
+	for key, value := range map[string]string{
+		"asset1-note":    "not JSON",
+		"asset2-listing": `{"AssetID":"asset2","Price":100}`,
+		"asset3-offer":   `{"AssetID":"asset3","Owner":"Tomoko"}`,
+	} {
+		stored, err := stub.GetState(key)
+		require.NoError(t, err)
+		require.Equal(t, value, string(stored), "%s is not an asset", key)
+	}
+}
+
+func TestSetAssetCategory(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+
+	requireCode(t, ctx.end(assetTransfer.SetAssetCategory(ctx, "asset1", "Fine Art")), chaincode.ErrInvalidArgument, "invalid asset asset1: Category must match [a-z]+(-[a-z]+)*")
+	stub.StartTransaction("tx-category")
+	require.NoError(t, ctx.end(assetTransfer.SetAssetCategory(ctx, "asset1", "fine-art")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, "fine-art", asset.Category)
+	require.Equal(t, "2024-01-01T00:00:01Z", asset.CreatedAt)
+	require.Equal(t, "2024-01-01T00:00:02Z", asset.UpdatedAt)
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.SetAssetCategory(ctx, "asset1", "other"))))
+}
+
+// storedSchemaVersion returns the SchemaVersion of the record under key as it
+// is in the world state, 1 if it has none.
+func storedSchemaVersion(t *testing.T, getState func(string) ([]byte, error), key string) int {
+	assetJSON, err := getState(key)
+	require.NoError(t, err)
+	var record struct{ SchemaVersion int }
+	require.NoError(t, json.Unmarshal(assetJSON, &record))
+	if record.SchemaVersion == 0 {
+		return 1
+	}
+	return record.SchemaVersion
+}
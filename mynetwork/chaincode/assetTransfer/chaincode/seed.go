@@ -0,0 +1,135 @@
+package chaincode
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// appraisalsTransientKey is the transient map key of the appraisals of assets
+// loaded with InitLedgerFromJSON, as {"asset1": {"AppraisedValue": 300,
+// "Salt": "..."}, ...}.
+const appraisalsTransientKey = "appraisals"
+
+// maxSeedAssets bounds the assets InitLedgerFromJSON loads in one transaction.
+const maxSeedAssets = 1000
+
+// What InitLedgerFromJSON does with an asset whose ID is already taken.
+const (
+	SeedModeSkip = "skip"
+	SeedModeFail = "fail"
+)
+
+// SeedAsset is an asset to load with InitLedgerFromJSON. Category defaults to
+// "general".
+type SeedAsset struct {
+	Category  string `json:"Category"`
+	Color     string `json:"Color"`
+	ID        string `json:"ID"`
+	OwnerName string `json:"OwnerName"`
+	Size      int    `json:"Size"`
+}
+
+// SeedResult reports the assets InitLedgerFromJSON created, and the IDs it
+// skipped because they were taken.
+type SeedResult struct {
+	Created int      `json:"Created"`
+	Skipped []string `json:"Skipped"`
+}
+
+// InitLedgerFromJSON loads the assets of assetsJSON, a JSON array of
+// SeedAsset, owned by the caller. Their appraisals are passed in the
+// transient map under key "appraisals", by asset ID, and kept in the implicit
+// collection of the caller's org. Every asset must follow the rules on the
+// Asset schema of the chaincode metadata. mode is "skip" to leave assets whose ID is taken
+// alone, or "fail" to load nothing then. Only admins can call it.
+func (a *AdminContract) InitLedgerFromJSON(ctx contractapi.TransactionContextInterface, assetsJSON string, mode string) (*SeedResult, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if mode != SeedModeSkip && mode != SeedModeFail {
+		return nil, invalidArgument("mode must be %q or %q", SeedModeSkip, SeedModeFail)
+	}
+	var seeds []SeedAsset
+	if err := json.Unmarshal([]byte(assetsJSON), &seeds); err != nil {
+		return nil, invalidArgument("the assets must be a JSON array: %v", err)
+	}
+	if len(seeds) == 0 || len(seeds) > maxSeedAssets {
+		return nil, invalidArgument("there must be 1 to %d assets", maxSeedAssets)
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, err
+	}
+	appraisals := map[string]*Appraisal{}
+	if appraisalsJSON, ok := transientMap[appraisalsTransientKey]; ok {
+		if err := json.Unmarshal(appraisalsJSON, &appraisals); err != nil {
+			return nil, invalidArgument("failed to unmarshal the appraisals: %v", err)
+		}
+	}
+	return seedAssets(ctx, seeds, appraisals, mode)
+}
+
+// seedAssets creates the assets of seeds with the appraisals of their IDs.
+func seedAssets(ctx contractapi.TransactionContextInterface, seeds []SeedAsset, appraisals map[string]*Appraisal, mode string) (*SeedResult, error) {
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// check every asset before writing any, so that a batch is loaded whole
+	result := &SeedResult{Skipped: []string{}}
+	seen := map[string]bool{}
+	var assets []*Asset
+	for _, seed := range seeds {
+		if seen[seed.ID] {
+			return nil, invalidArgument("asset %s is listed more than once", seed.ID)
+		}
+		seen[seed.ID] = true
+
+		exists, err := (&AssetContract{}).AssetExists(ctx, seed.ID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			if mode == SeedModeFail {
+				return nil, assetExists(seed.ID)
+			}
+			result.Skipped = append(result.Skipped, seed.ID)
+			continue
+		}
+
+		appraisal := appraisals[seed.ID]
+		if appraisal == nil || appraisal.Salt == "" {
+			return nil, invalidArgument("asset %s needs an appraisal with a salt", seed.ID)
+		}
+		asset := &Asset{
+			Category:  seed.Category,
+			Color:     seed.Color,
+			ID:        seed.ID,
+			Owner:     caller,
+			OwnerName: seed.OwnerName,
+			Size:      seed.Size,
+			Status:    StatusActive,
+		}
+		if asset.Category == "" {
+			asset.Category = defaultCategory
+		}
+		if err := validateAsset(ctx, asset, appraisal); err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+
+	for _, asset := range assets {
+		if err := storeAppraisal(ctx, asset, appraisals[asset.ID]); err != nil {
+			return nil, err
+		}
+		if err := putAsset(ctx, nil, asset); err != nil {
+			return nil, err
+		}
+		result.Created++
+	}
+	return result, nil
+}
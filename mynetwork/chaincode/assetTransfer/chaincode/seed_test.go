@@ -0,0 +1,97 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitLedgerFromJSON(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	appraisals := func(appraisalsJSON string) {
+		stub.SetTransient(map[string][]byte{"appraisals": []byte(appraisalsJSON)})
+	}
+	assetsJSON := `[{"ID":"asset1","Color":"blue","Size":5,"OwnerName":"Tomoko"},{"ID":"asset2","Color":"red","Size":5,"OwnerName":"Brad","Category":"vehicle"}]`
+
+	_, err := assetTransfer.InitLedgerFromJSON(ctx, assetsJSON, "replace")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidArgument, `mode must be "skip" or "fail"`)
+	_, err = assetTransfer.InitLedgerFromJSON(ctx, `{"ID":"asset1"}`, chaincode.SeedModeSkip)
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidArgument, "the assets must be a JSON array: json: cannot unmarshal object into Go value of type []chaincode.SeedAsset")
+	_, err = assetTransfer.InitLedgerFromJSON(ctx, `[]`, chaincode.SeedModeSkip)
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidArgument, "there must be 1 to 1000 assets")
+
+	appraisals(`{"asset1":{"AppraisedValue":300,"Salt":"salt1"}}`)
+	_, err = assetTransfer.InitLedgerFromJSON(ctx, assetsJSON, chaincode.SeedModeSkip)
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidArgument, "asset asset2 needs an appraisal with a salt")
+	_, err = assetTransfer.InitLedgerFromJSON(ctx, `[{"ID":"asset1","Color":"blue","Size":5},{"ID":"asset1","Color":"red","Size":5}]`, chaincode.SeedModeSkip)
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidArgument, "asset asset1 is listed more than once")
+
+	// the assets are validated like those of CreateAsset
+	appraisals(`{"asset1":{"AppraisedValue":300,"Salt":"salt1"},"asset2":{"AppraisedValue":-1,"Salt":"salt2"}}`)
+	_, err = assetTransfer.InitLedgerFromJSON(ctx, `[{"ID":"asset1","Color":"blue","Size":5},{"ID":"asset2","Color":"Red","Size":5}]`, chaincode.SeedModeSkip)
+	ctx.end(err)
+	contractError, ok := chaincode.AsContractError(err)
+	require.True(t, ok)
+	require.Equal(t, map[string]string{"Color": "must match [a-z]+( [a-z]+)*", "AppraisedValue": "must be at least 0"}, contractError.Details)
+
+	appraisals(`{"asset1":{"AppraisedValue":300,"Salt":"salt1"},"asset2":{"AppraisedValue":400,"Salt":"salt2"}}`)
+	result, err := assetTransfer.InitLedgerFromJSON(ctx, assetsJSON, chaincode.SeedModeFail)
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.SeedResult{Created: 2, Skipped: []string{}}, result)
+	asset, err := assetTransfer.ReadAsset(ctx, "asset2")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Asset{ID: "asset2", Color: "red", Size: 5, Owner: org1Admin, OwnerName: "Brad", Status: chaincode.StatusActive, Category: "vehicle", SchemaVersion: 2, CreatedAt: "2024-01-01T00:00:01Z", UpdatedAt: "2024-01-01T00:00:01Z", AppraisalHash: appraisalHash("asset2", 400, "salt2")}, asset)
+	appraisal, err := assetTransfer.ReadAppraisal(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, 300, appraisal.AppraisedValue)
+
+	// a taken ID fails the whole batch, or is left alone
+	moreJSON := `[{"ID":"asset3","Color":"green","Size":10,"OwnerName":"Jin Soo"},{"ID":"asset1","Color":"yellow","Size":5}]`
+	appraisals(`{"asset1":{"AppraisedValue":900,"Salt":"salt4"},"asset3":{"AppraisedValue":500,"Salt":"salt3"}}`)
+	_, err = assetTransfer.InitLedgerFromJSON(ctx, moreJSON, chaincode.SeedModeFail)
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrAssetExists, "the asset asset1 already exists")
+	exists, err := assetTransfer.AssetExists(ctx, "asset3")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	result, err = assetTransfer.InitLedgerFromJSON(ctx, moreJSON, chaincode.SeedModeSkip)
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.SeedResult{Created: 1, Skipped: []string{"asset1"}}, result)
+	asset, err = assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, "blue", asset.Color)
+	assets, err := assetTransfer.GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Len(t, assets, 3)
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	_, err = assetTransfer.InitLedgerFromJSON(ctx, `[{"ID":"asset4","Color":"blue","Size":5}]`, chaincode.SeedModeSkip)
+	ctx.end(err)
+	require.True(t, chaincode.IsAccessDenied(err))
+}
+
+func TestInitLedgerFromJSONQuota(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	require.NoError(t, ctx.end(assetTransfer.SetMSPQuota(ctx, "Org1MSP", 1, 0)))
+
+	stub.SetTransient(map[string][]byte{"appraisals": []byte(`{"asset1":{"AppraisedValue":300,"Salt":"salt1"},"asset2":{"AppraisedValue":400,"Salt":"salt2"}}`)})
+	_, err := assetTransfer.InitLedgerFromJSON(ctx, `[{"ID":"asset1","Color":"blue","Size":5},{"ID":"asset2","Color":"red","Size":5}]`, chaincode.SeedModeFail)
+	ctx.end(err)
+	requireQuotaExceeded(t, err, "MaxAssets", org1Admin+" would hold 2 assets, the quota is 1")
+	exists, err := assetTransfer.AssetExists(ctx, "asset1")
+	require.NoError(t, err)
+	require.False(t, exists, "nothing of the batch is loaded")
+}
@@ -0,0 +1,438 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// A fractionalized asset is owned in shares. The shares and the approvals of
+// whole-asset operations are kept under the asset.
+const (
+	fractionObjectType      = "asset~fraction"
+	shareObjectType         = "share~holder"
+	shareApprovalObjectType = "share~approval"
+)
+
+const (
+	assetFractionalizedEvent = "AssetFractionalized"
+	sharesTransferredEvent   = "SharesTransferred"
+	assetRecombinedEvent     = "AssetRecombined"
+)
+
+// Fraction records how an asset was split into shares. An operation on the
+// whole asset needs the approval of holders of at least MajorityPercent of the
+// shares. TxID tells the fractionalizations of an asset apart, so approvals do
+// not carry over from one to the next.
+type Fraction struct {
+	AssetID         string `json:"AssetID"`
+	MajorityPercent int    `json:"MajorityPercent"`
+	TotalShares     int    `json:"TotalShares"`
+	TxID            string `json:"TxID"`
+}
+
+// Shareholding is the number of shares of an asset a client identity holds.
+type Shareholding struct {
+	Holder string `json:"Holder"`
+	Shares int    `json:"Shares"`
+}
+
+// SharesTransfer is the payload of the SharesTransferred event.
+type SharesTransfer struct {
+	AssetID string `json:"AssetID"`
+	From    string `json:"From"`
+	Shares  int    `json:"Shares"`
+	To      string `json:"To"`
+}
+
+// FractionalizeAsset splits an active asset into totalShares shares, all held
+// by the owner at first. Afterwards, operations on the whole asset, such as
+// UpdateAsset or RetireAsset, need the approval of holders of at least
+// majorityPercent of the shares, see ApproveAssetOperation, and the asset can
+// only change hands through its shares. Only the owner or an admin of the
+// owner's org can call it.
+func (a *AssetContract) FractionalizeAsset(ctx contractapi.TransactionContextInterface, id string, totalShares int, majorityPercent int) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if err := requireWhole(asset); err != nil {
+		return err
+	}
+	if _, isIdentity := ownerMSPID(asset.Owner); !isIdentity {
+		return invalidStatus(id, "the owner %s of asset %s is not a client identity, update the asset first", asset.Owner, id)
+	}
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return err
+	}
+	if totalShares < 2 {
+		return invalidArgument("an asset must be split into at least 2 shares")
+	}
+	if majorityPercent <= 50 || majorityPercent > 100 {
+		return invalidArgument("the majority must be more than 50 and at most 100 percent")
+	}
+
+	fraction := &Fraction{
+		AssetID:         id,
+		MajorityPercent: majorityPercent,
+		TotalShares:     totalShares,
+		TxID:            ctx.GetStub().GetTxID(),
+	}
+	fractionJSON, err := json.Marshal(fraction)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(fractionObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, fractionJSON); err != nil {
+		return err
+	}
+	if err := putShares(ctx, id, asset.Owner, totalShares); err != nil {
+		return err
+	}
+	if err := dropOwnerGrants(ctx, id); err != nil {
+		return err
+	}
+	old := *asset
+	asset.TotalShares = totalShares
+	if err := putAsset(ctx, &old, asset); err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(assetFractionalizedEvent, fractionJSON)
+}
+
+// TransferShares moves shares of an active asset from the caller to
+// recipient, a client identity as returned by WhoAmI. Shares of a regulated
+// asset only go to whom its transfer restriction allows.
+func (a *AssetContract) TransferShares(ctx contractapi.TransactionContextInterface, id string, recipient string, shares int) error {
+	if _, err := readFraction(ctx, id); err != nil {
+		return err
+	}
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return err
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	if _, isIdentity := ownerMSPID(recipient); !isIdentity {
+		return invalidArgument("recipient %s is not a client identity", recipient)
+	}
+	if recipient == caller {
+		return invalidArgument("cannot transfer shares to the same holder")
+	}
+	if shares <= 0 {
+		return invalidArgument("the number of shares must be positive")
+	}
+	held, err := readShares(ctx, id, caller)
+	if err != nil {
+		return err
+	}
+	if held < shares {
+		return invalidArgument("%s holds %d shares of asset %s, not the %d needed", caller, held, id, shares)
+	}
+	received, err := readShares(ctx, id, recipient)
+	if err != nil {
+		return err
+	}
+	if err := requireSharesAllowed(ctx, id, recipient, received == 0, held == shares); err != nil {
+		return err
+	}
+
+	if err := putShares(ctx, id, caller, held-shares); err != nil {
+		return err
+	}
+	if err := putShares(ctx, id, recipient, received+shares); err != nil {
+		return err
+	}
+	transferJSON, err := json.Marshal(SharesTransfer{AssetID: id, From: caller, Shares: shares, To: recipient})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(sharesTransferredEvent, transferJSON)
+}
+
+// GetShareholders returns the holders of the shares of an asset.
+func (q *QueryContract) GetShareholders(ctx contractapi.TransactionContextInterface, id string) ([]*Shareholding, error) {
+	if _, err := readFraction(ctx, id); err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(shareObjectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var holdings []*Shareholding
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		shares, err := strconv.Atoi(string(queryResponse.Value))
+		if err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, &Shareholding{Holder: attributes[1], Shares: shares})
+	}
+	return holdings, nil
+}
+
+// ApproveAssetOperation approves the call of function with params on a
+// fractionalized asset, e.g. "RetireAsset" with ["asset1", "scrapped"]. A call
+// that takes private data, such as the appraisal of UpdateAsset, is approved
+// with the same transient map passed. The call goes through once holders of
+// the majority of the shares approved it, counting the holder who makes it.
+// Only shareholders can call it.
+func (a *AssetContract) ApproveAssetOperation(ctx contractapi.TransactionContextInterface, id string, function string, params []string) error {
+	fraction, err := readFraction(ctx, id)
+	if err != nil {
+		return err
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	held, err := readShares(ctx, id, caller)
+	if err != nil {
+		return err
+	}
+	if held == 0 {
+		return &AccessDeniedError{Caller: caller, Reason: "holds no shares of asset " + id}
+	}
+
+	hash, err := operationHash(ctx, fraction, function, params)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(shareApprovalObjectType, []string{id, hash, caller})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte{0x00})
+}
+
+// RecombineAsset makes the caller, who must hold every share, the sole owner
+// of a fractionalized asset again.
+func (a *AssetContract) RecombineAsset(ctx contractapi.TransactionContextInterface, id string) error {
+	fraction, err := readFraction(ctx, id)
+	if err != nil {
+		return err
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	held, err := readShares(ctx, id, caller)
+	if err != nil {
+		return err
+	}
+	if held != fraction.TotalShares {
+		return &AccessDeniedError{Caller: caller, Reason: fmt.Sprintf("holds %d of the %d shares of asset %s", held, fraction.TotalShares, id)}
+	}
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, objectType := range []string{fractionObjectType, shareObjectType, shareApprovalObjectType} {
+		if err := deleteByPartialKey(ctx, objectType, id); err != nil {
+			return err
+		}
+	}
+	old := *asset
+	asset.Owner = caller
+	asset.TotalShares = 0
+	if err := putAsset(ctx, &old, asset); err != nil {
+		return err
+	}
+	fractionJSON, err := json.Marshal(fraction)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(assetRecombinedEvent, fractionJSON)
+}
+
+// requireWhole returns an error for a fractionalized asset, which changes hands
+// through its shares rather than as a whole.
+func requireWhole(asset *Asset) error {
+	if asset.TotalShares > 0 {
+		return invalidStatus(asset.ID, "the asset %s is fractionalized, transfer its shares instead", asset.ID)
+	}
+	return nil
+}
+
+// authorizeShareholders is authorizeOwner for a fractionalized asset. It lets
+// through a shareholder whose call, with the arguments and transient map of
+// the current transaction, holders of the majority of the shares approved, and
+// uses up the approvals.
+func authorizeShareholders(ctx contractapi.TransactionContextInterface, asset *Asset) (string, error) {
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	fraction, err := readFraction(ctx, asset.ID)
+	if err != nil {
+		return "", err
+	}
+	held, err := readShares(ctx, asset.ID, caller)
+	if err != nil {
+		return "", err
+	}
+	if held == 0 {
+		return "", &AccessDeniedError{Caller: caller, Reason: "holds no shares of asset " + asset.ID}
+	}
+
+	function, params := functionAndParameters(ctx)
+	hash, err := operationHash(ctx, fraction, function, params)
+	if err != nil {
+		return "", err
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(shareApprovalObjectType, []string{asset.ID, hash})
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	approved := held
+	var approvalKeys []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return "", err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return "", err
+		}
+		approvalKeys = append(approvalKeys, queryResponse.Key)
+		if attributes[2] == caller {
+			continue
+		}
+		// shares may have moved since the approval, so count the current ones
+		shares, err := readShares(ctx, asset.ID, attributes[2])
+		if err != nil {
+			return "", err
+		}
+		approved += shares
+	}
+	if approved*100 < fraction.TotalShares*fraction.MajorityPercent {
+		return "", &AccessDeniedError{Caller: caller, Reason: fmt.Sprintf("has the approval of holders of %d of the %d shares of asset %s, which is less than %d%%", approved, fraction.TotalShares, asset.ID, fraction.MajorityPercent)}
+	}
+
+	for _, key := range approvalKeys {
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return "", err
+		}
+	}
+	return caller, nil
+}
+
+// operationHash identifies a call of function with params, and the transient
+// map of the transaction, on a fractionalized asset. The transient map goes in
+// as a hash, so the approval does not disclose it.
+func operationHash(ctx contractapi.TransactionContextInterface, fraction *Fraction, function string, params []string) (string, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transient map: %v", err)
+	}
+	transientHash := ""
+	if len(transientMap) > 0 {
+		// the keys of a map are marshaled in order
+		transientJSON, err := json.Marshal(transientMap)
+		if err != nil {
+			return "", err
+		}
+		hash := sha256.Sum256(transientJSON)
+		transientHash = hex.EncodeToString(hash[:])
+	}
+	operationJSON, err := json.Marshal(append([]string{fraction.TxID, function, transientHash}, params...))
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(operationJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func readFraction(ctx contractapi.TransactionContextInterface, id string) (*Fraction, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(fractionObjectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	fractionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if fractionJSON == nil {
+		return nil, invalidStatus(id, "the asset %s is not fractionalized", id)
+	}
+
+	var fraction Fraction
+	if err := json.Unmarshal(fractionJSON, &fraction); err != nil {
+		return nil, err
+	}
+	return &fraction, nil
+}
+
+func readShares(ctx contractapi.TransactionContextInterface, id string, holder string) (int, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(shareObjectType, []string{id, holder})
+	if err != nil {
+		return 0, err
+	}
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, stateReadFailed(err)
+	}
+	if value == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(value))
+}
+
+// putShares records the shares of a holder, removing holders left with none.
+func putShares(ctx contractapi.TransactionContextInterface, id string, holder string, shares int) error {
+	key, err := ctx.GetStub().CreateCompositeKey(shareObjectType, []string{id, holder})
+	if err != nil {
+		return err
+	}
+	if shares == 0 {
+		return ctx.GetStub().DelState(key)
+	}
+	return ctx.GetStub().PutState(key, []byte(strconv.Itoa(shares)))
+}
+
+func deleteByPartialKey(ctx contractapi.TransactionContextInterface, objectType string, id string) error {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{id})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().DelState(queryResponse.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
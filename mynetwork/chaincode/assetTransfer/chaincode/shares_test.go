@@ -0,0 +1,116 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFractionalizeAsset(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	second := setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	third := setCaller(t, ctx, stub, "Org3MSP", "Investor@org3.guolong.com", "client")
+	first := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+
+	requireCode(t, ctx.end(assetTransfer.FractionalizeAsset(ctx, "asset1", 1, 60)), chaincode.ErrInvalidArgument, "an asset must be split into at least 2 shares")
+	requireCode(t, ctx.end(assetTransfer.FractionalizeAsset(ctx, "asset1", 100, 50)), chaincode.ErrInvalidArgument, "the majority must be more than 50 and at most 100 percent")
+	require.NoError(t, ctx.end(assetTransfer.FractionalizeAsset(ctx, "asset1", 100, 60)))
+	require.Equal(t, "AssetFractionalized", stub.Event().EventName)
+	requireCode(t, ctx.end(assetTransfer.FractionalizeAsset(ctx, "asset1", 100, 60)), chaincode.ErrInvalidStatus, "the asset asset1 is fractionalized, transfer its shares instead")
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, 100, asset.TotalShares)
+
+	// the asset changes hands through its shares only
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", second, "Investor")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 is fractionalized, transfer its shares instead")
+	requireCode(t, ctx.end(assetTransfer.ListAsset(ctx, "asset1", 500)), chaincode.ErrInvalidStatus, "the asset asset1 is fractionalized, transfer its shares instead")
+
+	requireCode(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", second, 101)), chaincode.ErrInvalidArgument, first+" holds 100 shares of asset asset1, not the 101 needed")
+	requireCode(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", first, 1)), chaincode.ErrInvalidArgument, "cannot transfer shares to the same holder")
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", second, 30)))
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", third, 25)))
+	require.Equal(t, "SharesTransferred", stub.Event().EventName)
+	holders, err := assetTransfer.GetShareholders(ctx, "asset1")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*chaincode.Shareholding{{Holder: first, Shares: 45}, {Holder: second, Shares: 30}, {Holder: third, Shares: 25}}, holders)
+
+	// recombining needs every share
+	requireCode(t, ctx.end(assetTransfer.RecombineAsset(ctx, "asset1")), chaincode.ErrAccessDenied, "access denied: "+first+" holds 45 of the 100 shares of asset asset1")
+	setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", first, 30)))
+	setCaller(t, ctx, stub, "Org3MSP", "Investor@org3.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", first, 25)))
+	requireCode(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", first, 1)), chaincode.ErrInvalidArgument, third+" holds 0 shares of asset asset1, not the 1 needed")
+
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.RecombineAsset(ctx, "asset1")))
+	asset, err = assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, first, asset.Owner)
+	require.Zero(t, asset.TotalShares)
+	_, err = assetTransfer.GetShareholders(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the asset asset1 is not fractionalized")
+}
+
+func TestMajorityApproval(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	second := setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org3MSP", "Outsider@org3.guolong.com", "client")
+	first := setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Seller")))
+	require.NoError(t, ctx.end(assetTransfer.FractionalizeAsset(ctx, "asset1", 100, 60)))
+	require.NoError(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", second, 65)))
+	stub.SetTransient(nil)
+
+	// 35 shares are not a 60% majority
+	stub.SetArgs("UpdateAsset", "asset1", "red", "5", "Seller")
+	err := ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller"))
+	requireCode(t, err, chaincode.ErrAccessDenied, "access denied: "+first+" has the approval of holders of 35 of the 100 shares of asset asset1, which is less than 60%")
+
+	setCaller(t, ctx, stub, "Org3MSP", "Outsider@org3.guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.ApproveAssetOperation(ctx, "asset1", "UpdateAsset", []string{"asset1", "red", "5", "Seller"}))))
+
+	// an approval only counts for the call it names
+	setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.ApproveAssetOperation(ctx, "asset1", "UpdateAsset", []string{"asset1", "green", "5", "Seller"})))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller"))))
+
+	setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.ApproveAssetOperation(ctx, "asset1", "UpdateAsset", []string{"asset1", "red", "5", "Seller"})))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller")))
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, "red", asset.Color)
+
+	// the approval is used up
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller"))))
+
+	// and names the private data of the call, here the appraisal
+	setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.ApproveAssetOperation(ctx, "asset1", "UpdateAsset", []string{"asset1", "red", "5", "Seller"})))
+	setCaller(t, ctx, stub, "Org1MSP", "Seller@guolong.com", "client")
+	appraise(stub, 900)
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller"))))
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 5, "Seller")))
+	stub.SetTransient(nil)
+
+	// the majority holder alone may retire the asset
+	setCaller(t, ctx, stub, "Org2MSP", "Investor@org2.guolong.com", "client")
+	stub.SetArgs("RetireAsset", "asset1", "scrapped")
+	require.NoError(t, ctx.end(assetTransfer.RetireAsset(ctx, "asset1", "scrapped")))
+
+	// and the shares of a retired asset no longer move
+	requireCode(t, ctx.end(assetTransfer.TransferShares(ctx, "asset1", first, 10)), chaincode.ErrInvalidStatus, "the asset asset1 is retired")
+}
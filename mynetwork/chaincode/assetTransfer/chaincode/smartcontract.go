@@ -1,172 +1,363 @@
 package chaincode
 
 import (
-	"encoding/json"
-	"fmt"
-
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 )
 
-// SmartContract provides functions for managing an Asset
-type SmartContract struct {
-	contractapi.Contract
+// AssetContract provides functions for managing an Asset: creating, reading,
+// updating, deleting and transferring it, and the trades, locks and splits
+// built on those. The read-only listings are on QueryContract, and
+// initialization and configuration on AdminContract. It is the default
+// contract of the chaincode, so its transactions can also be called without a
+// name, e.g. ReadAsset for asset:ReadAsset, as before the contracts were split.
+// GetAllAssets, which moved to QueryContract, is kept on it for those callers.
+type AssetContract struct {
+	Contract
+}
+
+// GetName returns the name the asset transactions are called under, e.g.
+// asset:CreateAsset.
+func (a *AssetContract) GetName() string {
+	return "asset"
 }
 
 // Asset describes basic details of what makes up a simple asset
 // Insert struct field in alphabetic order => to achieve determinism across languages
 // golang keeps the order when marshal to json but doesn't order automatically
+//
+// Owner is the client identity of the owner, as returned by WhoAmI, and
+// OwnerName is only for display. Assets written before identities were
+// enforced have a free-text Owner until they are next changed.
+//
+// The appraisal is private to the owner's org, see Appraisal, and only its hash
+// is public. AppraisedValue is only set on assets written before that, and is
+// dropped the next time they are changed.
+//
+// Status is where the asset is in its lifecycle, see lifecycle.go, and
+// StatusReason why it got there. Assets written before the lifecycle are
+// active. TokenURI points to metadata for the NFT interface,
+// see NFTContract. TotalShares is set while the asset is owned in shares, see
+// FractionalizeAsset; Owner is then who fractionalized it. Parents and
+// Children link assets split or merged into others, see SplitAsset.
+//
+// SchemaVersion is the version of this layout the asset was written in, see
+// schema.go. CreatedAt and UpdatedAt are the RFC 3339 times of the
+// transactions that created and last wrote the asset; CreatedAt is empty for
+// assets created before it was recorded.
+//
+// The documents attached to an asset are kept apart from it, and Attachments
+// is only set by ReadAssetWithDocuments.
+//
+// The fields left out of the JSON when empty are optional in the contract
+// metadata, which the chaincode checks the assets it returns against.
 type Asset struct {
-	AppraisedValue int    `json:"AppraisedValue"`
-	Color          string `json:"Color"`
-	ID             string `json:"ID"`
-	Owner          string `json:"Owner"`
-	Size           int    `json:"Size"`
+	AppraisalHash  string        `json:"AppraisalHash"`
+	AppraisedValue int           `json:"AppraisedValue,omitempty" metadata:",optional"`
+	Attachments    []*Attachment `json:"Attachments,omitempty" metadata:",optional"`
+	Category       string        `json:"Category"`
+	Children       []string      `json:"Children,omitempty" metadata:",optional"`
+	Color          string        `json:"Color"`
+	CreatedAt      string        `json:"CreatedAt,omitempty" metadata:",optional"`
+	ID             string        `json:"ID"`
+	Owner          string        `json:"Owner"`
+	OwnerName      string        `json:"OwnerName"`
+	Parents        []string      `json:"Parents,omitempty" metadata:",optional"`
+	SchemaVersion  int           `json:"SchemaVersion"`
+	Size           int           `json:"Size"`
+	Status         string        `json:"Status"`
+	StatusReason   string        `json:"StatusReason"`
+	TokenURI       string        `json:"TokenURI,omitempty" metadata:",optional"`
+	TotalShares    int           `json:"TotalShares,omitempty" metadata:",optional"`
+	UpdatedAt      string        `json:"UpdatedAt"`
 }
 
-// InitLedger adds a base set of assets to the ledger
-func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
-	assets := []Asset{
-		{ID: "asset1", Color: "blue", Size: 5, Owner: "Tomoko", AppraisedValue: 300},
-		{ID: "asset2", Color: "red", Size: 5, Owner: "Brad", AppraisedValue: 400},
-		{ID: "asset3", Color: "green", Size: 10, Owner: "Jin Soo", AppraisedValue: 500},
-		{ID: "asset4", Color: "yellow", Size: 10, Owner: "Max", AppraisedValue: 600},
-		{ID: "asset5", Color: "black", Size: 15, Owner: "Adriana", AppraisedValue: 700},
-		{ID: "asset6", Color: "white", Size: 15, Owner: "Michel", AppraisedValue: 800},
-	}
+// Attachment is a document kept off chain, such as a certificate or an
+// invoice, that an asset refers to by the hex SHA-256 Hash of its content, see
+// AttachDocument. Type is what kind of document it is and URI where it can be
+// fetched from. AttachedBy is the client identity that attached it, at the
+// RFC 3339 time AttachedAt.
+type Attachment struct {
+	AssetID    string `json:"AssetID"`
+	AttachedAt string `json:"AttachedAt"`
+	AttachedBy string `json:"AttachedBy"`
+	Hash       string `json:"Hash"`
+	Type       string `json:"Type"`
+	URI        string `json:"URI"`
+}
 
-	for _, asset := range assets {
-		assetJSON, err := json.Marshal(asset)
-		if err != nil {
-			return err
-		}
+// InitLedger adds a base set of sample assets to the ledger, owned by the
+// caller and appraised in the implicit collection of the caller's org. The
+// salt of the sample appraisals is the transaction ID, which is public, so
+// they are only fit for development and InitLedger only runs in DevMode.
+// Other channels load their assets with InitLedgerFromJSON. Sample assets
+// that exist already are left alone. Only admins can call it.
+func (a *AdminContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	if !a.DevMode {
+		return newContractError(ErrInvalidStatus, nil, "the sample assets are only for development, load assets with InitLedgerFromJSON")
+	}
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
 
-		err = ctx.GetStub().PutState(asset.ID, assetJSON)
-		if err != nil {
-			return fmt.Errorf("failed to put to world state. %v", err)
-		}
+	assets := []SeedAsset{
+		{ID: "asset1", Color: "blue", Size: 5, OwnerName: "Tomoko"},
+		{ID: "asset2", Color: "red", Size: 5, OwnerName: "Brad"},
+		{ID: "asset3", Color: "green", Size: 10, OwnerName: "Jin Soo"},
+		{ID: "asset4", Color: "yellow", Size: 10, OwnerName: "Max"},
+		{ID: "asset5", Color: "black", Size: 15, OwnerName: "Adriana"},
+		{ID: "asset6", Color: "white", Size: 15, OwnerName: "Michel"},
 	}
+	appraisedValues := []int{300, 400, 500, 600, 700, 800}
 
-	return nil
+	appraisals := map[string]*Appraisal{}
+	for i, asset := range assets {
+		appraisals[asset.ID] = &Appraisal{AppraisedValue: appraisedValues[i], Salt: ctx.GetStub().GetTxID()}
+	}
+	_, err := seedAssets(ctx, assets, appraisals, SeedModeSkip)
+	return err
 }
 
-// CreateAsset issues a new asset to the world state with given details.
-func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, id string, color string, size int, owner string, appraisedValue int) error {
-	exists, err := s.AssetExists(ctx, id)
+// CreateAsset issues a new asset to the world state with given details. The
+// caller becomes the owner, and ownerName is the name shown for them. The
+// appraisal is passed in the transient map under key "appraisal", as
+// {"AppraisedValue": 300, "Salt": "..."}. The asset must follow the rules
+// on the Asset schema of the chaincode metadata, and fit in the quota of the
+// caller, see SetOwnerQuota.
+func (a *AssetContract) CreateAsset(ctx contractapi.TransactionContextInterface, id string, color string, size int, ownerName string) error {
+	exists, err := a.AssetExists(ctx, id)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("the asset %s already exists", id)
+		return assetExists(id)
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
 	}
 
 	asset := Asset{
-		ID:             id,
-		Color:          color,
-		Size:           size,
-		Owner:          owner,
-		AppraisedValue: appraisedValue,
+		Category:  defaultCategory,
+		ID:        id,
+		Color:     color,
+		Size:      size,
+		Owner:     caller,
+		OwnerName: ownerName,
+		Status:    StatusActive,
 	}
-	assetJSON, err := json.Marshal(asset)
+	appraisal, err := transientAppraisal(ctx)
 	if err != nil {
 		return err
 	}
+	if appraisal == nil {
+		return errNoAppraisal
+	}
+	if err := validateAsset(ctx, &asset, appraisal); err != nil {
+		return err
+	}
+	if err := storeAppraisal(ctx, &asset, appraisal); err != nil {
+		return err
+	}
 
-	return ctx.GetStub().PutState(id, assetJSON)
+	return putAsset(ctx, nil, &asset)
 }
 
 // ReadAsset returns the asset stored in the world state with given id.
-func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
+func (a *AssetContract) ReadAsset(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
+	return readAsset(ctx, id)
+}
+
+// readAsset is ReadAsset, for the contracts other than AssetContract too.
+func readAsset(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
 	assetJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, stateReadFailed(err)
 	}
 	if assetJSON == nil {
-		return nil, fmt.Errorf("the asset %s does not exist", id)
-	}
-
-	var asset Asset
-	err = json.Unmarshal(assetJSON, &asset)
-	if err != nil {
-		return nil, err
+		return nil, assetNotFound(id)
 	}
 
-	return &asset, nil
+	return unmarshalAsset(assetJSON)
 }
 
-// UpdateAsset updates an existing asset in the world state with provided parameters.
-func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface, id string, color string, size int, owner string, appraisedValue int) error {
-	exists, err := s.AssetExists(ctx, id)
+// UpdateAsset updates an existing asset in the world state with provided
+// parameters. A new appraisal can be passed in the transient map as for
+// CreateAsset, and is required if the asset has none yet. Only the owner or an
+// admin of the owner's org can call it, and ownership itself only changes
+// through TransferAsset. Only active assets can be updated, and they must
+// follow the rules on the Asset schema of the chaincode metadata.
+func (a *AssetContract) UpdateAsset(ctx contractapi.TransactionContextInterface, id string, color string, size int, ownerName string) error {
+	asset, err := a.ReadAsset(ctx, id)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the asset %s does not exist", id)
+	caller, err := authorizeOwner(ctx, asset)
+	if err != nil {
+		return err
 	}
-
-	// overwriting original asset with new asset
-	asset := Asset{
-		ID:             id,
-		Color:          color,
-		Size:           size,
-		Owner:          owner,
-		AppraisedValue: appraisedValue,
+	if err := releaseExpiredOffer(ctx, asset); err != nil {
+		return err
 	}
-	assetJSON, err := json.Marshal(asset)
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return err
+	}
+	old := *asset
+	migrateOwner(asset, caller)
+
+	appraisal, err := transientAppraisal(ctx)
 	if err != nil {
 		return err
 	}
+	if appraisal == nil && asset.AppraisalHash == "" {
+		return errNoAppraisal
+	}
+	asset.Color = color
+	asset.Size = size
+	asset.OwnerName = ownerName
+	asset.AppraisedValue = 0
+	if err := validateAsset(ctx, asset, appraisal); err != nil {
+		return err
+	}
+	if appraisal != nil {
+		if err := storeAppraisal(ctx, asset, appraisal); err != nil {
+			return err
+		}
+	}
 
-	return ctx.GetStub().PutState(id, assetJSON)
+	return putAsset(ctx, &old, asset)
 }
 
-// DeleteAsset deletes an given asset from the world state.
-func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.AssetExists(ctx, id)
+// SetAssetCategory sets the category of an active asset, which follows the
+// Category rule on the Asset schema of the chaincode metadata. New assets are
+// in category "general". Only the owner or an admin of the owner's org can
+// call it.
+func (a *AssetContract) SetAssetCategory(ctx contractapi.TransactionContextInterface, id string, category string) error {
+	asset, err := a.ReadAsset(ctx, id)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the asset %s does not exist", id)
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
 	}
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return err
+	}
+	if problem := assetRule("Category").check(category); problem != "" {
+		return newContractError(ErrInvalidArgument, map[string]string{"Category": problem}, "invalid asset %s: Category %s", id, problem)
+	}
+	old := *asset
+	asset.Category = category
+	return putAsset(ctx, &old, asset)
+}
 
-	return ctx.GetStub().DelState(id)
+// DeleteAsset deletes an given asset from the world state, along with its
+// documents, its transfer restriction and its appraisal if the caller's org
+// holds it. Only the owner or an admin of the
+// owner's org can call it. RetireAsset takes an asset out of use but keeps it
+// on record, and frozen or locked assets cannot be deleted.
+func (a *AssetContract) DeleteAsset(ctx contractapi.TransactionContextInterface, id string) error {
+	asset, err := a.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireWhole(asset); err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return err
+	}
+	if err := requireStatus(asset, StatusActive, StatusRetired); err != nil {
+		return err
+	}
+	collection, err := callerCollection(ctx)
+	if err != nil {
+		return err
+	}
+	if err := removeAppraisal(ctx, collection, id); err != nil {
+		return err
+	}
+	if err := dropOwnerGrants(ctx, id); err != nil {
+		return err
+	}
+	if err := deleteDocuments(ctx, id); err != nil {
+		return err
+	}
+	if err := deleteRestriction(ctx, id); err != nil {
+		return err
+	}
+
+	return deleteAsset(ctx, asset)
 }
 
 // AssetExists returns true when asset with given ID exists in world state
-func (s *SmartContract) AssetExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+func (a *AssetContract) AssetExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
 	assetJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return false, stateReadFailed(err)
 	}
 
 	return assetJSON != nil, nil
 }
 
-// TransferAsset updates the owner field of asset with given id in world state, and returns the old owner.
-func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface, id string, newOwner string) (string, error) {
-	asset, err := s.ReadAsset(ctx, id)
+// TransferAsset updates the owner of asset with given id in world state, and
+// returns the old owner. newOwner is a client identity as returned by WhoAmI.
+// Only the owner or an admin of the owner's org can call it, and only once
+// newOwner called AgreeToBuy and the hashes of the prices the seller and the
+// buyer agreed to match. Only active assets can be transferred, and regulated
+// ones only to whom their transfer restriction allows, see
+// ComplianceContract. The documents attached to the asset go with it, and it
+// must fit in the quota of newOwner.
+func (a *AssetContract) TransferAsset(ctx contractapi.TransactionContextInterface, id string, newOwner string, newOwnerName string) (string, error) {
+	asset, err := a.ReadAsset(ctx, id)
 	if err != nil {
 		return "", err
 	}
+	if err := requireWhole(asset); err != nil {
+		return "", err
+	}
+	if _, err := authorizeOwner(ctx, asset); err != nil {
+		return "", err
+	}
+	if err := releaseExpiredOffer(ctx, asset); err != nil {
+		return "", err
+	}
+	if err := requireStatus(asset, StatusActive); err != nil {
+		return "", err
+	}
+	if _, isIdentity := ownerMSPID(newOwner); !isIdentity {
+		return "", invalidArgument("new owner %s is not a client identity", newOwner)
+	}
+	if err := requireTransferAllowed(ctx, id, newOwner); err != nil {
+		return "", err
+	}
+	if err := settleAgreement(ctx, asset, newOwner); err != nil {
+		return "", err
+	}
+	if err := dropOwnerGrants(ctx, id); err != nil {
+		return "", err
+	}
 
-	oldOwner := asset.Owner
+	old := *asset
 	asset.Owner = newOwner
+	asset.OwnerName = newOwnerName
+	asset.AppraisedValue = 0
 
-	assetJSON, err := json.Marshal(asset)
+	err = putAsset(ctx, &old, asset)
 	if err != nil {
 		return "", err
 	}
 
-	err = ctx.GetStub().PutState(id, assetJSON)
-	if err != nil {
-		return "", err
-	}
+	return old.Owner, nil
+}
 
-	return oldOwner, nil
+// GetAllAssets is QueryContract.GetAllAssets, for the callers from before the
+// contracts were split, who name no contract.
+func (a *AssetContract) GetAllAssets(ctx contractapi.TransactionContextInterface) ([]*Asset, error) {
+	return (&QueryContract{}).GetAllAssets(ctx)
 }
 
 // GetAllAssets returns all assets found in world state
-func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface) ([]*Asset, error) {
+func (q *QueryContract) GetAllAssets(ctx contractapi.TransactionContextInterface) ([]*Asset, error) {
 	// range query with empty string for startKey and endKey does an
 	// open-ended query of all assets in the chaincode namespace.
 	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
@@ -185,12 +376,11 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 			return nil, err
 		}
 
-		var asset Asset
-		err = json.Unmarshal(queryResponse.Value, &asset)
+		asset, err := unmarshalAsset(queryResponse.Value)
 		if err != nil {
 			return nil, err
 		}
-		assets = append(assets, &asset)
+		assets = append(assets, asset)
 	}
 
 	return assets, nil
@@ -1,16 +1,18 @@
 package chaincode_test
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"testing"
 
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
-	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
 	"github.com/stretchr/testify/require"
+	"guolong.com/memstub"
 )
 
 //go:generate counterfeiter -o mocks/transaction.go -fake-name TransactionContext . transactionContext
@@ -28,157 +30,338 @@ type stateQueryIterator interface {
 	shim.StateQueryIteratorInterface
 }
 
-func TestInitLedger(t *testing.T) {
+// org1Admin is the client identity newTransactionContext submits as.
+const org1Admin = "Org1MSP::x509::CN=Admin@guolong.com,OU=admin::CN=ca.Org1MSP"
+
+// contracts puts the transactions of the asset, query and admin contracts on
+// one value, for the tests that span them.
+type contracts struct {
+	*chaincode.AssetContract
+	*chaincode.QueryContract
+	*chaincode.AdminContract
+}
+
+func newContracts() contracts {
+	return contracts{&chaincode.AssetContract{}, &chaincode.QueryContract{}, &chaincode.AdminContract{}}
+}
+
+// GetAllAssets is on the asset contract too, for callers that name no
+// contract.
+func (c contracts) GetAllAssets(ctx contractapi.TransactionContextInterface) ([]*chaincode.Asset, error) {
+	return c.QueryContract.GetAllAssets(ctx)
+}
+
+// testContext is the context the contracts run with on a peer, over an
+// in-memory world state. The contract calls of a test are transactions of
+// their own once they are ended with end.
+type testContext struct {
+	chaincode.TransactionContext
+	stub *memstub.MemStub
+}
+
+// end ends the transaction of a contract call that returned err, committing
+// its writes if err is nil, see MemStub.EndTransaction, and gives the next
+// transaction a fresh context, as a peer does. It returns err, so that the call
+// can be wrapped in it.
+func (c *testContext) end(err error) error {
+	c.stub.EndTransaction(err)
+	clientIdentity := c.GetClientIdentity()
+	c.TransactionContext = chaincode.TransactionContext{}
+	c.SetStub(c.stub)
+	c.SetClientIdentity(clientIdentity)
+	return err
+}
+
+// newTransactionContext returns a context backed by an in-memory world state,
+// submitted by the Org1 admin.
+func newTransactionContext(t *testing.T) (*testContext, *memstub.MemStub) {
+	stub := memstub.New()
+	ctx := &testContext{stub: stub}
+	ctx.SetStub(stub)
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	return ctx, stub
+}
+
+// setCaller makes commonName in mspID the submitting client and returns it in
+// the form roles and owners are recorded in.
+func setCaller(t *testing.T, ctx *testContext, stub *memstub.MemStub, mspID, commonName string, ous ...string) string {
+	t.Helper()
+	require.NoError(t, stub.SetIdentity(mspID, commonName, ous...))
+	clientIdentity, err := cid.New(stub)
+	require.NoError(t, err)
+	ctx.SetClientIdentity(clientIdentity)
+
+	caller, err := newContracts().WhoAmI(ctx)
+	require.NoError(t, err)
+	return caller
+}
+
+// appraise passes an appraisal in the transient map of the current transaction,
+// as clients do for CreateAsset and UpdateAsset.
+func appraise(stub *memstub.MemStub, appraisedValue int) {
+	stub.SetTransient(map[string][]byte{"appraisal": []byte(fmt.Sprintf(`{"AppraisedValue":%d,"Salt":"salt"}`, appraisedValue))})
+}
+
+// requireCode asserts that err reaches clients as a ContractError with code and
+// message.
+func requireCode(t *testing.T, err error, code chaincode.ErrorCode, message string) {
+	t.Helper()
+	contractError, ok := chaincode.AsContractError(err)
+	require.True(t, ok, "%v has no error code", err)
+	require.Equal(t, code, contractError.Code)
+	require.Equal(t, message, contractError.Message)
+}
+
+// appraisalHash returns the AppraisalHash of an asset appraised at
+// appraisedValue with salt.
+func appraisalHash(id string, appraisedValue int, salt string) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf(`{"AppraisedValue":%d,"AssetID":%q,"Salt":%q}`, appraisedValue, id, salt)))
+	return hex.EncodeToString(hash[:])
+}
+
+// failingPutStub rejects every write, for the error paths the in-memory world
+// state cannot produce once roles have been set up.
+type failingPutStub struct {
+	*memstub.MemStub
+	err error
+}
+
+func (s *failingPutStub) PutState(string, []byte) error {
+	return s.err
+}
+
+func (s *failingPutStub) DelState(string) error {
+	return s.err
+}
+
+// newFailingContext returns a context whose stub is a counterfeiter fake, for
+// injecting ledger errors that the in-memory stub never produces.
+func newFailingContext() (*mocks.TransactionContext, *mocks.ChaincodeStub) {
 	chaincodeStub := &mocks.ChaincodeStub{}
 	transactionContext := &mocks.TransactionContext{}
 	transactionContext.GetStubReturns(chaincodeStub)
+	return transactionContext, chaincodeStub
+}
+
+func TestInitLedger(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	err := ctx.end(assetTransfer.InitLedger(ctx))
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the sample assets are only for development, load assets with InitLedgerFromJSON")
+
+	assetTransfer.DevMode = true
+	err = ctx.end(assetTransfer.InitLedger(ctx))
+	requireCode(t, err, chaincode.ErrInvalidStatus, "the contract is not initialized, call Initialize first")
+
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	ctx.SetStub(&failingPutStub{MemStub: stub, err: fmt.Errorf("failed inserting key")})
+	err = ctx.end(assetTransfer.InitLedger(ctx))
+	requireCode(t, err, chaincode.ErrStateWriteFailed, "failed to put to world state. failed inserting key")
+
+	ctx.SetStub(stub)
+	err = ctx.end(assetTransfer.InitLedger(ctx))
+	require.NoError(t, err)
+
+	assets, err := assetTransfer.GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Len(t, assets, 6)
+	require.Equal(t, &chaincode.Asset{ID: "asset1", Color: "blue", Size: 5, Owner: org1Admin, OwnerName: "Tomoko", Status: chaincode.StatusActive, Category: "general", SchemaVersion: 2, CreatedAt: "2024-01-01T00:00:01Z", UpdatedAt: "2024-01-01T00:00:01Z", AppraisalHash: appraisalHash("asset1", 300, stub.TxID)}, assets[0])
+	appraisal, err := assetTransfer.ReadAppraisal(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, 300, appraisal.AppraisedValue)
 
-	assetTransfer := chaincode.SmartContract{}
-	err := assetTransfer.InitLedger(transactionContext)
+	// the samples are only added once
+	require.NoError(t, ctx.end(assetTransfer.InitLedger(ctx)))
+	assets, err = assetTransfer.GetAllAssets(ctx)
 	require.NoError(t, err)
+	require.Len(t, assets, 6)
 
-	chaincodeStub.PutStateReturns(fmt.Errorf("failed inserting key"))
-	err = assetTransfer.InitLedger(transactionContext)
-	require.EqualError(t, err, "failed to put to world state. failed inserting key")
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	err = ctx.end(assetTransfer.InitLedger(ctx))
+	require.True(t, chaincode.IsAccessDenied(err))
 }
 
 func TestCreateAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	err := ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
+	requireCode(t, err, chaincode.ErrInvalidArgument, `the appraisal must be passed in the transient map under key "appraisal"`)
+	stub.SetTransient(map[string][]byte{"appraisal": []byte(`{"AppraisedValue":300}`)})
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
+	requireCode(t, err, chaincode.ErrInvalidArgument, "the appraisal must have a salt")
+
+	appraise(stub, 300)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
+	require.NoError(t, err)
 
-	assetTransfer := chaincode.SmartContract{}
-	err := assetTransfer.CreateAsset(transactionContext, "", "", 0, "", 0)
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Asset{ID: "asset1", Color: "blue", Size: 5, Owner: org1Admin, OwnerName: "Tomoko", Status: chaincode.StatusActive, Category: "general", SchemaVersion: 2, CreatedAt: "2024-01-01T00:00:01Z", UpdatedAt: "2024-01-01T00:00:01Z", AppraisalHash: appraisalHash("asset1", 300, "salt")}, asset)
+	appraisal, err := assetTransfer.ReadAppraisal(ctx, "asset1")
 	require.NoError(t, err)
+	require.Equal(t, &chaincode.Appraisal{AppraisedValue: 300, AssetID: "asset1", Salt: "salt"}, appraisal)
 
-	chaincodeStub.GetStateReturns([]byte{}, nil)
-	err = assetTransfer.CreateAsset(transactionContext, "asset1", "", 0, "", 0)
-	require.EqualError(t, err, "the asset asset1 already exists")
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "red", 0, "Brad"))
+	requireCode(t, err, chaincode.ErrAssetExists, "the asset asset1 already exists")
 
+	failingCtx, chaincodeStub := newFailingContext()
 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	err = assetTransfer.CreateAsset(transactionContext, "asset1", "", 0, "", 0)
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	err = assetTransfer.CreateAsset(failingCtx, "asset1", "blue", 5, "Tomoko")
+	requireCode(t, err, chaincode.ErrStateReadFailed, "failed to read from world state: unable to retrieve asset")
 }
 
 func TestReadAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
+	requireCode(t, err, chaincode.ErrAssetNotFound, "the asset asset1 does not exist")
+	require.Nil(t, asset)
 
-	expectedAsset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(expectedAsset)
+	appraise(stub, 300)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
 	require.NoError(t, err)
-
-	chaincodeStub.GetStateReturns(bytes, nil)
-	assetTransfer := chaincode.SmartContract{}
-	asset, err := assetTransfer.ReadAsset(transactionContext, "")
+	asset, err = assetTransfer.ReadAsset(ctx, "asset1")
 	require.NoError(t, err)
-	require.Equal(t, expectedAsset, asset)
+	require.Equal(t, "Tomoko", asset.OwnerName)
 
+	failingCtx, chaincodeStub := newFailingContext()
 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	_, err = assetTransfer.ReadAsset(transactionContext, "")
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
-
-	chaincodeStub.GetStateReturns(nil, nil)
-	asset, err = assetTransfer.ReadAsset(transactionContext, "asset1")
-	require.EqualError(t, err, "the asset asset1 does not exist")
-	require.Nil(t, asset)
+	_, err = assetTransfer.ReadAsset(failingCtx, "asset1")
+	requireCode(t, err, chaincode.ErrStateReadFailed, "failed to read from world state: unable to retrieve asset")
 }
 
 func TestUpdateAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	err := ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
+	requireCode(t, err, chaincode.ErrAssetNotFound, "the asset asset1 does not exist")
 
-	expectedAsset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(expectedAsset)
+	appraise(stub, 300)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
+	require.NoError(t, err)
+	appraise(stub, 400)
+	err = ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "red", 10, "Brad"))
 	require.NoError(t, err)
 
-	chaincodeStub.GetStateReturns(bytes, nil)
-	assetTransfer := chaincode.SmartContract{}
-	err = assetTransfer.UpdateAsset(transactionContext, "", "", 0, "", 0)
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
 	require.NoError(t, err)
+	require.Equal(t, &chaincode.Asset{ID: "asset1", Color: "red", Size: 10, Owner: org1Admin, OwnerName: "Brad", Status: chaincode.StatusActive, Category: "general", SchemaVersion: 2, CreatedAt: "2024-01-01T00:00:01Z", UpdatedAt: "2024-01-01T00:00:01Z", AppraisalHash: appraisalHash("asset1", 400, "salt")}, asset)
 
-	chaincodeStub.GetStateReturns(nil, nil)
-	err = assetTransfer.UpdateAsset(transactionContext, "asset1", "", 0, "", 0)
-	require.EqualError(t, err, "the asset asset1 does not exist")
+	// the appraisal stays when no new one is passed
+	stub.SetTransient(nil)
+	err = ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "green", 10, "Brad"))
+	require.NoError(t, err)
+	asset, err = assetTransfer.ReadAsset(ctx, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, appraisalHash("asset1", 400, "salt"), asset.AppraisalHash)
 
+	failingCtx, chaincodeStub := newFailingContext()
 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	err = assetTransfer.UpdateAsset(transactionContext, "asset1", "", 0, "", 0)
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	err = assetTransfer.UpdateAsset(failingCtx, "asset1", "blue", 5, "Tomoko")
+	requireCode(t, err, chaincode.ErrStateReadFailed, "failed to read from world state: unable to retrieve asset")
 }
 
 func TestDeleteAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	err := ctx.end(assetTransfer.DeleteAsset(ctx, "asset1"))
+	requireCode(t, err, chaincode.ErrAssetNotFound, "the asset asset1 does not exist")
 
-	asset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(asset)
+	appraise(stub, 300)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
+	require.NoError(t, err)
+	err = ctx.end(assetTransfer.DeleteAsset(ctx, "asset1"))
 	require.NoError(t, err)
 
-	chaincodeStub.GetStateReturns(bytes, nil)
-	chaincodeStub.DelStateReturns(nil)
-	assetTransfer := chaincode.SmartContract{}
-	err = assetTransfer.DeleteAsset(transactionContext, "")
+	exists, err := assetTransfer.AssetExists(ctx, "asset1")
 	require.NoError(t, err)
+	require.False(t, exists)
 
-	chaincodeStub.GetStateReturns(nil, nil)
-	err = assetTransfer.DeleteAsset(transactionContext, "asset1")
-	require.EqualError(t, err, "the asset asset1 does not exist")
+	appraise(stub, 300)
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+	ctx.SetStub(&failingPutStub{MemStub: stub, err: fmt.Errorf("failed deleting key")})
+	err = ctx.end(assetTransfer.DeleteAsset(ctx, "asset1"))
+	requireCode(t, err, chaincode.ErrStateWriteFailed, "failed to put to world state. failed deleting key")
 
+	failingCtx, chaincodeStub := newFailingContext()
 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	err = assetTransfer.DeleteAsset(transactionContext, "")
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	err = assetTransfer.DeleteAsset(failingCtx, "asset1")
+	requireCode(t, err, chaincode.ErrStateReadFailed, "failed to read from world state: unable to retrieve asset")
 }
 
 func TestTransferAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
-
-	asset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(asset)
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	brad := setCaller(t, ctx, stub, "Org2MSP", "Brad@org2.guolong.com", "client")
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	_, err := assetTransfer.TransferAsset(ctx, "asset1", brad, "Brad")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrAssetNotFound, "the asset asset1 does not exist")
+
+	appraise(stub, 300)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
+	require.NoError(t, err)
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", "Brad", "Brad")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidArgument, "new owner Brad is not a client identity")
+	_, err = assetTransfer.TransferAsset(ctx, "asset1", brad, "Brad")
+	ctx.end(err)
+	requireCode(t, err, chaincode.ErrInvalidStatus, brad+" has not agreed to buy asset asset1")
+
+	agreeOnPrice(t, ctx, stub, "asset1", 500, "Org2MSP", "Brad@org2.guolong.com", "client")
+	oldOwner, err := assetTransfer.TransferAsset(ctx, "asset1", brad, "Brad")
+	ctx.end(err)
 	require.NoError(t, err)
+	require.Equal(t, org1Admin, oldOwner)
 
-	chaincodeStub.GetStateReturns(bytes, nil)
-	assetTransfer := chaincode.SmartContract{}
-	_, err = assetTransfer.TransferAsset(transactionContext, "", "")
+	asset, err := assetTransfer.ReadAsset(ctx, "asset1")
 	require.NoError(t, err)
+	require.Equal(t, brad, asset.Owner)
+	require.Equal(t, "Brad", asset.OwnerName)
 
+	failingCtx, chaincodeStub := newFailingContext()
 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	_, err = assetTransfer.TransferAsset(transactionContext, "", "")
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	_, err = assetTransfer.TransferAsset(failingCtx, "asset1", brad, "Brad")
+	requireCode(t, err, chaincode.ErrStateReadFailed, "failed to read from world state: unable to retrieve asset")
 }
 
 func TestGetAllAssets(t *testing.T) {
-	asset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(asset)
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	assets, err := assetTransfer.GetAllAssets(ctx)
 	require.NoError(t, err)
+	require.Empty(t, assets)
 
-	iterator := &mocks.StateQueryIterator{}
-	iterator.HasNextReturnsOnCall(0, true)
-	iterator.HasNextReturnsOnCall(1, false)
-	iterator.NextReturns(&queryresult.KV{Value: bytes}, nil)
-
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+	appraise(stub, 400)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset2", "red", 5, "Brad"))
+	require.NoError(t, err)
+	appraise(stub, 300)
+	err = ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko"))
+	require.NoError(t, err)
+	// composite keys live outside the open-ended range GetAllAssets reads
+	indexKey, err := stub.CreateCompositeKey("color~id", []string{"blue", "asset1"})
+	require.NoError(t, err)
+	require.NoError(t, stub.PutState(indexKey, []byte{0x00}))
+	require.NoError(t, ctx.end(nil))
 
-	chaincodeStub.GetStateByRangeReturns(iterator, nil)
-	assetTransfer := &chaincode.SmartContract{}
-	assets, err := assetTransfer.GetAllAssets(transactionContext)
+	assets, err = assetTransfer.GetAllAssets(ctx)
 	require.NoError(t, err)
-	require.Equal(t, []*chaincode.Asset{asset}, assets)
+	require.Equal(t, []*chaincode.Asset{
+		{ID: "asset1", Color: "blue", Size: 5, Owner: org1Admin, OwnerName: "Tomoko", Status: chaincode.StatusActive, Category: "general", SchemaVersion: 2, CreatedAt: "2024-01-01T00:00:01Z", UpdatedAt: "2024-01-01T00:00:01Z", AppraisalHash: appraisalHash("asset1", 300, "salt")},
+		{ID: "asset2", Color: "red", Size: 5, Owner: org1Admin, OwnerName: "Brad", Status: chaincode.StatusActive, Category: "general", SchemaVersion: 2, CreatedAt: "2024-01-01T00:00:01Z", UpdatedAt: "2024-01-01T00:00:01Z", AppraisalHash: appraisalHash("asset2", 400, "salt")},
+	}, assets)
 
+	iterator := &mocks.StateQueryIterator{}
 	iterator.HasNextReturns(true)
 	iterator.NextReturns(nil, fmt.Errorf("failed retrieving next item"))
-	assets, err = assetTransfer.GetAllAssets(transactionContext)
+	failingCtx, chaincodeStub := newFailingContext()
+	chaincodeStub.GetStateByRangeReturns(iterator, nil)
+	assets, err = assetTransfer.GetAllAssets(failingCtx)
 	require.EqualError(t, err, "failed retrieving next item")
 	require.Nil(t, assets)
 
 	chaincodeStub.GetStateByRangeReturns(nil, fmt.Errorf("failed retrieving all assets"))
-	assets, err = assetTransfer.GetAllAssets(transactionContext)
+	assets, err = assetTransfer.GetAllAssets(failingCtx)
 	require.EqualError(t, err, "failed retrieving all assets")
 	require.Nil(t, assets)
 }
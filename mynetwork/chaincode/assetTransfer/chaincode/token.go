@@ -0,0 +1,323 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Token state lives in the composite key namespace, next to the assets but out
+// of the range GetAllAssets reads. Accounts are client identities, as returned
+// by WhoAmI.
+const (
+	tokenIssuerObject    = "token~issuer"
+	tokenSupplyObject    = "token~supply"
+	tokenBalanceObject   = "token~balance"
+	tokenAllowanceObject = "token~allowance"
+)
+
+const (
+	tokenTransferEvent = "Transfer"
+	tokenApprovalEvent = "Approval"
+)
+
+// TokenContract is an ERC-20 style fungible token that assets are paid for
+// with, see BuyAsset. Only clients of the issuer MSP, set by the contract
+// owner, can mint and burn tokens.
+type TokenContract struct {
+	Contract
+}
+
+// TransferEvent is the payload of the Transfer event. From is empty when
+// tokens are minted, and To when they are burned.
+type TransferEvent struct {
+	From  string `json:"From"`
+	To    string `json:"To"`
+	Value int    `json:"Value"`
+}
+
+// ApprovalEvent is the payload of the Approval event.
+type ApprovalEvent struct {
+	Owner   string `json:"Owner"`
+	Spender string `json:"Spender"`
+	Value   int    `json:"Value"`
+}
+
+// GetName returns the name the token transactions are called under, e.g.
+// token:Transfer.
+func (t *TokenContract) GetName() string {
+	return "token"
+}
+
+// SetIssuer sets the MSP whose clients can mint and burn tokens. Only the
+// contract owner can call it.
+func (t *TokenContract) SetIssuer(ctx contractapi.TransactionContextInterface, mspID string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+	if mspID == "" {
+		return invalidArgument("issuer MSP ID must not be empty")
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(tokenIssuerObject, []string{})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte(mspID))
+}
+
+// GetIssuer returns the MSP whose clients can mint and burn tokens.
+func (t *TokenContract) GetIssuer(ctx contractapi.TransactionContextInterface) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenIssuerObject, []string{})
+	if err != nil {
+		return "", err
+	}
+	issuer, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", stateReadFailed(err)
+	}
+	if issuer == nil {
+		return "", newContractError(ErrInvalidStatus, nil, "the token issuer is not set, call SetIssuer first")
+	}
+	return string(issuer), nil
+}
+
+// Mint creates amount tokens in the caller's account. Only clients of the
+// issuer MSP can call it.
+func (t *TokenContract) Mint(ctx contractapi.TransactionContextInterface, amount int) error {
+	minter, err := t.requireIssuer(ctx)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return invalidArgument("the amount must be positive")
+	}
+
+	supplyKey, err := ctx.GetStub().CreateCompositeKey(tokenSupplyObject, []string{})
+	if err != nil {
+		return err
+	}
+	supply, err := readTokenAmount(ctx, supplyKey)
+	if err != nil {
+		return err
+	}
+	supply, err = addTokens(supply, amount)
+	if err != nil {
+		return err
+	}
+	if err := credit(ctx, minter, amount); err != nil {
+		return err
+	}
+	if err := putTokenAmount(ctx, supplyKey, supply); err != nil {
+		return err
+	}
+	return setTokenEvent(ctx, tokenTransferEvent, TransferEvent{To: minter, Value: amount})
+}
+
+// Burn destroys amount tokens from the caller's account. Only clients of the
+// issuer MSP can call it.
+func (t *TokenContract) Burn(ctx contractapi.TransactionContextInterface, amount int) error {
+	minter, err := t.requireIssuer(ctx)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return invalidArgument("the amount must be positive")
+	}
+
+	if err := debit(ctx, minter, amount); err != nil {
+		return err
+	}
+	supplyKey, err := ctx.GetStub().CreateCompositeKey(tokenSupplyObject, []string{})
+	if err != nil {
+		return err
+	}
+	supply, err := readTokenAmount(ctx, supplyKey)
+	if err != nil {
+		return err
+	}
+	if err := putTokenAmount(ctx, supplyKey, supply-amount); err != nil {
+		return err
+	}
+	return setTokenEvent(ctx, tokenTransferEvent, TransferEvent{From: minter, Value: amount})
+}
+
+// Transfer moves amount tokens from the caller's account to recipient.
+func (t *TokenContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount int) error {
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	return transferTokens(ctx, caller, recipient, amount)
+}
+
+// BalanceOf returns the number of tokens in an account.
+func (t *TokenContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenBalanceObject, []string{account})
+	if err != nil {
+		return 0, err
+	}
+	return readTokenAmount(ctx, key)
+}
+
+// TotalSupply returns the number of tokens minted and not burned.
+func (t *TokenContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenSupplyObject, []string{})
+	if err != nil {
+		return 0, err
+	}
+	return readTokenAmount(ctx, key)
+}
+
+// Approve lets spender move up to value tokens out of the caller's account
+// with TransferFrom, in place of any earlier allowance.
+func (t *TokenContract) Approve(ctx contractapi.TransactionContextInterface, spender string, value int) error {
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	if value < 0 {
+		return invalidArgument("the allowance must not be negative")
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(tokenAllowanceObject, []string{caller, spender})
+	if err != nil {
+		return err
+	}
+	if err := putTokenAmount(ctx, key, value); err != nil {
+		return err
+	}
+	return setTokenEvent(ctx, tokenApprovalEvent, ApprovalEvent{Owner: caller, Spender: spender, Value: value})
+}
+
+// Allowance returns the number of tokens spender may still move out of the
+// account of owner.
+func (t *TokenContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenAllowanceObject, []string{owner, spender})
+	if err != nil {
+		return 0, err
+	}
+	return readTokenAmount(ctx, key)
+}
+
+// TransferFrom moves value tokens from the account of from to to, out of the
+// allowance from gave the caller.
+func (t *TokenContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+	spender, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(tokenAllowanceObject, []string{from, spender})
+	if err != nil {
+		return err
+	}
+	allowance, err := readTokenAmount(ctx, key)
+	if err != nil {
+		return err
+	}
+	if allowance < value {
+		return invalidArgument("%s may only move %d tokens of %s", spender, allowance, from)
+	}
+
+	if err := transferTokens(ctx, from, to, value); err != nil {
+		return err
+	}
+	return putTokenAmount(ctx, key, allowance-value)
+}
+
+func (t *TokenContract) requireIssuer(ctx contractapi.TransactionContextInterface) (string, error) {
+	issuer, err := t.GetIssuer(ctx)
+	if err != nil {
+		return "", err
+	}
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	if mspID, _ := ownerMSPID(caller); mspID != issuer {
+		return "", &AccessDeniedError{Caller: caller, Reason: "is not a client of the token issuer " + issuer}
+	}
+	return caller, nil
+}
+
+// transferTokens moves amount tokens from one account to another and emits a
+// Transfer event.
+func transferTokens(ctx contractapi.TransactionContextInterface, from string, to string, amount int) error {
+	if amount <= 0 {
+		return invalidArgument("the amount must be positive")
+	}
+	if _, isIdentity := ownerMSPID(to); !isIdentity {
+		return invalidArgument("recipient %s is not a client identity", to)
+	}
+	if from == to {
+		return invalidArgument("cannot transfer tokens to the same account")
+	}
+	if err := debit(ctx, from, amount); err != nil {
+		return err
+	}
+	if err := credit(ctx, to, amount); err != nil {
+		return err
+	}
+	return setTokenEvent(ctx, tokenTransferEvent, TransferEvent{From: from, To: to, Value: amount})
+}
+
+func credit(ctx contractapi.TransactionContextInterface, account string, amount int) error {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenBalanceObject, []string{account})
+	if err != nil {
+		return err
+	}
+	balance, err := readTokenAmount(ctx, key)
+	if err != nil {
+		return err
+	}
+	balance, err = addTokens(balance, amount)
+	if err != nil {
+		return err
+	}
+	return putTokenAmount(ctx, key, balance)
+}
+
+func debit(ctx contractapi.TransactionContextInterface, account string, amount int) error {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenBalanceObject, []string{account})
+	if err != nil {
+		return err
+	}
+	balance, err := readTokenAmount(ctx, key)
+	if err != nil {
+		return err
+	}
+	if balance < amount {
+		return invalidArgument("%s has %d tokens, not the %d needed", account, balance, amount)
+	}
+	return putTokenAmount(ctx, key, balance-amount)
+}
+
+func addTokens(a int, b int) (int, error) {
+	if a > math.MaxInt-b {
+		return 0, invalidArgument("the token amount would overflow")
+	}
+	return a + b, nil
+}
+
+func readTokenAmount(ctx contractapi.TransactionContextInterface, key string) (int, error) {
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, stateReadFailed(err)
+	}
+	if value == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(value))
+}
+
+func putTokenAmount(ctx contractapi.TransactionContextInterface, key string, amount int) error {
+	return ctx.GetStub().PutState(key, []byte(strconv.Itoa(amount)))
+}
+
+func setTokenEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(name, payloadJSON)
+}
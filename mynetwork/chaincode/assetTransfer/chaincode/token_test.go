@@ -0,0 +1,78 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMintAndBurn(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	token := chaincode.TokenContract{}
+	require.NoError(t, ctx.end(newContracts().Initialize(ctx)))
+	requireCode(t, ctx.end(token.Mint(ctx, 100)), chaincode.ErrInvalidStatus, "the token issuer is not set, call SetIssuer first")
+
+	user := setCaller(t, ctx, stub, "Org2MSP", "User1@org2.guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(token.SetIssuer(ctx, "Org2MSP"))), "only the contract owner sets the issuer")
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(token.SetIssuer(ctx, "BankMSP")))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(token.Mint(ctx, 100))))
+
+	bank := setCaller(t, ctx, stub, "BankMSP", "Teller@bank.guolong.com", "client")
+	requireCode(t, ctx.end(token.Mint(ctx, 0)), chaincode.ErrInvalidArgument, "the amount must be positive")
+	require.NoError(t, ctx.end(token.Mint(ctx, 100)))
+	require.Equal(t, "Transfer", stub.Event().EventName)
+	require.JSONEq(t, `{"From":"","To":"`+bank+`","Value":100}`, string(stub.Event().Payload))
+	require.NoError(t, ctx.end(token.Transfer(ctx, user, 30)))
+	require.NoError(t, ctx.end(token.Burn(ctx, 50)))
+	requireCode(t, ctx.end(token.Burn(ctx, 50)), chaincode.ErrInvalidArgument, bank+" has 20 tokens, not the 50 needed")
+
+	supply, err := token.TotalSupply(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 50, supply)
+	balance, err := token.BalanceOf(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, 30, balance)
+
+	// token state is not mistaken for assets
+	assets, err := newContracts().GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Empty(t, assets)
+}
+
+func TestTokenTransfer(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	token := chaincode.TokenContract{}
+	require.NoError(t, ctx.end(newContracts().Initialize(ctx)))
+	require.NoError(t, ctx.end(token.SetIssuer(ctx, "Org1MSP")))
+	spender := setCaller(t, ctx, stub, "Org3MSP", "Broker@org3.guolong.com", "client")
+	recipient := setCaller(t, ctx, stub, "Org2MSP", "User1@org2.guolong.com", "client")
+	owner := setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(token.Mint(ctx, 100)))
+
+	requireCode(t, ctx.end(token.Transfer(ctx, "User1", 10)), chaincode.ErrInvalidArgument, "recipient User1 is not a client identity")
+	requireCode(t, ctx.end(token.Transfer(ctx, owner, 10)), chaincode.ErrInvalidArgument, "cannot transfer tokens to the same account")
+	requireCode(t, ctx.end(token.Transfer(ctx, recipient, -10)), chaincode.ErrInvalidArgument, "the amount must be positive")
+
+	requireCode(t, ctx.end(token.Approve(ctx, spender, -1)), chaincode.ErrInvalidArgument, "the allowance must not be negative")
+	require.NoError(t, ctx.end(token.Approve(ctx, spender, 40)))
+	require.Equal(t, "Approval", stub.Event().EventName)
+	allowance, err := token.Allowance(ctx, owner, spender)
+	require.NoError(t, err)
+	require.Equal(t, 40, allowance)
+
+	setCaller(t, ctx, stub, "Org3MSP", "Broker@org3.guolong.com", "client")
+	require.NoError(t, ctx.end(token.TransferFrom(ctx, owner, recipient, 25)))
+	requireCode(t, ctx.end(token.TransferFrom(ctx, owner, recipient, 25)), chaincode.ErrInvalidArgument, spender+" may only move 15 tokens of "+owner)
+	allowance, err = token.Allowance(ctx, owner, spender)
+	require.NoError(t, err)
+	require.Equal(t, 15, allowance)
+
+	balance, err := token.BalanceOf(ctx, owner)
+	require.NoError(t, err)
+	require.Equal(t, 75, balance)
+	balance, err = token.BalanceOf(ctx, recipient)
+	require.NoError(t, err)
+	require.Equal(t, 25, balance)
+}
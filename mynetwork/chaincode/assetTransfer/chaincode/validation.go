@@ -0,0 +1,215 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// The colors assets may have are kept under a composite key, set by admins
+// with SetAllowedColors. Any color is allowed until they are set.
+const allowedColorsObjectType = "config~colors"
+
+// FieldRule is how a field of an asset is validated. GetAssetRules returns the
+// rules, so that clients can check their input before they submit it. Pattern
+// is a regular expression the whole value must match, and Enum the values
+// allowed if set. MaxLength bounds strings, in characters, and Minimum and
+// Maximum bound integers.
+type FieldRule struct {
+	Enum      []string `json:"Enum,omitempty" metadata:",optional"`
+	Field     string   `json:"Field"`
+	MaxLength int      `json:"MaxLength"`
+	Maximum   int      `json:"Maximum"`
+	Minimum   int      `json:"Minimum"`
+	Pattern   string   `json:"Pattern"`
+	Required  bool     `json:"Required"`
+	Type      string   `json:"Type"`
+
+	// pattern is Pattern compiled to match the whole value
+	pattern *regexp.Regexp
+}
+
+// assetRules are the rules for the fields of an asset. AppraisedValue is that
+// of the appraisal passed in the transient map.
+var assetRules = compileRules(
+	FieldRule{Field: "ID", Type: "string", Required: true, Pattern: `[A-Za-z0-9][A-Za-z0-9._-]*`, MaxLength: 64},
+	FieldRule{Field: "Category", Type: "string", Required: true, Pattern: `[a-z]+(-[a-z]+)*`, MaxLength: 32},
+	FieldRule{Field: "Color", Type: "string", Required: true, Pattern: `[a-z]+( [a-z]+)*`, MaxLength: 32},
+	FieldRule{Field: "Size", Type: "integer", Minimum: 1, Maximum: 1000000},
+	FieldRule{Field: "Owner", Type: "string", Required: true, Pattern: `[^:]+::.+`},
+	FieldRule{Field: "OwnerName", Type: "string", Pattern: `[^\x00-\x1f]*`, MaxLength: 128},
+	FieldRule{Field: "AppraisedValue", Type: "integer", Minimum: 0, Maximum: 1000000000000},
+)
+
+// currentAssetRules returns the rules CreateAsset and UpdateAsset validate an
+// asset against, with the allowed colors as Enum of the Color rule.
+func currentAssetRules(ctx contractapi.TransactionContextInterface) ([]FieldRule, error) {
+	colors, err := allowedColors(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := slices.Clone(assetRules)
+	for i := range rules {
+		if rules[i].Field == "Color" {
+			rules[i].Enum = colors
+		}
+	}
+	return rules, nil
+}
+
+// GetAssetRules returns the rules CreateAsset and UpdateAsset validate an
+// asset against, with the colors admins allow as Enum of the Color rule.
+func (q *QueryContract) GetAssetRules(ctx contractapi.TransactionContextInterface) ([]FieldRule, error) {
+	return currentAssetRules(ctx)
+}
+
+// SetAllowedColors limits the colors of new and updated assets to colors, or
+// lifts the limit if it is empty. Existing assets keep their color until they
+// are updated. Only admins can call it.
+func (a *AdminContract) SetAllowedColors(ctx contractapi.TransactionContextInterface, colors []string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(allowedColorsObjectType, nil)
+	if err != nil {
+		return err
+	}
+	if len(colors) == 0 {
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return stateWriteFailed(err)
+		}
+		return nil
+	}
+
+	rule := assetRule("Color")
+	for _, color := range colors {
+		if problem := rule.check(color); problem != "" {
+			return invalidArgument("color %q %s", color, problem)
+		}
+	}
+	colorsJSON, err := json.Marshal(colors)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, colorsJSON); err != nil {
+		return stateWriteFailed(err)
+	}
+	return nil
+}
+
+// validateAsset checks asset, and appraisal if not nil, against the rules. It
+// reports every field that breaks them in the details of the error, as the
+// field name and what is wrong with it.
+func validateAsset(ctx contractapi.TransactionContextInterface, asset *Asset, appraisal *Appraisal) error {
+	rules, err := currentAssetRules(ctx)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{
+		"ID":        asset.ID,
+		"Category":  asset.Category,
+		"Color":     asset.Color,
+		"Size":      asset.Size,
+		"Owner":     asset.Owner,
+		"OwnerName": asset.OwnerName,
+	}
+	if appraisal != nil {
+		values["AppraisedValue"] = appraisal.AppraisedValue
+	}
+
+	details := map[string]string{}
+	var problems []string
+	for _, rule := range rules {
+		value, ok := values[rule.Field]
+		if !ok {
+			continue
+		}
+		if problem := rule.check(value); problem != "" {
+			details[rule.Field] = problem
+			problems = append(problems, rule.Field+" "+problem)
+		}
+	}
+	if len(problems) > 0 {
+		return newContractError(ErrInvalidArgument, details, "invalid asset %s: %s", asset.ID, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// check returns what is wrong with value, or "" if it follows the rule.
+func (r *FieldRule) check(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		if value == "" {
+			if r.Required {
+				return "is required"
+			}
+			return ""
+		}
+		// JSON would store U+FFFD in place of the invalid bytes
+		if !utf8.ValidString(value) {
+			return "must be valid UTF-8"
+		}
+		if r.MaxLength > 0 && utf8.RuneCountInString(value) > r.MaxLength {
+			return fmt.Sprintf("must be at most %d characters", r.MaxLength)
+		}
+		if r.pattern != nil && !r.pattern.MatchString(value) {
+			return fmt.Sprintf("must match %s", r.Pattern)
+		}
+		if len(r.Enum) > 0 && !slices.Contains(r.Enum, value) {
+			return "must be one of " + strings.Join(r.Enum, ", ")
+		}
+	case int:
+		if value < r.Minimum {
+			return fmt.Sprintf("must be at least %d", r.Minimum)
+		}
+		if value > r.Maximum {
+			return fmt.Sprintf("must be at most %d", r.Maximum)
+		}
+	}
+	return ""
+}
+
+// compileRules compiles the patterns of rules, once when the package loads.
+func compileRules(rules ...FieldRule) []FieldRule {
+	for i := range rules {
+		if rules[i].Pattern != "" {
+			rules[i].pattern = regexp.MustCompile(`^(?:` + rules[i].Pattern + `)$`)
+		}
+	}
+	return rules
+}
+
+func assetRule(field string) *FieldRule {
+	for i := range assetRules {
+		if assetRules[i].Field == field {
+			return &assetRules[i]
+		}
+	}
+	return nil
+}
+
+func allowedColors(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(allowedColorsObjectType, nil)
+	if err != nil {
+		return nil, err
+	}
+	colorsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, stateReadFailed(err)
+	}
+	if colorsJSON == nil {
+		return nil, nil
+	}
+
+	var colors []string
+	if err := json.Unmarshal(colorsJSON, &colors); err != nil {
+		return nil, err
+	}
+	return colors, nil
+}
@@ -0,0 +1,96 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssetValidation(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+
+	// every field that breaks a rule is reported
+	appraise(stub, -1)
+	err := ctx.end(assetTransfer.CreateAsset(ctx, "-asset1", "", 0, "Tomoko\n"))
+	contractError, ok := chaincode.AsContractError(err)
+	require.True(t, ok)
+	require.Equal(t, chaincode.ErrInvalidArgument, contractError.Code)
+	require.Equal(t, map[string]string{
+		"ID":             "must match [A-Za-z0-9][A-Za-z0-9._-]*",
+		"Color":          "is required",
+		"Size":           "must be at least 1",
+		"OwnerName":      `must match [^\x00-\x1f]*`,
+		"AppraisedValue": "must be at least 0",
+	}, contractError.Details)
+	require.Empty(t, stub.Keys())
+
+	appraise(stub, 300)
+	requireCode(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 1000001, "Tomoko")), chaincode.ErrInvalidArgument, "invalid asset asset1: Size must be at most 1000000")
+	requireCode(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko\xa9")), chaincode.ErrInvalidArgument, "invalid asset asset1: OwnerName must be valid UTF-8")
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "blue", 5, "Tomoko")))
+
+	// the appraisal can stay when an update breaks the rules
+	stub.SetTransient(nil)
+	requireCode(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "Blue", 5, "Tomoko")), chaincode.ErrInvalidArgument, "invalid asset asset1: Color must match [a-z]+( [a-z]+)*")
+	require.NoError(t, ctx.end(assetTransfer.UpdateAsset(ctx, "asset1", "light blue", 5, "")))
+}
+
+func TestAllowedColors(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+
+	requireCode(t, ctx.end(assetTransfer.SetAllowedColors(ctx, []string{"blue", "RED"})), chaincode.ErrInvalidArgument, `color "RED" must match [a-z]+( [a-z]+)*`)
+	require.NoError(t, ctx.end(assetTransfer.SetAllowedColors(ctx, []string{"blue", "red"})))
+
+	appraise(stub, 300)
+	requireCode(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "green", 5, "Tomoko")), chaincode.ErrInvalidArgument, "invalid asset asset1: Color must be one of blue, red")
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset1", "red", 5, "Tomoko")))
+
+	// the limit is not an asset, and can be lifted
+	assets, err := assetTransfer.GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Len(t, assets, 1)
+	require.NoError(t, ctx.end(assetTransfer.SetAllowedColors(ctx, nil)))
+	require.NoError(t, ctx.end(assetTransfer.CreateAsset(ctx, "asset2", "green", 5, "Tomoko")))
+	ctx.SetStub(&failingPutStub{MemStub: stub, err: fmt.Errorf("failed inserting key")})
+	requireCode(t, ctx.end(assetTransfer.SetAllowedColors(ctx, []string{"blue"})), chaincode.ErrStateWriteFailed, "failed to put to world state. failed inserting key")
+	ctx.SetStub(&failingPutStub{MemStub: stub, err: fmt.Errorf("failed deleting key")})
+	requireCode(t, ctx.end(assetTransfer.SetAllowedColors(ctx, nil)), chaincode.ErrStateWriteFailed, "failed to put to world state. failed deleting key")
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(assetTransfer.SetAllowedColors(ctx, []string{"blue"}))))
+}
+
+func TestGetAssetRules(t *testing.T) {
+	ctx, _ := newTransactionContext(t)
+	assetTransfer := newContracts()
+	require.NoError(t, ctx.end(assetTransfer.Initialize(ctx)))
+	assetRule := func(field string) chaincode.FieldRule {
+		t.Helper()
+		rules, err := assetTransfer.GetAssetRules(ctx)
+		require.NoError(t, err)
+		for _, rule := range rules {
+			if rule.Field == field {
+				return rule
+			}
+		}
+		require.Failf(t, "no rule", "for field %s", field)
+		return chaincode.FieldRule{}
+	}
+
+	rule := assetRule("ID")
+	require.Equal(t, `[A-Za-z0-9][A-Za-z0-9._-]*`, rule.Pattern)
+	require.Equal(t, 64, rule.MaxLength)
+	require.True(t, rule.Required)
+	require.Equal(t, chaincode.FieldRule{Field: "Size", Type: "integer", Minimum: 1, Maximum: 1000000}, assetRule("Size"))
+	require.Equal(t, 0, assetRule("AppraisedValue").Minimum)
+	require.Empty(t, assetRule("Color").Enum)
+
+	// the allowed colors are read at the time of the call
+	require.NoError(t, ctx.end(assetTransfer.SetAllowedColors(ctx, []string{"blue", "red"})))
+	require.Equal(t, []string{"blue", "red"}, assetRule("Color").Enum)
+}
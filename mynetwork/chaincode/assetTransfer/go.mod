@@ -8,6 +8,7 @@ require (
 	github.com/hyperledger/fabric-protos-go-apiv2 v0.3.4
 	github.com/stretchr/testify v1.10.0
 	google.golang.org/protobuf v1.36.4
+	guolong.com/memstub v0.0.0
 )
 
 require (
@@ -29,3 +30,5 @@ require (
 	google.golang.org/grpc v1.71.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace guolong.com/memstub => ../memstub
@@ -0,0 +1,243 @@
+package chaincode
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 合约角色保存在复合键下：QueryByRange的开放范围查询不会返回它们，Put/Update也无法写入
+const (
+	contractOwnerObjectType = "contract~owner"
+	contractAdminObjectType = "contract~admin"
+)
+
+var errNotInitialized = errors.New("the contract is not initialized, call Initialize first")
+
+// AccessDeniedError 调用者缺少交易所需角色时返回
+// 经gateway只有错误信息能到达客户端，因此信息总以"access denied:"开头供客户端识别
+type AccessDeniedError struct {
+	Caller string
+	Reason string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("access denied: %s %s", e.Caller, e.Reason)
+}
+
+// IsAccessDenied 判断err是否为(或包装了)AccessDeniedError
+func IsAccessDenied(err error) bool {
+	var accessDenied *AccessDeniedError
+	return errors.As(err, &accessDenied)
+}
+
+// Initialize 将提交交易的客户端记录为合约所有者
+// 作为链码定义的init交易调用，只能成功一次
+func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface) error {
+	owner, err := contractOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if owner != "" {
+		return fmt.Errorf("the contract is already initialized")
+	}
+
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+	return putContractOwner(ctx, caller)
+}
+
+// WhoAmI 返回提交交易的客户端身份(即授予角色时使用的格式)
+func (s *SmartContract) WhoAmI(ctx contractapi.TransactionContextInterface) (string, error) {
+	return submittingClient(ctx)
+}
+
+// GetContractOwner 返回Initialize记录的合约所有者
+func (s *SmartContract) GetContractOwner(ctx contractapi.TransactionContextInterface) (string, error) {
+	owner, err := contractOwner(ctx)
+	if err != nil {
+		return "", err
+	}
+	if owner == "" {
+		return "", errNotInitialized
+	}
+	return owner, nil
+}
+
+// GetAdmins 返回拥有管理员角色的客户端(不含所有者)
+func (s *SmartContract) GetAdmins(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(contractAdminObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	admins := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		admins = append(admins, attributes[0])
+	}
+	return admins, nil
+}
+
+// AddAdmin 授予客户端管理员角色(仅所有者)
+func (s *SmartContract) AddAdmin(ctx contractapi.TransactionContextInterface, admin string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+	if admin == "" {
+		return fmt.Errorf("admin must not be empty")
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(contractAdminObjectType, []string{admin})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte{0x00})
+}
+
+// RemoveAdmin 撤销客户端的管理员角色(仅所有者)
+func (s *SmartContract) RemoveAdmin(ctx contractapi.TransactionContextInterface, admin string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+
+	isAdmin, err := hasAdminRole(ctx, admin)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return fmt.Errorf("%s is not an admin", admin)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(contractAdminObjectType, []string{admin})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+// TransferOwnership 将合约转交给新所有者(仅当前所有者)，原所有者随之失去全部权限
+func (s *SmartContract) TransferOwnership(ctx contractapi.TransactionContextInterface, newOwner string) error {
+	if err := requireContractOwner(ctx); err != nil {
+		return err
+	}
+	if newOwner == "" {
+		return fmt.Errorf("new owner must not be empty")
+	}
+	return putContractOwner(ctx, newOwner)
+}
+
+// requireAdmin 管理员专用交易的守卫，合约所有者总能通过
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	caller, owner, err := callerAndOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if caller == owner {
+		return nil
+	}
+
+	isAdmin, err := hasAdminRole(ctx, caller)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return &AccessDeniedError{Caller: caller, Reason: "is not a contract admin"}
+	}
+	return nil
+}
+
+// requireContractOwner 仅所有者可调用的交易的守卫
+func requireContractOwner(ctx contractapi.TransactionContextInterface) error {
+	caller, owner, err := callerAndOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if caller != owner {
+		return &AccessDeniedError{Caller: caller, Reason: "is not the contract owner"}
+	}
+	return nil
+}
+
+func callerAndOwner(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	owner, err := contractOwner(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if owner == "" {
+		return "", "", errNotInitialized
+	}
+
+	caller, err := submittingClient(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return caller, owner, nil
+}
+
+func hasAdminRole(ctx contractapi.TransactionContextInterface, client string) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(contractAdminObjectType, []string{client})
+	if err != nil {
+		return false, err
+	}
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	return value != nil, nil
+}
+
+func contractOwner(ctx contractapi.TransactionContextInterface) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(contractOwnerObjectType, []string{})
+	if err != nil {
+		return "", err
+	}
+	owner, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	return string(owner), nil
+}
+
+func putContractOwner(ctx contractapi.TransactionContextInterface, owner string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(contractOwnerObjectType, []string{})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte(owner))
+}
+
+// submittingClient 以"<MSP ID>::<client ID>"形式返回调用者，client ID为解码后的cid ID
+// 例如"Org1MSP::x509::CN=User1@guolong.com,OU=client::CN=ca.guolong.com"
+func submittingClient(ctx contractapi.TransactionContextInterface) (string, error) {
+	clientIdentity := ctx.GetClientIdentity()
+	if clientIdentity == nil {
+		return "", fmt.Errorf("failed to get client identity")
+	}
+
+	mspID, err := clientIdentity.GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	b64ID, err := clientIdentity.GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client ID: %v", err)
+	}
+	id, err := base64.StdEncoding.DecodeString(b64ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode client ID: %v", err)
+	}
+	return mspID + "::" + string(id), nil
+}
@@ -0,0 +1,77 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"guolong.com/basic-chaincode/chaincode"
+)
+
+func TestInitialize(t *testing.T) {
+	ctx, _ := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+
+	_, err := sc.GetContractOwner(ctx)
+	require.EqualError(t, err, "the contract is not initialized, call Initialize first")
+	require.EqualError(t, ctx.end(sc.DeleteByKey(ctx, "sig1")), "the contract is not initialized, call Initialize first")
+
+	require.NoError(t, ctx.end(sc.Initialize(ctx)))
+	caller, err := sc.WhoAmI(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP::x509::CN=Admin@guolong.com,OU=admin::CN=ca.Org1MSP", caller)
+	owner, err := sc.GetContractOwner(ctx)
+	require.NoError(t, err)
+	require.Equal(t, caller, owner)
+	require.EqualError(t, ctx.end(sc.Initialize(ctx)), "the contract is already initialized")
+
+	// roles are not records
+	results, err := sc.QueryByRange(ctx, "", "")
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestAdminRoles(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+	require.NoError(t, ctx.end(sc.Initialize(ctx)))
+	require.NoError(t, ctx.end(sc.PutString(ctx, "sig1", "v1")))
+
+	user := setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	err := ctx.end(sc.DeleteByKey(ctx, "sig1"))
+	require.EqualError(t, err, fmt.Sprintf("access denied: %s is not a contract admin", user))
+	require.True(t, chaincode.IsAccessDenied(err))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(sc.AddAdmin(ctx, user))))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.EqualError(t, ctx.end(sc.AddAdmin(ctx, "")), "admin must not be empty")
+	require.NoError(t, ctx.end(sc.AddAdmin(ctx, user)))
+	admins, err := sc.GetAdmins(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{user}, admins)
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	require.NoError(t, ctx.end(sc.DeleteByKey(ctx, "sig1")))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(sc.RemoveAdmin(ctx, user))), "admins cannot manage roles")
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(sc.RemoveAdmin(ctx, user)))
+	require.EqualError(t, ctx.end(sc.RemoveAdmin(ctx, user)), fmt.Sprintf("%s is not an admin", user))
+}
+
+func TestTransferOwnership(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+	require.NoError(t, ctx.end(sc.Initialize(ctx)))
+
+	newOwner := setCaller(t, ctx, stub, "Org2MSP", "Admin@org2.guolong.com", "admin")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(sc.TransferOwnership(ctx, newOwner))))
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.EqualError(t, ctx.end(sc.TransferOwnership(ctx, "")), "new owner must not be empty")
+	require.NoError(t, ctx.end(sc.TransferOwnership(ctx, newOwner)))
+	require.True(t, chaincode.IsAccessDenied(ctx.end(sc.DeleteByKey(ctx, "sig1"))))
+
+	setCaller(t, ctx, stub, "Org2MSP", "Admin@org2.guolong.com", "admin")
+	require.NoError(t, ctx.end(sc.DeleteByKey(ctx, "sig1")))
+}
@@ -0,0 +1,232 @@
+package chaincode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"guolong.com/basic-chaincode/merkle"
+)
+
+const (
+	// 状态承诺保存在复合键中，以前缀为属性
+	commitmentObjectType = "state~commitment"
+	// 承诺时的叶子单独保存，证明由它们生成，不受之后状态变化的影响
+	leavesObjectType = "state~leaves"
+	// 一次承诺最多包含的key数，更多时需按更长的前缀分别承诺
+	maxCommitmentLeaves = 1000
+)
+
+// 某前缀下所有key的Merkle根，由交易ID锚定在账本上
+type StateCommitment struct {
+	Prefix    string `json:"prefix"`
+	Root      string `json:"root"`
+	LeafCount int    `json:"leafCount"`
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+}
+
+// 承诺时的一个叶子，Hash为merkle.LeafHash的hex
+type committedLeaf struct {
+	Key  string `json:"key"`
+	Hash string `json:"hash"`
+}
+
+// key的包含证明，合作方用merkle.Verify对照Commitment.Root离线校验
+// 证明的是承诺时key的值，之后的修改不在其中
+type InclusionProof struct {
+	Key        string          `json:"key"`
+	Path       []merkle.Step   `json:"path"`
+	Commitment StateCommitment `json:"commitment"`
+}
+
+// 计算prefix下所有key的Merkle根并上链(仅管理员)，prefix为空表示全部key
+// key超过maxCommitmentLeaves个时返回错误，同时发出StateCommitted事件
+func (s *SmartContract) CommitState(ctx contractapi.TransactionContextInterface, prefix string) (*StateCommitment, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if prefix != "" {
+		if err := validateKey(prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	committed, err := stateLeaves(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := leafHashes(committed)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	commitment := &StateCommitment{
+		Prefix:    prefix,
+		Root:      hex.EncodeToString(merkle.Root(leaves)),
+		LeafCount: len(committed),
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: timestamp.AsTime().Format(time.RFC3339),
+	}
+
+	commitmentJSON, err := json.Marshal(commitment)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(commitmentObjectType, []string{prefix})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.GetStub().PutState(key, commitmentJSON); err != nil {
+		return nil, err
+	}
+	leavesJSON, err := json.Marshal(committed)
+	if err != nil {
+		return nil, err
+	}
+	leavesKey, err := ctx.GetStub().CreateCompositeKey(leavesObjectType, []string{prefix})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.GetStub().PutState(leavesKey, leavesJSON); err != nil {
+		return nil, err
+	}
+	if err := ctx.GetStub().SetEvent("StateCommitted", commitmentJSON); err != nil {
+		return nil, err
+	}
+	return commitment, nil
+}
+
+// 查询prefix最近一次上链的状态承诺
+func (s *SmartContract) GetCommitment(ctx contractapi.TransactionContextInterface, prefix string) (*StateCommitment, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(commitmentObjectType, []string{prefix})
+	if err != nil {
+		return nil, err
+	}
+	commitmentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if commitmentJSON == nil {
+		return nil, fmt.Errorf("prefix %q has not been committed", prefix)
+	}
+
+	var commitment StateCommitment
+	if err := json.Unmarshal(commitmentJSON, &commitment); err != nil {
+		return nil, err
+	}
+	return &commitment, nil
+}
+
+// 返回key在覆盖它的最长前缀的状态承诺中的兄弟节点路径
+// 路径由承诺时保存的叶子生成，承诺之后新增的key不在其中
+func (s *SmartContract) GetInclusionProof(ctx contractapi.TransactionContextInterface, key string) (*InclusionProof, error) {
+	commitment, err := coveringCommitment(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	leavesKey, err := ctx.GetStub().CreateCompositeKey(leavesObjectType, []string{commitment.Prefix})
+	if err != nil {
+		return nil, err
+	}
+	leavesJSON, err := ctx.GetStub().GetState(leavesKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	var committed []committedLeaf
+	if err := json.Unmarshal(leavesJSON, &committed); err != nil {
+		return nil, err
+	}
+
+	leaves, err := leafHashes(committed)
+	if err != nil {
+		return nil, err
+	}
+	for i, leaf := range committed {
+		if leaf.Key != key {
+			continue
+		}
+		path, err := merkle.Prove(leaves, i)
+		if err != nil {
+			return nil, err
+		}
+		return &InclusionProof{Key: key, Path: path, Commitment: *commitment}, nil
+	}
+	return nil, fmt.Errorf("key %v is not in commitment %s", key, commitment.TxID)
+}
+
+// 返回prefix下按账本顺序排列的key及其叶子哈希，最多maxCommitmentLeaves个
+func stateLeaves(ctx contractapi.TransactionContextInterface, prefix string) ([]committedLeaf, error) {
+	end := ""
+	if prefix != "" {
+		end = prefix + string(utf8.MaxRune)
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByRange(prefix, end)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var leaves []committedLeaf
+	for resultsIterator.HasNext() {
+		if len(leaves) == maxCommitmentLeaves {
+			return nil, fmt.Errorf("prefix %q has more than %d keys, commit longer prefixes instead", prefix, maxCommitmentLeaves)
+		}
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, committedLeaf{
+			Key:  queryResponse.Key,
+			Hash: hex.EncodeToString(merkle.LeafHash(queryResponse.Key, queryResponse.Value)),
+		})
+	}
+	return leaves, nil
+}
+
+func leafHashes(committed []committedLeaf) ([][]byte, error) {
+	leaves := make([][]byte, len(committed))
+	for i, leaf := range committed {
+		hash, err := hex.DecodeString(leaf.Hash)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = hash
+	}
+	return leaves, nil
+}
+
+func coveringCommitment(ctx contractapi.TransactionContextInterface, key string) (*StateCommitment, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(commitmentObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var covering *StateCommitment
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var commitment StateCommitment
+		if err := json.Unmarshal(queryResponse.Value, &commitment); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(key, commitment.Prefix) && (covering == nil || len(commitment.Prefix) > len(covering.Prefix)) {
+			covering = &commitment
+		}
+	}
+	if covering == nil {
+		return nil, fmt.Errorf("no commitment covers key %v", key)
+	}
+	return covering, nil
+}
@@ -0,0 +1,105 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"guolong.com/basic-chaincode/chaincode"
+	"guolong.com/basic-chaincode/merkle"
+)
+
+func TestCommitStateAndInclusionProof(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+	require.NoError(t, ctx.end(sc.Initialize(ctx)))
+	for key, value := range map[string]string{"sig1": "a", "sig2": "b", "sig3": "c", "doc1": "d"} {
+		require.NoError(t, ctx.end(sc.PutString(ctx, key, value)))
+	}
+
+	_, err := sc.GetInclusionProof(ctx, "sig2")
+	require.EqualError(t, err, "no commitment covers key sig2")
+
+	stub.StartTransaction("tx-commit")
+	commitment, err := sc.CommitState(ctx, "sig")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, "sig", commitment.Prefix)
+	require.Equal(t, 3, commitment.LeafCount)
+	require.Equal(t, "tx-commit", commitment.TxID)
+	require.Equal(t, "StateCommitted", stub.Event().EventName)
+	stored, err := sc.GetCommitment(ctx, "sig")
+	require.NoError(t, err)
+	require.Equal(t, commitment, stored)
+	_, err = sc.GetCommitment(ctx, "doc")
+	require.EqualError(t, err, `prefix "doc" has not been committed`)
+
+	proof, err := sc.GetInclusionProof(ctx, "sig2")
+	require.NoError(t, err)
+	require.Equal(t, *commitment, proof.Commitment)
+	// what a partner does offline, with the proof as received from the gateway
+	proofJSON, err := json.Marshal(proof)
+	require.NoError(t, err)
+	var received chaincode.InclusionProof
+	require.NoError(t, json.Unmarshal(proofJSON, &received))
+	require.NoError(t, merkle.Verify(commitment.Root, "sig2", []byte("b"), received.Path))
+	require.Error(t, merkle.Verify(commitment.Root, "sig2", []byte("x"), received.Path))
+
+	_, err = sc.GetInclusionProof(ctx, "sig4")
+	require.EqualError(t, err, "key sig4 is not in commitment tx-commit")
+	_, err = sc.GetInclusionProof(ctx, "doc1")
+	require.EqualError(t, err, "no commitment covers key doc1")
+
+	// the whole state, the longest covering prefix wins
+	all, err := sc.CommitState(ctx, "")
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Equal(t, 4, all.LeafCount)
+	proof, err = sc.GetInclusionProof(ctx, "doc1")
+	require.NoError(t, err)
+	require.NoError(t, merkle.Verify(all.Root, "doc1", []byte("d"), proof.Path))
+	proof, err = sc.GetInclusionProof(ctx, "sig1")
+	require.NoError(t, err)
+	require.Equal(t, "sig", proof.Commitment.Prefix)
+
+	// proofs are of the committed values, whatever changed since
+	stub.StartTransaction("tx-change")
+	require.NoError(t, ctx.end(sc.UpdateString(ctx, "sig3", "changed")))
+	require.NoError(t, ctx.end(sc.PutString(ctx, "sig4", "e")))
+	require.NoError(t, ctx.end(sc.DeleteByKey(ctx, "sig1")))
+	proof, err = sc.GetInclusionProof(ctx, "sig3")
+	require.NoError(t, err)
+	require.NoError(t, merkle.Verify(commitment.Root, "sig3", []byte("c"), proof.Path))
+	require.Error(t, merkle.Verify(commitment.Root, "sig3", []byte("changed"), proof.Path))
+	proof, err = sc.GetInclusionProof(ctx, "sig1")
+	require.NoError(t, err)
+	require.NoError(t, merkle.Verify(commitment.Root, "sig1", []byte("a"), proof.Path))
+	_, err = sc.GetInclusionProof(ctx, "sig4")
+	require.EqualError(t, err, "key sig4 is not in commitment tx-commit")
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	_, err = sc.CommitState(ctx, "sig")
+	ctx.end(err)
+	require.True(t, chaincode.IsAccessDenied(err))
+}
+
+func TestCommitStateLimit(t *testing.T) {
+	ctx, _ := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+	require.NoError(t, ctx.end(sc.Initialize(ctx)))
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, sc.PutString(ctx, fmt.Sprintf("sig%04d", i), "v"))
+	}
+	require.NoError(t, ctx.end(nil))
+
+	commitment, err := sc.CommitState(ctx, "sig")
+	require.NoError(t, ctx.end(err))
+	require.Equal(t, 1000, commitment.LeafCount)
+
+	require.NoError(t, ctx.end(sc.PutString(ctx, "sig1000", "v")))
+	_, err = sc.CommitState(ctx, "sig")
+	require.EqualError(t, ctx.end(err), `prefix "sig" has more than 1000 keys, commit longer prefixes instead`)
+	_, err = sc.CommitState(ctx, "sig1")
+	require.NoError(t, ctx.end(err))
+}
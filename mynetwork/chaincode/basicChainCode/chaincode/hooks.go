@@ -0,0 +1,154 @@
+package chaincode
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// key的最大长度
+const maxKeyLength = 128
+
+// 调用方传入的key不能以这些前缀开头: "\x00"是复合键命名空间(合约角色保存在其中)，
+// CouchDB不接受以"_"开头的文档ID
+var reservedKeyPrefixes = []string{"\x00", "_"}
+
+// 带key参数的交易及其key参数的位置，由BeforeTransaction统一校验
+var keyArguments = map[string]int{
+	"DeleteByKey":        0,
+	"GetInclusionProof":  0,
+	"KeyExists":          0,
+	"PutBytes":           0,
+	"PutString":          0,
+	"QueryByKey":         0,
+	"QueryByKeyAsBytes":  0,
+	"QueryByKeyAsString": 0,
+	"UpdateBytes":        0,
+	"UpdateString":       0,
+}
+
+var defaultLogger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// 合约交易上下文，记录交易开始时间用于统计耗时
+type TransactionContext struct {
+	contractapi.TransactionContext
+	start time.Time
+}
+
+// 返回合约的交易上下文类型
+func (s *SmartContract) GetTransactionContextHandler() contractapi.SettableTransactionContextInterface {
+	return new(TransactionContext)
+}
+
+// 交易前: 校验key并记录日志
+func (s *SmartContract) GetBeforeTransaction() interface{} {
+	return s.beforeTransaction
+}
+
+// 交易后: 记录日志及耗时
+func (s *SmartContract) GetAfterTransaction() interface{} {
+	return s.afterTransaction
+}
+
+// 调用不存在的函数时返回可用函数列表
+func (s *SmartContract) GetUnknownTransaction() interface{} {
+	return s.unknownTransaction
+}
+
+func (s *SmartContract) beforeTransaction(ctx *TransactionContext) error {
+	ctx.start = time.Now()
+	function, params := functionAndParameters(ctx)
+	if i, ok := keyArguments[function]; ok && i < len(params) {
+		if err := validateKey(params[i]); err != nil {
+			s.logger().Warn("transaction rejected", append(logAttrs(ctx, function), "error", err.Error())...)
+			return err
+		}
+	}
+
+	s.logger().Info("transaction started", logAttrs(ctx, function)...)
+	return nil
+}
+
+// 仅在交易成功时调用，失败的交易由peer记录错误
+func (s *SmartContract) afterTransaction(ctx *TransactionContext, _ interface{}) error {
+	function, _ := functionAndParameters(ctx)
+	s.logger().Info("transaction completed", append(logAttrs(ctx, function), "duration", time.Since(ctx.start))...)
+	return nil
+}
+
+func (s *SmartContract) unknownTransaction(ctx *TransactionContext) error {
+	function, _ := functionAndParameters(ctx)
+	s.logger().Warn("unknown transaction", logAttrs(ctx, function)...)
+	return fmt.Errorf("function %s not found, available functions: %s", function, strings.Join(transactionNames(s), ", "))
+}
+
+func (s *SmartContract) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return defaultLogger
+}
+
+// 校验调用方传入的key: 非空、长度、UTF-8及保留前缀
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+	if len(key) > maxKeyLength {
+		return fmt.Errorf("key is %d bytes long, the maximum is %d", len(key), maxKeyLength)
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("key %q is not valid UTF-8", key)
+	}
+	for _, prefix := range reservedKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return fmt.Errorf("key %q starts with the reserved prefix %q", key, prefix)
+		}
+	}
+	return nil
+}
+
+// 返回去掉合约名前缀的函数名，如"SmartContract:PutString"返回"PutString"
+func functionAndParameters(ctx contractapi.TransactionContextInterface) (string, []string) {
+	function, params := ctx.GetStub().GetFunctionAndParameters()
+	if i := strings.LastIndex(function, ":"); i >= 0 {
+		function = function[i+1:]
+	}
+	return function, params
+}
+
+func logAttrs(ctx contractapi.TransactionContextInterface, function string) []any {
+	invoker, err := submittingClient(ctx)
+	if err != nil {
+		invoker = "unknown"
+	}
+	return []any{
+		"function", function,
+		"txID", ctx.GetStub().GetTxID(),
+		"channel", ctx.GetStub().GetChannelID(),
+		"invoker", invoker,
+	}
+}
+
+// 列出合约中以交易上下文为第一个参数的导出方法，即客户端可调用的函数
+func transactionNames(contract interface{}) []string {
+	contextType := reflect.TypeOf((*contractapi.TransactionContextInterface)(nil)).Elem()
+	contractType := reflect.TypeOf(contract)
+
+	var names []string
+	for i := 0; i < contractType.NumMethod(); i++ {
+		method := contractType.Method(i)
+		if method.Type.NumIn() > 1 && method.Type.In(1).Implements(contextType) {
+			names = append(names, method.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
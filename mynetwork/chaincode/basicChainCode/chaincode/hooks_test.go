@@ -0,0 +1,73 @@
+package chaincode_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+	"guolong.com/basic-chaincode/chaincode"
+	"guolong.com/memstub"
+)
+
+// newChaincode returns the chaincode as the peer runs it, hooks included,
+// logging into the returned buffer.
+func newChaincode(t *testing.T) (*contractapi.ContractChaincode, *memstub.MemStub, *bytes.Buffer) {
+	var logs bytes.Buffer
+	cc, err := contractapi.NewChaincode(&chaincode.SmartContract{Logger: slog.New(slog.NewJSONHandler(&logs, nil))})
+	require.NoError(t, err)
+
+	stub := memstub.New()
+	require.NoError(t, stub.SetIdentity("Org1MSP", "User1@guolong.com", "client"))
+	return cc, stub, &logs
+}
+
+func TestTransactionLogging(t *testing.T) {
+	cc, stub, logs := newChaincode(t)
+
+	stub.StartTransaction("tx-put")
+	stub.SetArgs("PutString", "k1", "v1")
+	response := stub.MockInvoke(cc)
+	require.EqualValues(t, shim.OK, response.Status, response.Message)
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, lines, 2)
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	require.Equal(t, "transaction completed", entry["msg"])
+	require.Equal(t, "PutString", entry["function"])
+	require.Equal(t, "tx-put", entry["txID"])
+	require.Equal(t, "Org1MSP::x509::CN=User1@guolong.com,OU=client::CN=ca.Org1MSP", entry["invoker"])
+	require.Contains(t, entry, "duration")
+}
+
+func TestKeyValidation(t *testing.T) {
+	cc, stub, _ := newChaincode(t)
+
+	for key, message := range map[string]string{
+		"":                       "key must not be empty",
+		strings.Repeat("k", 129): "key is 129 bytes long, the maximum is 128",
+		"k\xff":                  `key "k\xff" is not valid UTF-8`,
+		"_design":                `key "_design" starts with the reserved prefix "_"`,
+	} {
+		stub.SetArgs("SmartContract:QueryByKeyAsBytes", key)
+		response := stub.MockInvoke(cc)
+		require.EqualValues(t, shim.ERROR, response.Status)
+		require.Equal(t, message, response.Message)
+	}
+}
+
+func TestUnknownTransaction(t *testing.T) {
+	cc, stub, _ := newChaincode(t)
+
+	stub.SetArgs("PutInt", "k1", "1")
+	response := stub.MockInvoke(cc)
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.True(t, strings.HasPrefix(response.Message, "function PutInt not found, available functions: AddAdmin, "))
+	require.Contains(t, response.Message, ", PutString, ")
+	require.NotContains(t, response.Message, "GetAfterTransaction")
+}
@@ -0,0 +1,152 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 跨链码调用白名单保存在复合键中
+const invocationObjectType = "invoke~allow"
+
+// 跨链码调用白名单中的一项，Channel为空表示本通道
+type InvocationRule struct {
+	Channel   string `json:"channel"`
+	Chaincode string `json:"chaincode"`
+	Function  string `json:"function"`
+	// 为true时只能通过EvaluateChaincode查询，为false时只能通过InvokeChaincode调用
+	EvaluateOnly bool `json:"evaluateOnly"`
+}
+
+// 将(通道, 链码, 函数)加入白名单(仅管理员)
+// peer只保存本通道链码的写操作，因此其他通道的调用只能是evaluateOnly
+func (s *SmartContract) AllowInvocation(ctx contractapi.TransactionContextInterface, channel string, chaincode string, function string, evaluateOnly bool) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if chaincode == "" || function == "" {
+		return fmt.Errorf("chaincode and function must not be empty")
+	}
+	if channel == "" {
+		channel = ctx.GetStub().GetChannelID()
+	}
+	if !evaluateOnly && channel != ctx.GetStub().GetChannelID() {
+		return fmt.Errorf("calls to channel %s cannot change state, allow them as evaluate-only", channel)
+	}
+
+	rule := InvocationRule{Channel: channel, Chaincode: chaincode, Function: function, EvaluateOnly: evaluateOnly}
+	ruleJSON, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(invocationObjectType, []string{channel, chaincode, function})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, ruleJSON)
+}
+
+// 将(通道, 链码, 函数)移出白名单(仅管理员)
+func (s *SmartContract) RevokeInvocation(ctx contractapi.TransactionContextInterface, channel string, chaincode string, function string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	rule, err := invocationRule(ctx, channel, chaincode, function)
+	if err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(invocationObjectType, []string{rule.Channel, chaincode, function})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+// 查询跨链码调用白名单
+func (s *SmartContract) GetInvocationAllowList(ctx contractapi.TransactionContextInterface) ([]InvocationRule, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(invocationObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	rules := []InvocationRule{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var rule InvocationRule
+		if err := json.Unmarshal(queryResponse.Value, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// 调用白名单中可修改状态的链码函数，args原样传给被调用的函数，返回其payload
+func (s *SmartContract) InvokeChaincode(ctx contractapi.TransactionContextInterface, channel string, chaincode string, function string, args []string) (string, error) {
+	rule, err := invocationRule(ctx, channel, chaincode, function)
+	if err != nil {
+		return "", err
+	}
+	if rule.EvaluateOnly {
+		return "", fmt.Errorf("function %s of chaincode %s on channel %s is evaluate-only, use EvaluateChaincode", function, chaincode, rule.Channel)
+	}
+	return invoke(ctx, rule, args)
+}
+
+// 调用白名单中evaluateOnly的链码函数查询数据，args原样传给被调用的函数，返回其payload
+// 该交易在元数据中标记为evaluate，网关客户端不会将其提交排序
+// 但客户端仍可以提交它，因此可修改状态的函数只能通过InvokeChaincode调用
+func (s *SmartContract) EvaluateChaincode(ctx contractapi.TransactionContextInterface, channel string, chaincode string, function string, args []string) (string, error) {
+	rule, err := invocationRule(ctx, channel, chaincode, function)
+	if err != nil {
+		return "", err
+	}
+	if !rule.EvaluateOnly {
+		return "", fmt.Errorf("function %s of chaincode %s on channel %s can change state, use InvokeChaincode", function, chaincode, rule.Channel)
+	}
+	return invoke(ctx, rule, args)
+}
+
+// 查询白名单中的一项，不在白名单中时返回错误
+func invocationRule(ctx contractapi.TransactionContextInterface, channel string, chaincode string, function string) (*InvocationRule, error) {
+	if channel == "" {
+		channel = ctx.GetStub().GetChannelID()
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(invocationObjectType, []string{channel, chaincode, function})
+	if err != nil {
+		return nil, err
+	}
+	ruleJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if ruleJSON == nil {
+		return nil, fmt.Errorf("function %s of chaincode %s on channel %s is not allowed", function, chaincode, channel)
+	}
+
+	var rule InvocationRule
+	if err := json.Unmarshal(ruleJSON, &rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func invoke(ctx contractapi.TransactionContextInterface, rule *InvocationRule, args []string) (string, error) {
+	invokeArgs := [][]byte{[]byte(rule.Function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(rule.Chaincode, invokeArgs, rule.Channel)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		return "", fmt.Errorf("chaincode %s on channel %s returned an error: %s", rule.Chaincode, rule.Channel, response.Message)
+	}
+	return string(response.Payload), nil
+}
@@ -0,0 +1,93 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+	"guolong.com/basic-chaincode/chaincode"
+)
+
+// assetContract stands in for the assetTransfer chaincode.
+type assetContract struct {
+	contractapi.Contract
+}
+
+func (c *assetContract) CreateAsset(ctx contractapi.TransactionContextInterface, id string, owner string) error {
+	return ctx.GetStub().PutState(id, []byte(fmt.Sprintf(`{"ID":%q,"Owner":%q}`, id, owner)))
+}
+
+func (c *assetContract) ReadAsset(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	asset, err := ctx.GetStub().GetState(id)
+	if err != nil {
+		return "", err
+	}
+	if asset == nil {
+		return "", fmt.Errorf("the asset %s does not exist", id)
+	}
+	return string(asset), nil
+}
+
+func TestInvokeChaincode(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+	require.NoError(t, ctx.end(sc.Initialize(ctx)))
+	assets, err := contractapi.NewChaincode(&assetContract{})
+	require.NoError(t, err)
+	assetStub := stub.InstallChaincode("", "assetTransfer", assets)
+
+	_, err = sc.EvaluateChaincode(ctx, "", "assetTransfer", "ReadAsset", []string{"asset1"})
+	require.EqualError(t, err, "function ReadAsset of chaincode assetTransfer on channel mychannel is not allowed")
+
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	require.True(t, chaincode.IsAccessDenied(ctx.end(sc.AllowInvocation(ctx, "", "assetTransfer", "ReadAsset", true))))
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(sc.AllowInvocation(ctx, "", "assetTransfer", "ReadAsset", true)))
+	require.NoError(t, ctx.end(sc.AllowInvocation(ctx, "mychannel", "assetTransfer", "CreateAsset", false)))
+	require.EqualError(t, ctx.end(sc.AllowInvocation(ctx, "otherchannel", "assetTransfer", "CreateAsset", false)),
+		"calls to channel otherchannel cannot change state, allow them as evaluate-only")
+	require.NoError(t, ctx.end(sc.AllowInvocation(ctx, "otherchannel", "assetTransfer", "ReadAsset", true)))
+	require.EqualError(t, ctx.end(sc.AllowInvocation(ctx, "", "", "ReadAsset", true)), "chaincode and function must not be empty")
+
+	rules, err := sc.GetInvocationAllowList(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	require.Contains(t, rules, chaincode.InvocationRule{Channel: "mychannel", Chaincode: "assetTransfer", Function: "CreateAsset"})
+
+	// state-changing calls
+	setCaller(t, ctx, stub, "Org1MSP", "User1@guolong.com", "client")
+	payload, err := sc.InvokeChaincode(ctx, "", "assetTransfer", "CreateAsset", []string{"asset1", "Tomoko"})
+	ctx.end(err)
+	require.NoError(t, err)
+	require.Empty(t, payload)
+	asset, err := assetStub.GetState("asset1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":"asset1","Owner":"Tomoko"}`, string(asset))
+	_, err = sc.InvokeChaincode(ctx, "", "assetTransfer", "ReadAsset", []string{"asset1"})
+	ctx.end(err)
+	require.EqualError(t, err, "function ReadAsset of chaincode assetTransfer on channel mychannel is evaluate-only, use EvaluateChaincode")
+
+	// evaluate-only calls
+	payload, err = sc.EvaluateChaincode(ctx, "", "assetTransfer", "ReadAsset", []string{"asset1"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":"asset1","Owner":"Tomoko"}`, payload)
+	_, err = sc.EvaluateChaincode(ctx, "", "assetTransfer", "ReadAsset", []string{"asset2"})
+	require.EqualError(t, err, "chaincode assetTransfer on channel mychannel returned an error: the asset asset2 does not exist")
+	_, err = sc.EvaluateChaincode(ctx, "otherchannel", "assetTransfer", "ReadAsset", []string{"asset1"})
+	require.EqualError(t, err, "chaincode assetTransfer on channel otherchannel returned an error: chaincode assetTransfer is not available on channel otherchannel")
+
+	// a submitted EvaluateChaincode must not write through a state-changing rule
+	_, err = sc.EvaluateChaincode(ctx, "", "assetTransfer", "CreateAsset", []string{"asset2", "Brad"})
+	require.EqualError(t, err, "function CreateAsset of chaincode assetTransfer on channel mychannel can change state, use InvokeChaincode")
+	asset, err = assetStub.GetState("asset2")
+	require.NoError(t, err)
+	require.Nil(t, asset)
+
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	require.NoError(t, ctx.end(sc.RevokeInvocation(ctx, "", "assetTransfer", "ReadAsset")))
+	_, err = sc.EvaluateChaincode(ctx, "", "assetTransfer", "ReadAsset", []string{"asset1"})
+	require.EqualError(t, err, "function ReadAsset of chaincode assetTransfer on channel mychannel is not allowed")
+	require.EqualError(t, ctx.end(sc.RevokeInvocation(ctx, "", "assetTransfer", "ReadAsset")),
+		"function ReadAsset of chaincode assetTransfer on channel mychannel is not allowed")
+}
@@ -3,12 +3,25 @@ package chaincode
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 )
 
 type SmartContract struct {
 	contractapi.Contract
+
+	// 交易日志输出，为nil时以JSON格式输出到stderr
+	Logger *slog.Logger
+}
+
+// 在元数据中标记为evaluate的交易，网关客户端只查询不提交
+func (s *SmartContract) GetEvaluateTransactions() []string {
+	return []string{
+		"EvaluateChaincode", "GetAdmins", "GetCommitment", "GetContractOwner", "GetInclusionProof",
+		"GetInvocationAllowList", "KeyExists", "QueryByKey", "QueryByKeyAsBytes", "QueryByKeyAsString",
+		"QueryByRange", "QueryByRichAsJson", "WhoAmI",
+	}
 }
 
 // 统计交易总量(pass)
@@ -114,6 +127,9 @@ func (s *SmartContract) QueryByKeyAsString(ctx contractapi.TransactionContextInt
 
 // string格式数据上链(用于企业数字签名上链)
 func (s *SmartContract) PutString(ctx contractapi.TransactionContextInterface, key string, value string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
 	err := ctx.GetStub().PutState(key, []byte(value))
 	if err != nil {
 		return fmt.Errorf("error in PutState, key:%v,value:%v", key, value)
@@ -123,6 +139,9 @@ func (s *SmartContract) PutString(ctx contractapi.TransactionContextInterface, k
 
 // json格式数据上链 ([]byte，用以新增json)
 func (s *SmartContract) PutBytes(ctx contractapi.TransactionContextInterface, key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
 	err := ctx.GetStub().PutState(key, value)
 	if err != nil {
 		return fmt.Errorf("error in PutState, key:%v,value:%v", key, value)
@@ -154,7 +173,14 @@ func (s *SmartContract) UpdateBytes(ctx contractapi.TransactionContextInterface,
 	return s.PutBytes(ctx, key, value)
 }
 
+// 删除数据(仅管理员)
 func (s *SmartContract) DeleteByKey(ctx contractapi.TransactionContextInterface, key string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if err := validateKey(key); err != nil {
+		return err
+	}
 	exists, err := s.KeyExists(ctx, key)
 	if err != nil {
 		return err
@@ -0,0 +1,272 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/stretchr/testify/require"
+	"guolong.com/basic-chaincode/chaincode"
+	"guolong.com/memstub"
+)
+
+// testContext is the context the contract runs with on a peer, over an
+// in-memory world state. The contract calls of a test are transactions of their
+// own once they are ended with end.
+type testContext struct {
+	chaincode.TransactionContext
+	stub *memstub.MemStub
+}
+
+// end ends the transaction of a contract call that returned err, committing
+// its writes if err is nil, see MemStub.EndTransaction. It returns err, so that
+// the call can be wrapped in it.
+func (c *testContext) end(err error) error {
+	c.stub.EndTransaction(err)
+	return err
+}
+
+// newTransactionContext returns a context backed by an in-memory world state,
+// submitted by the Org1 admin.
+func newTransactionContext(t *testing.T) (*testContext, *memstub.MemStub) {
+	stub := memstub.New()
+	ctx := &testContext{stub: stub}
+	ctx.SetStub(stub)
+	setCaller(t, ctx, stub, "Org1MSP", "Admin@guolong.com", "admin")
+	return ctx, stub
+}
+
+// setCaller makes commonName in mspID the submitting client and returns it in
+// the form roles are granted to.
+func setCaller(t *testing.T, ctx *testContext, stub *memstub.MemStub, mspID, commonName string, ous ...string) string {
+	t.Helper()
+	require.NoError(t, stub.SetIdentity(mspID, commonName, ous...))
+	clientIdentity, err := cid.New(stub)
+	require.NoError(t, err)
+	ctx.SetClientIdentity(clientIdentity)
+
+	caller, err := (&chaincode.SmartContract{}).WhoAmI(ctx)
+	require.NoError(t, err)
+	return caller
+}
+
+// brokenQueryStub returns a canned iterator from every query, for the error
+// paths the in-memory world state cannot produce.
+type brokenQueryStub struct {
+	*memstub.MemStub
+	iterator shim.StateQueryIteratorInterface
+}
+
+func (s *brokenQueryStub) GetStateByRange(string, string) (shim.StateQueryIteratorInterface, error) {
+	return s.iterator, nil
+}
+
+func (s *brokenQueryStub) GetQueryResult(string) (shim.StateQueryIteratorInterface, error) {
+	return s.iterator, nil
+}
+
+type cannedIterator struct {
+	kvs []*queryresult.KV
+	err error
+}
+
+func (it *cannedIterator) HasNext() bool { return it.err != nil || len(it.kvs) > 0 }
+func (it *cannedIterator) Close() error  { return nil }
+func (it *cannedIterator) Next() (*queryresult.KV, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func newBrokenContext(iterator shim.StateQueryIteratorInterface) *contractapi.TransactionContext {
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(&brokenQueryStub{MemStub: memstub.New(), iterator: iterator})
+	return ctx
+}
+
+func TestNewChaincode(t *testing.T) {
+	_, err := contractapi.NewChaincode(&chaincode.SmartContract{})
+	require.NoError(t, err)
+}
+
+func TestPutAndQuery(t *testing.T) {
+	ctx, _ := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+
+	exists, err := sc.KeyExists(ctx, "sig1")
+	require.NoError(t, err)
+	require.False(t, exists)
+	_, err = sc.QueryByKey(ctx, "sig1")
+	require.EqualError(t, err, "key sig1 not found")
+	v, err := sc.QueryByKeyAsBytes(ctx, "sig1")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	require.NoError(t, ctx.end(sc.PutString(ctx, "sig1", "signed by Org1")))
+	require.NoError(t, ctx.end(sc.PutBytes(ctx, "doc1", []byte(`{"title":"contract"}`))))
+
+	s, err := sc.QueryByKeyAsString(ctx, "sig1")
+	require.NoError(t, err)
+	require.Equal(t, "signed by Org1", s)
+	v, err = sc.QueryByKey(ctx, "doc1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"title":"contract"}`, string(v))
+
+	_, err = sc.QueryByKeyAsString(ctx, "missing")
+	require.EqualError(t, err, "key missing not found")
+	require.EqualError(t, ctx.end(sc.PutString(ctx, "", "x")), "key must not be empty")
+	require.EqualError(t, ctx.end(sc.PutString(ctx, "\x00contract~owner\x00", "x")), `key "\x00contract~owner\x00" starts with the reserved prefix "\x00"`)
+	require.EqualError(t, ctx.end(sc.PutBytes(ctx, "\x00contract~owner\x00", nil)), `key "\x00contract~owner\x00" starts with the reserved prefix "\x00"`)
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+	require.NoError(t, ctx.end(sc.Initialize(ctx)))
+
+	require.EqualError(t, ctx.end(sc.UpdateString(ctx, "sig1", "v2")), "the key sig1 does not exist")
+	require.EqualError(t, ctx.end(sc.UpdateBytes(ctx, "doc1", []byte(`{}`))), "the key doc1 does not exist")
+
+	require.NoError(t, ctx.end(sc.PutString(ctx, "sig1", "v1")))
+	require.NoError(t, ctx.end(sc.PutBytes(ctx, "doc1", []byte(`{"v":1}`))))
+	stub.StartTransaction("")
+	require.NoError(t, ctx.end(sc.UpdateString(ctx, "sig1", "v2")))
+	require.NoError(t, ctx.end(sc.UpdateBytes(ctx, "doc1", []byte(`{"v":2}`))))
+
+	s, err := sc.QueryByKeyAsString(ctx, "sig1")
+	require.NoError(t, err)
+	require.Equal(t, "v2", s)
+
+	require.NoError(t, ctx.end(sc.DeleteByKey(ctx, "sig1")))
+	require.NoError(t, ctx.end(sc.DeleteByKey(ctx, "sig1")), "deleting a missing key is a no-op")
+	require.EqualError(t, ctx.end(sc.DeleteByKey(ctx, "\x00contract~owner\x00")), `key "\x00contract~owner\x00" starts with the reserved prefix "\x00"`)
+	exists, err := sc.KeyExists(ctx, "sig1")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	history, err := stub.GetHistoryForKey("sig1")
+	require.NoError(t, err)
+	var deletes []bool
+	for history.HasNext() {
+		mod, err := history.Next()
+		require.NoError(t, err)
+		deletes = append(deletes, mod.IsDelete)
+	}
+	require.Equal(t, []bool{true, false, false}, deletes)
+}
+
+func TestQueryByRange(t *testing.T) {
+	ctx, stub := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+
+	results, err := sc.QueryByRange(ctx, "", "")
+	require.NoError(t, err)
+	require.Empty(t, results)
+
+	require.NoError(t, ctx.end(sc.PutBytes(ctx, "a1", []byte(`{"name":"alpha","size":1}`))))
+	require.NoError(t, ctx.end(sc.PutString(ctx, "a2", "plain text")))
+	require.NoError(t, ctx.end(sc.PutBytes(ctx, "a3", []byte(`[1,2]`))))
+	require.NoError(t, ctx.end(sc.PutString(ctx, "b1", "42")))
+	compositeKey, err := stub.CreateCompositeKey("owner~key", []string{"Org1MSP", "a1"})
+	require.NoError(t, err)
+	require.NoError(t, stub.PutState(compositeKey, []byte(`{}`)))
+	require.NoError(t, ctx.end(nil))
+
+	results, err = sc.QueryByRange(ctx, "", "")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.QueryRichResult{
+		{Key: "a1", Value: map[string]interface{}{"name": "alpha", "size": float64(1)}, IsJSON: true},
+		{Key: "a2", Value: "plain text", IsJSON: false},
+		{Key: "a3", Value: []interface{}{float64(1), float64(2)}, IsJSON: true},
+		{Key: "b1", Value: float64(42), IsJSON: true},
+	}, results)
+
+	// the end key is exclusive
+	results, err = sc.QueryByRange(ctx, "a2", "b1")
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "a2", results[0].Key)
+	require.Equal(t, "a3", results[1].Key)
+
+	results, err = sc.QueryByRange(ctx, "a3", "")
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	results, err = sc.QueryByRange(ctx, "c", "d")
+	require.NoError(t, err)
+	require.Empty(t, results)
+
+	_, err = sc.QueryByRange(ctx, compositeKey, "")
+	require.ErrorContains(t, err, "contains a null character which is not allowed")
+
+	brokenCtx := newBrokenContext(&cannedIterator{err: fmt.Errorf("failed retrieving next item")})
+	_, err = sc.QueryByRange(brokenCtx, "", "")
+	require.EqualError(t, err, "failed retrieving next item")
+}
+
+func TestQueryByRichAsJson(t *testing.T) {
+	ctx, _ := newTransactionContext(t)
+	sc := chaincode.SmartContract{}
+
+	v, err := sc.QueryByRichAsJson(ctx, `{"selector":{}}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `[]`, string(v))
+
+	require.NoError(t, ctx.end(sc.PutBytes(ctx, "m1", []byte(`{"model_label":"storage","size":10,"meta":{"org":"Org1MSP"}}`))))
+	require.NoError(t, ctx.end(sc.PutBytes(ctx, "m2", []byte(`{"model_label":"collect","size":20,"meta":{"org":"Org2MSP"}}`))))
+	require.NoError(t, ctx.end(sc.PutBytes(ctx, "m3", []byte(`{"model_label":"storage","size":30}`))))
+	require.NoError(t, ctx.end(sc.PutString(ctx, "s1", "not json")))
+
+	// each record is identified by its unique size
+	tests := []struct {
+		query string
+		sizes []float64
+	}{
+		{`{"selector":{"model_label":"storage"}}`, []float64{10, 30}},
+		{`{"selector":{"size":{"$gt":10,"$lte":30}}}`, []float64{20, 30}},
+		{`{"selector":{"meta.org":"Org2MSP"}}`, []float64{20}},
+		{`{"selector":{"meta":{"org":"Org1MSP"}}}`, []float64{10}},
+		{`{"selector":{"meta":{"$exists":false}}}`, []float64{30}},
+		{`{"selector":{"model_label":{"$in":["collect","control"]}}}`, []float64{20}},
+		{`{"selector":{"model_label":{"$nin":["collect"]}}}`, []float64{10, 30}},
+		{`{"selector":{"model_label":{"$regex":"^sto"}}}`, []float64{10, 30}},
+		{`{"selector":{"$or":[{"size":10},{"size":20}]}}`, []float64{10, 20}},
+		{`{"selector":{"$and":[{"model_label":"storage"},{"size":{"$ne":10}}]}}`, []float64{30}},
+		{`{"selector":{"$not":{"model_label":"storage"}}}`, []float64{20}},
+		{`{"selector":{"_id":{"$gte":"m2"}}}`, []float64{20, 30}},
+		{`{"selector":{"size":{"$gt":0}},"sort":[{"size":"desc"}],"limit":2}`, []float64{30, 20}},
+		{`{"selector":{"size":{"$gt":0}},"sort":["size"],"skip":1}`, []float64{20, 30}},
+		{`{"selector":{"model_label":"archive"}}`, nil},
+	}
+	for _, tt := range tests {
+		v, err := sc.QueryByRichAsJson(ctx, tt.query)
+		require.NoError(t, err, tt.query)
+		var records []map[string]interface{}
+		require.NoError(t, json.Unmarshal(v, &records), tt.query)
+		var sizes []float64
+		for _, r := range records {
+			sizes = append(sizes, r["size"].(float64))
+		}
+		require.Equal(t, tt.sizes, sizes, tt.query)
+	}
+
+	_, err = sc.QueryByRichAsJson(ctx, `not a query`)
+	require.ErrorContains(t, err, "failed to iterate query result: invalid query")
+	_, err = sc.QueryByRichAsJson(ctx, `{"selector":{"size":{"$near":1}}}`)
+	require.EqualError(t, err, "failed to iterate query result: unsupported operator $near")
+
+	brokenCtx := newBrokenContext(&cannedIterator{err: fmt.Errorf("failed retrieving next item")})
+	_, err = sc.QueryByRichAsJson(brokenCtx, `{"selector":{}}`)
+	require.EqualError(t, err, "failed to iterate query result: failed retrieving next item")
+
+	brokenCtx = newBrokenContext(&cannedIterator{kvs: []*queryresult.KV{{Key: "s1", Value: []byte("not json")}}})
+	_, err = sc.QueryByRichAsJson(brokenCtx, `{"selector":{}}`)
+	require.ErrorContains(t, err, "failed to unmarshal record")
+}
@@ -0,0 +1,113 @@
+// Package merkle 计算世界状态的Merkle根和包含证明，并离线校验证明。
+// 只依赖标准库，合作方无需连接peer即可使用。
+//
+// 叶子按key的账本顺序排列，叶子哈希为
+// sha256(0x00 || uint32(len(key)) || key || value)，
+// 内部节点哈希为 sha256(0x01 || left || right)。
+// 某层节点数为奇数时，最后一个节点直接进入上一层。
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// 证明路径中的一步：兄弟节点的哈希(hex)及其是否在左侧
+type Step struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+// 计算(key, value)的叶子哈希
+func LeafHash(key string, value []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	binary.Write(h, binary.BigEndian, uint32(len(key)))
+	h.Write([]byte(key))
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// 计算叶子哈希的Merkle根，没有叶子时为sha256("")
+func Root(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	level := leaves
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+	return level[0]
+}
+
+// 返回第index个叶子到根的兄弟节点路径
+func Prove(leaves [][]byte, index int) ([]Step, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf %d out of range, the tree has %d leaves", index, len(leaves))
+	}
+	path := []Step{}
+	level := leaves
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			path = append(path, Step{Hash: hex.EncodeToString(level[sibling]), Left: sibling < index})
+		}
+		level = nextLevel(level)
+		index /= 2
+	}
+	return path, nil
+}
+
+// 校验(key, value)及路径path能否得到root(hex)
+func Verify(root string, key string, value []byte, path []Step) error {
+	expected, err := hex.DecodeString(root)
+	if err != nil {
+		return fmt.Errorf("invalid root: %v", err)
+	}
+
+	hash := LeafHash(key, value)
+	for i, step := range path {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return fmt.Errorf("invalid hash at step %d: %v", i, err)
+		}
+		if step.Left {
+			hash = nodeHash(sibling, hash)
+		} else {
+			hash = nodeHash(hash, sibling)
+		}
+	}
+	if !bytes.Equal(hash, expected) {
+		return fmt.Errorf("the proof of key %s does not match root %s", key, root)
+	}
+	return nil
+}
+
+func nextLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 < len(level) {
+			next = append(next, nodeHash(level[i], level[i+1]))
+		} else {
+			next = append(next, level[i])
+		}
+	}
+	return next
+}
@@ -0,0 +1,49 @@
+package merkle_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"guolong.com/basic-chaincode/merkle"
+)
+
+func TestProveAndVerify(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		var leaves [][]byte
+		for i := 0; i < n; i++ {
+			leaves = append(leaves, merkle.LeafHash(fmt.Sprintf("k%d", i), []byte(fmt.Sprintf("v%d", i))))
+		}
+		root := hex.EncodeToString(merkle.Root(leaves))
+
+		for i := 0; i < n; i++ {
+			path, err := merkle.Prove(leaves, i)
+			require.NoError(t, err)
+			key := fmt.Sprintf("k%d", i)
+			require.NoError(t, merkle.Verify(root, key, []byte(fmt.Sprintf("v%d", i)), path), "leaf %d of %d", i, n)
+			require.Error(t, merkle.Verify(root, key, []byte("forged"), path))
+		}
+		_, err := merkle.Prove(leaves, n)
+		require.EqualError(t, err, fmt.Sprintf("leaf %d out of range, the tree has %d leaves", n, n))
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	leaves := [][]byte{
+		merkle.LeafHash("a", []byte("1")),
+		merkle.LeafHash("b", []byte("2")),
+		merkle.LeafHash("c", []byte("3")),
+	}
+	root := hex.EncodeToString(merkle.Root(leaves))
+	path, err := merkle.Prove(leaves, 1)
+	require.NoError(t, err)
+
+	require.EqualError(t, merkle.Verify(root, "a", []byte("2"), path), "the proof of key a does not match root "+root)
+	path[0].Left = !path[0].Left
+	require.Error(t, merkle.Verify(root, "b", []byte("2"), path))
+	require.ErrorContains(t, merkle.Verify("zz", "b", []byte("2"), nil), "invalid root")
+
+	// key and value boundaries are part of the leaf
+	require.NotEqual(t, merkle.LeafHash("ab", []byte("c")), merkle.LeafHash("a", []byte("bc")))
+}
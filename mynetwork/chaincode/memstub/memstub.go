@@ -0,0 +1,1065 @@
+// Package memstub is an in-memory world state for the tests of the chaincodes
+// of this network. The chaincode modules require it through a replace
+// directive and vendor it, so they still build on their own when packaged.
+package memstub
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	compositeKeyNamespace = "\x00"
+	emptyKeySubstitute    = "\x01"
+)
+
+// MemStub is an in-memory implementation of shim.ChaincodeStubInterface. Unlike
+// the counterfeiter fakes it keeps real world state, so a test can create an
+// asset in one call and read it back in the next.
+//
+// It follows peer semantics where contract code can observe them: reads only
+// see committed state, not the writes of the transaction itself, open-ended
+// range queries skip composite keys, history is returned newest first, only the
+// last event set in a transaction is kept and GetQueryResult evaluates Mango
+// selectors the way CouchDB does. Writes are kept with the transaction until
+// EndTransaction commits them, or discards them if the transaction failed.
+type MemStub struct {
+	ChannelID string
+	TxID      string
+
+	args        [][]byte
+	state       map[string][]byte
+	history     map[string][]*queryresult.KeyModification
+	private     map[string]map[string][]byte
+	validation  map[string][]byte
+	writes      map[string]write
+	privWrites  map[string]map[string]write
+	valWrites   map[string][]byte
+	invoked     []*MemStub
+	transient   map[string][]byte
+	decorations map[string][]byte
+	creator     []byte
+	txTimestamp time.Time
+	txCount     int
+	event       *peer.ChaincodeEvent
+	events      []*peer.ChaincodeEvent
+	chaincodes  map[string]installedChaincode
+}
+
+// write is a pending write of a transaction.
+type write struct {
+	value   []byte
+	deleted bool
+}
+
+// installedChaincode is a chaincode that InvokeChaincode can reach.
+type installedChaincode struct {
+	chaincode shim.Chaincode
+	stub      *MemStub
+}
+
+// New returns an empty MemStub on channel "mychannel". The transaction clock
+// starts at a fixed instant so that tests are deterministic.
+func New() *MemStub {
+	s := &MemStub{
+		ChannelID:   "mychannel",
+		state:       make(map[string][]byte),
+		history:     make(map[string][]*queryresult.KeyModification),
+		private:     make(map[string]map[string][]byte),
+		validation:  make(map[string][]byte),
+		transient:   make(map[string][]byte),
+		decorations: make(map[string][]byte),
+		chaincodes:  make(map[string]installedChaincode),
+		txTimestamp: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+	s.StartTransaction("")
+	return s
+}
+
+// StartTransaction begins a new transaction with the given ID, or a generated
+// one when txID is empty. The transaction clock moves forward one second, the
+// transient map is cleared and the pending event is discarded, as are the
+// writes of a transaction that was not ended.
+func (s *MemStub) StartTransaction(txID string) {
+	s.discardWrites()
+	s.txCount++
+	if txID == "" {
+		txID = fmt.Sprintf("tx%d", s.txCount)
+	}
+	s.TxID = txID
+	s.txTimestamp = s.txTimestamp.Add(time.Second)
+	s.transient = make(map[string][]byte)
+	s.event = nil
+}
+
+// EndTransaction ends the writes of the current transaction the way a peer
+// would: they are committed if err is nil, and discarded with the event if
+// not. The writes of the chaincodes it invoked go the same way. It returns err,
+// so that a call can be wrapped in it. Writes after it start over, in the same
+// transaction.
+func (s *MemStub) EndTransaction(err error) error {
+	for _, invoked := range s.invoked {
+		invoked.EndTransaction(err)
+	}
+	s.invoked = nil
+	if err != nil {
+		s.discardWrites()
+		s.event = nil
+		return err
+	}
+
+	for _, key := range sortedKeys(s.writes) {
+		w := s.writes[key]
+		_, exists := s.state[key]
+		switch {
+		case w.deleted && exists:
+			delete(s.state, key)
+			delete(s.validation, key)
+			s.recordHistory(key, nil, true)
+		case !w.deleted:
+			s.state[key] = w.value
+			s.recordHistory(key, w.value, false)
+		}
+	}
+	for collection, writes := range s.privWrites {
+		if s.private[collection] == nil {
+			s.private[collection] = make(map[string][]byte)
+		}
+		for key, w := range writes {
+			if w.deleted {
+				delete(s.private[collection], key)
+			} else {
+				s.private[collection][key] = w.value
+			}
+		}
+	}
+	for key, ep := range s.valWrites {
+		s.validation[key] = ep
+	}
+	s.discardWrites()
+	return nil
+}
+
+// MockInvoke calls cc with the arguments set by SetArgs and ends the
+// transaction with the outcome of the call, see EndTransaction.
+func (s *MemStub) MockInvoke(cc shim.Chaincode) *peer.Response {
+	response := cc.Invoke(s)
+	var err error
+	if response.GetStatus() >= shim.ERRORTHRESHOLD {
+		err = errors.New(response.GetMessage())
+	}
+	s.EndTransaction(err)
+	return response
+}
+
+func (s *MemStub) discardWrites() {
+	s.writes = make(map[string]write)
+	s.privWrites = make(map[string]map[string]write)
+	s.valWrites = make(map[string][]byte)
+}
+
+// SetTxTimestamp overrides the timestamp of the current transaction.
+func (s *MemStub) SetTxTimestamp(t time.Time) {
+	s.txTimestamp = t
+}
+
+// SetArgs sets the function name and parameters returned by GetArgs and friends.
+func (s *MemStub) SetArgs(function string, params ...string) {
+	s.args = [][]byte{[]byte(function)}
+	for _, p := range params {
+		s.args = append(s.args, []byte(p))
+	}
+}
+
+// SetTransient replaces the transient map of the current transaction.
+func (s *MemStub) SetTransient(transient map[string][]byte) {
+	s.transient = transient
+}
+
+// SetCreator sets the serialized identity returned by GetCreator.
+func (s *MemStub) SetCreator(creator []byte) {
+	s.creator = creator
+}
+
+// SetIdentity makes a freshly generated X.509 certificate for commonName in
+// mspID the transaction creator. The ous become the certificate's
+// organizational units, so passing "admin" marks an org admin under NodeOUs.
+// The same commonName always yields the same client ID.
+func (s *MemStub) SetIdentity(mspID, commonName string, ous ...string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.txCount)),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: ous},
+		NotBefore:    s.txTimestamp.Add(-time.Hour),
+		NotAfter:     s.txTimestamp.Add(24 * 365 * time.Hour),
+	}
+	issuer := &x509.Certificate{Subject: pkix.Name{CommonName: "ca." + mspID}}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		return err
+	}
+	s.creator = creator
+	return nil
+}
+
+// InstallChaincode makes cc callable through InvokeChaincode as name on
+// channel, where an empty channel means the stub's own. It returns the stub
+// holding the world state of cc; calls run on it with the caller's
+// transaction ID, timestamp, creator and transient map, as on a peer.
+func (s *MemStub) InstallChaincode(channel, name string, cc shim.Chaincode) *MemStub {
+	if channel == "" {
+		channel = s.ChannelID
+	}
+	stub := New()
+	stub.ChannelID = channel
+	s.chaincodes[channel+"/"+name] = installedChaincode{chaincode: cc, stub: stub}
+	return stub
+}
+
+// Event returns the event set by the current transaction, or nil.
+func (s *MemStub) Event() *peer.ChaincodeEvent {
+	return s.event
+}
+
+// Events returns every event set since the stub was created, including events
+// that a later SetEvent in the same transaction replaced.
+func (s *MemStub) Events() []*peer.ChaincodeEvent {
+	return s.events
+}
+
+// Keys returns every key in the committed world state, composite keys
+// included, in ledger order.
+func (s *MemStub) Keys() []string {
+	return sortedKeys(s.state)
+}
+
+// GetArgs documentation can be found in interfaces.go
+func (s *MemStub) GetArgs() [][]byte {
+	return s.args
+}
+
+// GetStringArgs documentation can be found in interfaces.go
+func (s *MemStub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, a := range s.args {
+		args = append(args, string(a))
+	}
+	return args
+}
+
+// GetFunctionAndParameters documentation can be found in interfaces.go
+func (s *MemStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+// GetArgsSlice documentation can be found in interfaces.go
+func (s *MemStub) GetArgsSlice() ([]byte, error) {
+	return bytes.Join(s.args, nil), nil
+}
+
+// GetTxID documentation can be found in interfaces.go
+func (s *MemStub) GetTxID() string {
+	return s.TxID
+}
+
+// GetChannelID documentation can be found in interfaces.go
+func (s *MemStub) GetChannelID() string {
+	return s.ChannelID
+}
+
+// InvokeChaincode documentation can be found in interfaces.go
+func (s *MemStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) *peer.Response {
+	if channel == "" {
+		channel = s.ChannelID
+	}
+	installed, ok := s.chaincodes[channel+"/"+chaincodeName]
+	if !ok {
+		return shim.Error(fmt.Sprintf("chaincode %s is not available on channel %s", chaincodeName, channel))
+	}
+
+	target := installed.stub
+	target.TxID = s.TxID
+	target.txTimestamp = s.txTimestamp
+	target.creator = s.creator
+	target.transient = s.transient
+	target.args = args
+	s.invoked = append(s.invoked, target)
+	return installed.chaincode.Invoke(target)
+}
+
+// GetState documentation can be found in interfaces.go
+func (s *MemStub) GetState(key string) ([]byte, error) {
+	return clone(s.state[key]), nil
+}
+
+// PutState documentation can be found in interfaces.go
+func (s *MemStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("invalid key. key must be a valid UTF-8 string: [%x]", key)
+	}
+	s.writes[key] = write{value: clone(value)}
+	return nil
+}
+
+// DelState documentation can be found in interfaces.go
+func (s *MemStub) DelState(key string) error {
+	s.writes[key] = write{deleted: true}
+	return nil
+}
+
+func (s *MemStub) recordHistory(key string, value []byte, isDelete bool) {
+	s.history[key] = append(s.history[key], &queryresult.KeyModification{
+		TxId:      s.TxID,
+		Value:     clone(value),
+		Timestamp: timestamppb.New(s.txTimestamp),
+		IsDelete:  isDelete,
+	})
+}
+
+// SetStateValidationParameter documentation can be found in interfaces.go
+func (s *MemStub) SetStateValidationParameter(key string, ep []byte) error {
+	s.valWrites[key] = clone(ep)
+	return nil
+}
+
+// GetStateValidationParameter documentation can be found in interfaces.go
+func (s *MemStub) GetStateValidationParameter(key string) ([]byte, error) {
+	return clone(s.validation[key]), nil
+}
+
+// GetStateByRange documentation can be found in interfaces.go
+func (s *MemStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	return newIterator(rangeOf(s.state, startKey, endKey)), nil
+}
+
+// GetStateByRangeWithPagination documentation can be found in interfaces.go
+func (s *MemStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, nil, err
+	}
+	kvs, metadata := pageByKey(rangeOf(s.state, startKey, endKey), pageSize, bookmark)
+	return newIterator(kvs), metadata, nil
+}
+
+// GetStateByPartialCompositeKey documentation can be found in interfaces.go
+func (s *MemStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator(rangeOf(s.state, startKey, endKey)), nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination documentation can be found in interfaces.go
+func (s *MemStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string,
+	pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	kvs, metadata := pageByKey(rangeOf(s.state, startKey, endKey), pageSize, bookmark)
+	return newIterator(kvs), metadata, nil
+}
+
+// CreateCompositeKey documentation can be found in interfaces.go
+func (s *MemStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+// SplitCompositeKey documentation can be found in interfaces.go
+func (s *MemStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) {
+		return "", nil, fmt.Errorf("key [%s] is not a composite key", compositeKey)
+	}
+	components := strings.Split(strings.TrimSuffix(compositeKey[1:], "\x00"), "\x00")
+	return components[0], components[1:], nil
+}
+
+// GetQueryResult documentation can be found in interfaces.go
+func (s *MemStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	kvs, err := executeQuery(s.state, query)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator(kvs), nil
+}
+
+// GetQueryResultWithPagination documentation can be found in interfaces.go
+func (s *MemStub) GetQueryResultWithPagination(query string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	kvs, err := executeQuery(s.state, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, metadata, err := pageByOffset(kvs, pageSize, bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newIterator(page), metadata, nil
+}
+
+// GetHistoryForKey documentation can be found in interfaces.go
+func (s *MemStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	mods := s.history[key]
+	newestFirst := make([]*queryresult.KeyModification, 0, len(mods))
+	for i := len(mods) - 1; i >= 0; i-- {
+		newestFirst = append(newestFirst, mods[i])
+	}
+	return &historyIterator{mods: newestFirst}, nil
+}
+
+// GetPrivateData documentation can be found in interfaces.go
+func (s *MemStub) GetPrivateData(collection, key string) ([]byte, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	return clone(s.private[collection][key]), nil
+}
+
+// GetPrivateDataHash documentation can be found in interfaces.go
+func (s *MemStub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	value, ok := s.private[collection][key]
+	if !ok {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// PutPrivateData documentation can be found in interfaces.go
+func (s *MemStub) PutPrivateData(collection string, key string, value []byte) error {
+	if collection == "" {
+		return errors.New("collection must not be an empty string")
+	}
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	s.putPrivateWrite(collection, key, write{value: clone(value)})
+	return nil
+}
+
+// DelPrivateData documentation can be found in interfaces.go
+func (s *MemStub) DelPrivateData(collection, key string) error {
+	if collection == "" {
+		return errors.New("collection must not be an empty string")
+	}
+	s.putPrivateWrite(collection, key, write{deleted: true})
+	return nil
+}
+
+func (s *MemStub) putPrivateWrite(collection, key string, w write) {
+	if s.privWrites[collection] == nil {
+		s.privWrites[collection] = make(map[string]write)
+	}
+	s.privWrites[collection][key] = w
+}
+
+// PurgePrivateData documentation can be found in interfaces.go
+func (s *MemStub) PurgePrivateData(collection, key string) error {
+	return s.DelPrivateData(collection, key)
+}
+
+// SetPrivateDataValidationParameter documentation can be found in interfaces.go
+func (s *MemStub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	s.valWrites[collection+compositeKeyNamespace+key] = clone(ep)
+	return nil
+}
+
+// GetPrivateDataValidationParameter documentation can be found in interfaces.go
+func (s *MemStub) GetPrivateDataValidationParameter(collection, key string) ([]byte, error) {
+	return clone(s.validation[collection+compositeKeyNamespace+key]), nil
+}
+
+// GetPrivateDataByRange documentation can be found in interfaces.go
+func (s *MemStub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	return newIterator(rangeOf(s.private[collection], startKey, endKey)), nil
+}
+
+// GetPrivateDataByPartialCompositeKey documentation can be found in interfaces.go
+func (s *MemStub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator(rangeOf(s.private[collection], startKey, endKey)), nil
+}
+
+// GetPrivateDataQueryResult documentation can be found in interfaces.go
+func (s *MemStub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	kvs, err := executeQuery(s.private[collection], query)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator(kvs), nil
+}
+
+// GetCreator documentation can be found in interfaces.go
+func (s *MemStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+// GetTransient documentation can be found in interfaces.go
+func (s *MemStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+// GetBinding documentation can be found in interfaces.go
+func (s *MemStub) GetBinding() ([]byte, error) {
+	return nil, nil
+}
+
+// GetDecorations documentation can be found in interfaces.go
+func (s *MemStub) GetDecorations() map[string][]byte {
+	return s.decorations
+}
+
+// GetSignedProposal documentation can be found in interfaces.go
+func (s *MemStub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return &peer.SignedProposal{}, nil
+}
+
+// GetTxTimestamp documentation can be found in interfaces.go
+func (s *MemStub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return timestamppb.New(s.txTimestamp), nil
+}
+
+// SetEvent documentation can be found in interfaces.go
+func (s *MemStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("event name can not be empty string")
+	}
+	s.event = &peer.ChaincodeEvent{TxId: s.TxID, EventName: name, Payload: clone(payload)}
+	s.events = append(s.events, s.event)
+	return nil
+}
+
+// ============ iterators =======
+
+type stateIterator struct {
+	kvs []*queryresult.KV
+	pos int
+}
+
+func newIterator(kvs []*queryresult.KV) *stateIterator {
+	return &stateIterator{kvs: kvs}
+}
+
+func (it *stateIterator) HasNext() bool {
+	return it.pos < len(it.kvs)
+}
+
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no such key")
+	}
+	kv := it.kvs[it.pos]
+	it.pos++
+	return kv, nil
+}
+
+func (it *stateIterator) Close() error {
+	return nil
+}
+
+type historyIterator struct {
+	mods []*queryresult.KeyModification
+	pos  int
+}
+
+func (it *historyIterator) HasNext() bool {
+	return it.pos < len(it.mods)
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no such key")
+	}
+	mod := it.mods[it.pos]
+	it.pos++
+	return mod, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+// ============ range helpers =======
+
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rangeOf returns the entries with startKey <= key < endKey in key order. An
+// empty endKey leaves the range open-ended.
+func rangeOf(m map[string][]byte, startKey, endKey string) []*queryresult.KV {
+	var kvs []*queryresult.KV
+	for _, k := range sortedKeys(m) {
+		if k < startKey || (endKey != "" && k >= endKey) {
+			continue
+		}
+		kvs = append(kvs, &queryresult.KV{Key: k, Value: clone(m[k])})
+	}
+	return kvs
+}
+
+func validateSimpleKeys(keys ...string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, compositeKeyNamespace) {
+			return fmt.Errorf(`first character of the key [%s] contains a null character which is not allowed`, key)
+		}
+	}
+	return nil
+}
+
+func partialCompositeKeyRange(objectType string, attributes []string) (string, string, error) {
+	partialKey, err := shim.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return "", "", err
+	}
+	return partialKey, partialKey + string(utf8.MaxRune), nil
+}
+
+// pageByKey pages a key-ordered result set. As on LevelDB the bookmark is the
+// key the next page starts from, and it is empty once the results run out.
+func pageByKey(kvs []*queryresult.KV, pageSize int32, bookmark string) ([]*queryresult.KV, *peer.QueryResponseMetadata) {
+	start := 0
+	if bookmark != "" {
+		start = sort.Search(len(kvs), func(i int) bool { return kvs[i].Key >= bookmark })
+	}
+	end := len(kvs)
+	if pageSize > 0 && start+int(pageSize) < end {
+		end = start + int(pageSize)
+	}
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(end - start)}
+	if end < len(kvs) {
+		metadata.Bookmark = kvs[end].Key
+	}
+	return kvs[start:end], metadata
+}
+
+// pageByOffset pages a rich query result set, which may be sorted by any field,
+// so the bookmark records an offset rather than a key.
+func pageByOffset(kvs []*queryresult.KV, pageSize int32, bookmark string) ([]*queryresult.KV, *peer.QueryResponseMetadata, error) {
+	start := 0
+	if bookmark != "" {
+		var err error
+		start, err = strconv.Atoi(bookmark)
+		if err != nil || start < 0 {
+			return nil, nil, fmt.Errorf("invalid bookmark %q", bookmark)
+		}
+		if start > len(kvs) {
+			start = len(kvs)
+		}
+	}
+	end := len(kvs)
+	if pageSize > 0 && start+int(pageSize) < end {
+		end = start + int(pageSize)
+	}
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(end - start)}
+	if end < len(kvs) {
+		metadata.Bookmark = strconv.Itoa(end)
+	}
+	return kvs[start:end], metadata, nil
+}
+
+// ============ Mango queries =======
+
+type mangoQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort     []interface{}          `json:"sort"`
+	Limit    int                    `json:"limit"`
+	Skip     int                    `json:"skip"`
+}
+
+type document struct {
+	kv   *queryresult.KV
+	body map[string]interface{}
+}
+
+// executeQuery evaluates a CouchDB Mango query against the JSON values in m.
+// Values that are not JSON objects are skipped, as CouchDB stores them as
+// attachments that selectors never match. Results are in key order unless the
+// query asks for a sort.
+func executeQuery(m map[string][]byte, query string) ([]*queryresult.KV, error) {
+	var q mangoQuery
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, fmt.Errorf("invalid query %q: %v", query, err)
+	}
+	if q.Selector == nil {
+		return nil, fmt.Errorf("invalid query %q: a selector is required", query)
+	}
+
+	var docs []document
+	for _, k := range sortedKeys(m) {
+		var body map[string]interface{}
+		if err := json.Unmarshal(m[k], &body); err != nil {
+			continue
+		}
+		body["_id"] = k
+		ok, err := matchSelector(body, q.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			docs = append(docs, document{kv: &queryresult.KV{Key: k, Value: clone(m[k])}, body: body})
+		}
+	}
+
+	if err := sortDocuments(docs, q.Sort); err != nil {
+		return nil, err
+	}
+	if q.Skip > 0 {
+		if q.Skip > len(docs) {
+			q.Skip = len(docs)
+		}
+		docs = docs[q.Skip:]
+	}
+	if q.Limit > 0 && q.Limit < len(docs) {
+		docs = docs[:q.Limit]
+	}
+
+	kvs := make([]*queryresult.KV, 0, len(docs))
+	for _, d := range docs {
+		kvs = append(kvs, d.kv)
+	}
+	return kvs, nil
+}
+
+func sortDocuments(docs []document, fields []interface{}) error {
+	type sortField struct {
+		path string
+		desc bool
+	}
+	var order []sortField
+	for _, f := range fields {
+		switch f := f.(type) {
+		case string:
+			order = append(order, sortField{path: f})
+		case map[string]interface{}:
+			for path, dir := range f {
+				desc := dir == "desc"
+				if !desc && dir != "asc" {
+					return fmt.Errorf("invalid sort direction %v for field %s", dir, path)
+				}
+				order = append(order, sortField{path: path, desc: desc})
+			}
+		default:
+			return fmt.Errorf("invalid sort field %v", f)
+		}
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, f := range order {
+			a, _ := lookup(docs[i].body, f.path)
+			b, _ := lookup(docs[j].body, f.path)
+			if c := collate(a, b); c != 0 {
+				return (c < 0) != f.desc
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// lookup resolves a dotted field path such as "owner.name" in doc.
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	value := doc
+	for _, field := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = obj[field]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func matchSelector(doc interface{}, selector map[string]interface{}) (bool, error) {
+	for field, cond := range selector {
+		var ok bool
+		var err error
+		switch field {
+		case "$and", "$or", "$nor":
+			ok, err = matchCombination(doc, field, cond)
+		case "$not":
+			sub, isMap := cond.(map[string]interface{})
+			if !isMap {
+				return false, fmt.Errorf("$not requires a selector, got %v", cond)
+			}
+			ok, err = matchSelector(doc, sub)
+			ok = !ok
+		default:
+			value, present := lookup(doc, field)
+			ok, err = matchCondition(value, present, cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchCombination(doc interface{}, op string, cond interface{}) (bool, error) {
+	selectors, ok := cond.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("%s requires an array of selectors, got %v", op, cond)
+	}
+	matched := 0
+	for _, s := range selectors {
+		sub, ok := s.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("%s requires an array of selectors, got %v", op, cond)
+		}
+		ok, err := matchSelector(doc, sub)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched++
+		}
+	}
+	switch op {
+	case "$and":
+		return matched == len(selectors), nil
+	case "$or":
+		return matched > 0, nil
+	default:
+		return matched == 0, nil
+	}
+}
+
+// matchCondition applies cond to a field value. cond is either a literal for
+// implicit equality, an object of operators, or a nested selector.
+func matchCondition(value interface{}, present bool, cond interface{}) (bool, error) {
+	ops, isMap := cond.(map[string]interface{})
+	if !isMap || !hasOperators(ops) {
+		if isMap {
+			if !present || !isObject(value) {
+				return false, nil
+			}
+			return matchSelector(value, ops)
+		}
+		return present && collate(value, cond) == 0, nil
+	}
+
+	for op, arg := range ops {
+		if op == "$exists" {
+			want, ok := arg.(bool)
+			if !ok {
+				return false, fmt.Errorf("$exists requires a boolean, got %v", arg)
+			}
+			if present != want {
+				return false, nil
+			}
+			continue
+		}
+		if !present {
+			return false, nil
+		}
+		ok, err := applyOperator(op, value, arg)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func applyOperator(op string, value, arg interface{}) (bool, error) {
+	switch op {
+	case "$eq":
+		return collate(value, arg) == 0, nil
+	case "$ne":
+		return collate(value, arg) != 0, nil
+	case "$gt":
+		return collate(value, arg) > 0, nil
+	case "$gte":
+		return collate(value, arg) >= 0, nil
+	case "$lt":
+		return collate(value, arg) < 0, nil
+	case "$lte":
+		return collate(value, arg) <= 0, nil
+	case "$in", "$nin":
+		list, ok := arg.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("%s requires an array, got %v", op, arg)
+		}
+		found := false
+		for _, candidate := range list {
+			if collate(value, candidate) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in"), nil
+	case "$regex":
+		pattern, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("$regex requires a string, got %v", arg)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid $regex %q: %v", pattern, err)
+		}
+		s, ok := value.(string)
+		return ok && re.MatchString(s), nil
+	case "$not":
+		ok, err := matchCondition(value, true, arg)
+		return !ok, err
+	default:
+		return false, fmt.Errorf("unsupported operator %s", op)
+	}
+}
+
+func hasOperators(m map[string]interface{}) bool {
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+func isObject(v interface{}) bool {
+	_, ok := v.(map[string]interface{})
+	return ok
+}
+
+// collate compares two decoded JSON values using CouchDB view collation:
+// null < false < true < numbers < strings < arrays < objects.
+func collate(a, b interface{}) int {
+	ra, rb := collationRank(a), collationRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch a := a.(type) {
+	case float64:
+		switch bf := b.(float64); {
+		case a < bf:
+			return -1
+		case a > bf:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		bs := b.([]interface{})
+		for i := 0; i < len(a) && i < len(bs); i++ {
+			if c := collate(a[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+		return len(a) - len(bs)
+	case map[string]interface{}:
+		if reflect.DeepEqual(a, b) {
+			return 0
+		}
+		ja, _ := json.Marshal(a)
+		jb, _ := json.Marshal(b)
+		return bytes.Compare(ja, jb)
+	}
+	return 0
+}
+
+func collationRank(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	default:
+		return 6
+	}
+}
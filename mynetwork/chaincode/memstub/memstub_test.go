@@ -0,0 +1,265 @@
+package memstub_test
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/require"
+	"guolong.com/memstub"
+)
+
+var _ shim.ChaincodeStubInterface = (*memstub.MemStub)(nil)
+
+func keysOf(t *testing.T, it shim.StateQueryIteratorInterface) []string {
+	t.Helper()
+	var keys []string
+	for it.HasNext() {
+		kv, err := it.Next()
+		require.NoError(t, err)
+		keys = append(keys, kv.Key)
+	}
+	require.NoError(t, it.Close())
+	return keys
+}
+
+func TestTransactions(t *testing.T) {
+	stub := memstub.New()
+	require.NoError(t, stub.PutState("k1", []byte("v1")))
+	require.NoError(t, stub.PutPrivateData("collection", "k1", []byte("p1")))
+
+	// a transaction does not read its own writes
+	v, err := stub.GetState("k1")
+	require.NoError(t, err)
+	require.Nil(t, v)
+	v, err = stub.GetPrivateData("collection", "k1")
+	require.NoError(t, err)
+	require.Nil(t, v)
+	require.NoError(t, stub.EndTransaction(nil))
+	v, err = stub.GetState("k1")
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(v))
+	v, err = stub.GetPrivateData("collection", "k1")
+	require.NoError(t, err)
+	require.Equal(t, "p1", string(v))
+
+	// a failed transaction writes nothing and sets no event
+	require.NoError(t, stub.PutState("k2", []byte("v2")))
+	require.NoError(t, stub.DelState("k1"))
+	require.NoError(t, stub.DelPrivateData("collection", "k1"))
+	require.NoError(t, stub.SetEvent("Changed", nil))
+	failed := errors.New("failed")
+	require.Equal(t, failed, stub.EndTransaction(failed))
+	require.Equal(t, []string{"k1"}, stub.Keys())
+	require.Nil(t, stub.Event())
+	v, err = stub.GetPrivateData("collection", "k1")
+	require.NoError(t, err)
+	require.Equal(t, "p1", string(v))
+
+	// neither does a transaction that is not ended
+	require.NoError(t, stub.PutState("k2", []byte("v2")))
+	stub.StartTransaction("")
+	require.NoError(t, stub.EndTransaction(nil))
+	require.Equal(t, []string{"k1"}, stub.Keys())
+
+	require.NoError(t, stub.DelState("k1"))
+	require.NoError(t, stub.EndTransaction(nil))
+	require.Empty(t, stub.Keys())
+}
+
+func TestMockInvoke(t *testing.T) {
+	stub := memstub.New()
+	stub.SetArgs("Call", "a")
+	response := stub.MockInvoke(echoChaincode{})
+	require.EqualValues(t, shim.OK, response.Status)
+	require.Equal(t, []string{"Call"}, stub.Keys())
+
+	stub.SetArgs("Fail")
+	response = stub.MockInvoke(echoChaincode{})
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.Equal(t, []string{"Call"}, stub.Keys())
+}
+
+func TestRangePagination(t *testing.T) {
+	stub := memstub.New()
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		require.NoError(t, stub.PutState(k, []byte(k)))
+	}
+	require.NoError(t, stub.EndTransaction(nil))
+
+	it, md, err := stub.GetStateByRangeWithPagination("", "", 2, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"k1", "k2"}, keysOf(t, it))
+	require.Equal(t, "k3", md.Bookmark)
+
+	it, md, err = stub.GetStateByRangeWithPagination("", "", 2, md.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, []string{"k3", "k4"}, keysOf(t, it))
+
+	it, md, err = stub.GetStateByRangeWithPagination("", "", 2, md.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, []string{"k5"}, keysOf(t, it))
+	require.Empty(t, md.Bookmark)
+	require.EqualValues(t, 1, md.FetchedRecordsCount)
+}
+
+func TestPartialCompositeKey(t *testing.T) {
+	stub := memstub.New()
+	for _, attrs := range [][]string{{"blue", "a1"}, {"blue", "a2"}, {"red", "a3"}} {
+		key, err := stub.CreateCompositeKey("color~id", attrs)
+		require.NoError(t, err)
+		require.NoError(t, stub.PutState(key, []byte{0x00}))
+	}
+	require.NoError(t, stub.PutState("a1", []byte(`{}`)))
+	require.NoError(t, stub.EndTransaction(nil))
+
+	it, err := stub.GetStateByPartialCompositeKey("color~id", []string{"blue"})
+	require.NoError(t, err)
+	keys := keysOf(t, it)
+	require.Len(t, keys, 2)
+	objectType, attrs, err := stub.SplitCompositeKey(keys[1])
+	require.NoError(t, err)
+	require.Equal(t, "color~id", objectType)
+	require.Equal(t, []string{"blue", "a2"}, attrs)
+
+	it, md, err := stub.GetStateByPartialCompositeKeyWithPagination("color~id", nil, 2, "")
+	require.NoError(t, err)
+	require.Len(t, keysOf(t, it), 2)
+	it, _, err = stub.GetStateByPartialCompositeKeyWithPagination("color~id", nil, 2, md.Bookmark)
+	require.NoError(t, err)
+	require.Len(t, keysOf(t, it), 1)
+
+	it, err = stub.GetStateByRange("", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a1"}, keysOf(t, it))
+}
+
+func TestQueryPagination(t *testing.T) {
+	stub := memstub.New()
+	require.NoError(t, stub.PutState("a", []byte(`{"n":3}`)))
+	require.NoError(t, stub.PutState("b", []byte(`{"n":1}`)))
+	require.NoError(t, stub.PutState("c", []byte(`{"n":2}`)))
+	require.NoError(t, stub.EndTransaction(nil))
+
+	query := `{"selector":{"n":{"$gt":0}},"sort":["n"]}`
+	it, md, err := stub.GetQueryResultWithPagination(query, 2, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, keysOf(t, it))
+	it, md, err = stub.GetQueryResultWithPagination(query, 2, md.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, keysOf(t, it))
+	require.Empty(t, md.Bookmark)
+
+	_, _, err = stub.GetQueryResultWithPagination(query, 2, "nonsense")
+	require.EqualError(t, err, `invalid bookmark "nonsense"`)
+	_, err = stub.GetQueryResult(`{"sort":["n"]}`)
+	require.ErrorContains(t, err, "a selector is required")
+}
+
+func TestHistory(t *testing.T) {
+	stub := memstub.New()
+	stub.StartTransaction("tx-create")
+	require.NoError(t, stub.PutState("k", []byte("v1")))
+	require.NoError(t, stub.EndTransaction(nil))
+	stub.StartTransaction("tx-update")
+	require.NoError(t, stub.PutState("k", []byte("v2")))
+	require.NoError(t, stub.EndTransaction(nil))
+	stub.StartTransaction("tx-delete")
+	require.NoError(t, stub.DelState("k"))
+	require.NoError(t, stub.EndTransaction(nil))
+
+	it, err := stub.GetHistoryForKey("k")
+	require.NoError(t, err)
+	var mods []*queryresult.KeyModification
+	for it.HasNext() {
+		mod, err := it.Next()
+		require.NoError(t, err)
+		mods = append(mods, mod)
+	}
+	require.Len(t, mods, 3)
+	require.Equal(t, "tx-delete", mods[0].TxId)
+	require.True(t, mods[0].IsDelete)
+	require.Equal(t, "tx-create", mods[2].TxId)
+	require.Equal(t, []byte("v1"), mods[2].Value)
+	require.True(t, mods[0].Timestamp.AsTime().After(mods[2].Timestamp.AsTime()))
+	_, err = it.Next()
+	require.Error(t, err)
+}
+
+func TestPrivateDataTransientAndEvents(t *testing.T) {
+	stub := memstub.New()
+	stub.SetTransient(map[string][]byte{"price": []byte("100")})
+	transient, err := stub.GetTransient()
+	require.NoError(t, err)
+	require.Equal(t, []byte("100"), transient["price"])
+
+	require.NoError(t, stub.PutPrivateData("_implicit_org_Org1MSP", "a1", []byte("100")))
+	require.NoError(t, stub.EndTransaction(nil))
+	v, err := stub.GetPrivateData("_implicit_org_Org1MSP", "a1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("100"), v)
+	hash, err := stub.GetPrivateDataHash("_implicit_org_Org1MSP", "a1")
+	require.NoError(t, err)
+	expected := sha256.Sum256([]byte("100"))
+	require.Equal(t, expected[:], hash)
+	hash, err = stub.GetPrivateDataHash("_implicit_org_Org2MSP", "a1")
+	require.NoError(t, err)
+	require.Nil(t, hash)
+	_, err = stub.GetPrivateData("", "a1")
+	require.EqualError(t, err, "collection must not be an empty string")
+
+	require.NoError(t, stub.SetEvent("First", []byte("1")))
+	require.NoError(t, stub.SetEvent("Second", []byte("2")))
+	require.Equal(t, "Second", stub.Event().EventName)
+	require.Len(t, stub.Events(), 2)
+	require.EqualError(t, stub.SetEvent("", nil), "event name can not be empty string")
+
+	stub.StartTransaction("")
+	require.Nil(t, stub.Event())
+	transient, err = stub.GetTransient()
+	require.NoError(t, err)
+	require.Empty(t, transient)
+}
+
+// echoChaincode records each call under the function name and returns the
+// parameters, or fails if the function is Fail.
+type echoChaincode struct{}
+
+func (echoChaincode) Init(shim.ChaincodeStubInterface) *peer.Response {
+	return shim.Success(nil)
+}
+
+func (echoChaincode) Invoke(stub shim.ChaincodeStubInterface) *peer.Response {
+	function, params := stub.GetFunctionAndParameters()
+	if err := stub.PutState(function, []byte(stub.GetTxID())); err != nil {
+		return shim.Error(err.Error())
+	}
+	if function == "Fail" {
+		return shim.Error("failed")
+	}
+	return shim.Success([]byte(strings.Join(params, ",")))
+}
+
+func TestInvokeChaincode(t *testing.T) {
+	stub := memstub.New()
+	echoStub := stub.InstallChaincode("", "echo", echoChaincode{})
+
+	stub.StartTransaction("tx-call")
+	response := stub.InvokeChaincode("echo", [][]byte{[]byte("Call"), []byte("a"), []byte("b")}, "mychannel")
+	require.EqualValues(t, shim.OK, response.Status)
+	require.Equal(t, "a,b", string(response.Payload))
+	require.Empty(t, echoStub.Keys(), "the call is committed with the transaction that made it")
+	require.NoError(t, stub.EndTransaction(nil))
+	v, err := echoStub.GetState("Call")
+	require.NoError(t, err)
+	require.Equal(t, "tx-call", string(v))
+	require.Empty(t, stub.Keys())
+
+	response = stub.InvokeChaincode("echo", [][]byte{[]byte("Call")}, "otherchannel")
+	require.EqualValues(t, shim.ERROR, response.Status)
+	require.Equal(t, "chaincode echo is not available on channel otherchannel", response.Message)
+}
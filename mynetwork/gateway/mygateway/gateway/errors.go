@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gatewaypb "github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
+)
+
+// 链码ContractError的错误码，与assetTransfer链码中的ErrorCode一致
+const (
+	ErrCodeAssetNotFound    = "ASSET_NOT_FOUND"
+	ErrCodeAssetExists      = "ASSET_EXISTS"
+	ErrCodeNotOwner         = "NOT_OWNER"
+	ErrCodeAccessDenied     = "ACCESS_DENIED"
+	ErrCodeInvalidArgument  = "INVALID_ARGUMENT"
+	ErrCodeInvalidStatus    = "INVALID_STATUS"
+	ErrCodeStateReadFailed  = "STATE_READ_FAILED"
+	ErrCodeStateWriteFailed = "STATE_WRITE_FAILED"
+
+	// ErrCodeTransferRestricted 受监管资产的接收方不满足转移限制，原因在Details的Reason中
+	ErrCodeTransferRestricted = "TRANSFER_RESTRICTED"
+
+	// ErrCodeQuotaExceeded 资产数量或估值总额超出所有者的配额，配额项在Details的Quota中，上限在Limit中
+	ErrCodeQuotaExceeded = "QUOTA_EXCEEDED"
+)
+
+// ChaincodeError 链码返回的带错误码的错误
+// Code、Message、Details来自链码返回的JSON，Address和MspID是返回该错误的节点
+type ChaincodeError struct {
+	Code    string            `json:"Code"`
+	Message string            `json:"Message"`
+	Details map[string]string `json:"Details,omitempty"`
+	Address string            `json:"-"`
+	MspID   string            `json:"-"`
+}
+
+func (e *ChaincodeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ParseChaincodeError 从Submit返回的EndorseError或Evaluate返回的错误中解析出链码错误
+// 两者都是gRPC状态错误，链码返回的消息在状态的ErrorDetail中
+// 链码没有返回带错误码的错误时（如网络错误、旧版链码）返回false
+func ParseChaincodeError(err error) (*ChaincodeError, bool) {
+	if err == nil {
+		return nil, false
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return parseChaincodeMessage(err.Error())
+	}
+
+	for _, detail := range st.Details() {
+		errorDetail, ok := detail.(*gatewaypb.ErrorDetail)
+		if !ok {
+			continue
+		}
+		if chaincodeError, ok := parseChaincodeMessage(errorDetail.GetMessage()); ok {
+			chaincodeError.Address = errorDetail.GetAddress()
+			chaincodeError.MspID = errorDetail.GetMspId()
+			return chaincodeError, true
+		}
+	}
+
+	// 没有ErrorDetail时，错误码可能直接在状态消息中
+	return parseChaincodeMessage(st.Message())
+}
+
+// parseChaincodeMessage 解析节点消息中的链码错误JSON
+// 节点会在链码消息前加上前缀，如"chaincode response 500, "
+func parseChaincodeMessage(message string) (*ChaincodeError, bool) {
+	start := strings.Index(message, `{"Code":`)
+	if start < 0 {
+		return nil, false
+	}
+
+	var chaincodeError ChaincodeError
+	decoder := json.NewDecoder(strings.NewReader(message[start:]))
+	if err := decoder.Decode(&chaincodeError); err != nil || chaincodeError.Code == "" {
+		return nil, false
+	}
+	return &chaincodeError, true
+}
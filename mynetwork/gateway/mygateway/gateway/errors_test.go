@@ -0,0 +1,94 @@
+package gateway_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	gatewaypb "github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"guolong.com/fabric-gateway/gateway"
+)
+
+const notFoundJSON = `{"Code":"ASSET_NOT_FOUND","Message":"the asset asset1 does not exist","Details":{"AssetID":"asset1"}}`
+
+// endorseError 构造与EndorseError相同形式的gRPC状态错误，每个节点的消息放在一个ErrorDetail中
+func endorseError(t *testing.T, message string, details ...*gatewaypb.ErrorDetail) error {
+	t.Helper()
+	st := status.New(codes.Aborted, message)
+	for _, detail := range details {
+		var err error
+		if st, err = st.WithDetails(detail); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st.Err()
+}
+
+func TestParseChaincodeErrorFromErrorDetail(t *testing.T) {
+	err := endorseError(t, "failed to endorse transaction, see attached details for more info",
+		&gatewaypb.ErrorDetail{Address: "peer0.org2.guolong.com:9051", MspId: "Org2MSP", Message: "failed to connect"},
+		&gatewaypb.ErrorDetail{Address: "peer0.org1.guolong.com:7051", MspId: "Org1MSP", Message: "chaincode response 500, " + notFoundJSON},
+	)
+
+	chaincodeError, ok := gateway.ParseChaincodeError(err)
+	if !ok {
+		t.Fatalf("%v has no chaincode error", err)
+	}
+	want := &gateway.ChaincodeError{
+		Code:    gateway.ErrCodeAssetNotFound,
+		Message: "the asset asset1 does not exist",
+		Details: map[string]string{"AssetID": "asset1"},
+		Address: "peer0.org1.guolong.com:7051",
+		MspID:   "Org1MSP",
+	}
+	if !reflect.DeepEqual(want, chaincodeError) {
+		t.Fatalf("got %+v, want %+v", chaincodeError, want)
+	}
+	if got := chaincodeError.Error(); got != "ASSET_NOT_FOUND: the asset asset1 does not exist" {
+		t.Fatalf("got message %q", got)
+	}
+}
+
+func TestParseChaincodeErrorFromStatusMessage(t *testing.T) {
+	// Evaluate的错误没有ErrorDetail，链码消息在状态消息中
+	err := endorseError(t, "evaluate call to endorser returned error: chaincode response 500, "+notFoundJSON)
+
+	chaincodeError, ok := gateway.ParseChaincodeError(err)
+	if !ok {
+		t.Fatalf("%v has no chaincode error", err)
+	}
+	if chaincodeError.Code != gateway.ErrCodeAssetNotFound || chaincodeError.Address != "" {
+		t.Fatalf("got %+v", chaincodeError)
+	}
+}
+
+func TestParseChaincodeErrorFromPlainError(t *testing.T) {
+	err := fmt.Errorf("failed to submit: %w", errors.New(`chaincode response 500, {"Code":"ACCESS_DENIED","Message":"access denied"}`))
+
+	chaincodeError, ok := gateway.ParseChaincodeError(err)
+	if !ok {
+		t.Fatalf("%v has no chaincode error", err)
+	}
+	if chaincodeError.Code != gateway.ErrCodeAccessDenied || chaincodeError.Message != "access denied" {
+		t.Fatalf("got %+v", chaincodeError)
+	}
+}
+
+func TestParseChaincodeErrorWithoutCode(t *testing.T) {
+	for name, err := range map[string]error{
+		"nil":           nil,
+		"plain text":    errors.New("chaincode response 500, the asset asset1 does not exist"),
+		"status":        endorseError(t, "failed to endorse transaction", &gatewaypb.ErrorDetail{Message: "chaincode response 500, function BurnAsset not found"}),
+		"empty code":    errors.New(`{"Code":"","Message":"no code"}`),
+		"invalid JSON":  errors.New(`{"Code":"ASSET_NOT_FOUND","Message":`),
+		"network error": status.Error(codes.Unavailable, "connection refused"),
+	} {
+		if chaincodeError, ok := gateway.ParseChaincodeError(err); ok {
+			t.Errorf("%s: got %+v, want no chaincode error", name, chaincodeError)
+		}
+	}
+}
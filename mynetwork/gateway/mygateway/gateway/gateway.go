@@ -139,14 +139,14 @@ func readFirstFile(dirPath string) ([]byte, error) {
 
 //============ Gateway操作函数 =======
 
-// EvaluateTransaction 执行查询交易
+// EvaluateTransaction 执行查询交易，funcName前加合约名，如"query:GetAllAssets"
 func EvaluateTransaction(gw *client.Gateway, channelName, chainCodeName, funcName string, args ...string) ([]byte, error) {
 	network := gw.GetNetwork(channelName)
 	contract := network.GetContract(chainCodeName)
 	return contract.EvaluateTransaction(funcName, args...)
 }
 
-// SubmitTransaction 执行提交交易
+// SubmitTransaction 执行提交交易，funcName前加合约名，如"asset:CreateAsset"
 func SubmitTransaction(gw *client.Gateway, channelName, chainCodeName, funcName string, args ...string) ([]byte, error) {
 	network := gw.GetNetwork(channelName)
 	contract := network.GetContract(chainCodeName)
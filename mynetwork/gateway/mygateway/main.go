@@ -33,7 +33,7 @@ func main() {
 	defer gw.Close()
 	channelName := "mychannel"
 	// gateway.GetTransactionCount(gw, channelName)
-	// v, err := gateway.EvaluateTransaction(gw, channelName, "basic", "GetAllAssets")
+	// v, err := gateway.EvaluateTransaction(gw, channelName, "basic", "query:GetAllAssets")
 	// if err != nil {
 	// 	fmt.Println("error in EvaluateTransaction")
 	// }